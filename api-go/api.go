@@ -1,14 +1,26 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/lockb0x-llc/pakana-node-0/pkg/logging"
+	"github.com/lockb0x-llc/pakana-node-0/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/stellar/go-stellar-sdk/clients/horizonclient"
+	"github.com/stellar/go-stellar-sdk/protocols/horizon"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"lang.yottadb.com/go/yottadb/v2"
 )
 
@@ -25,7 +37,7 @@ func initBlockList() {
 		trimmed := strings.TrimSpace(id)
 		if trimmed != "" {
 			BlockList[trimmed] = true
-			log.Printf("Blocked configuration loaded for account: %s", trimmed)
+			slog.Info("Blocked configuration loaded", "account", trimmed)
 		}
 	}
 }
@@ -34,9 +46,11 @@ func isBlocked(accountID string) bool {
 	return BlockList[accountID]
 }
 
-// StartInternalServer starts the internal HTTP server for hydration requests
-func StartInternalServer(conn *yottadb.Conn, client *horizonclient.Client) {
-	http.HandleFunc("/internal/cache-account", func(w http.ResponseWriter, r *http.Request) {
+// StartInternalServer starts the internal HTTP server for hydration requests. Backfills
+// it starts are stopped by ctx; the caller drains the returned server on shutdown.
+func StartInternalServer(ctx context.Context, conn *yottadb.Conn, client *horizonclient.Client) *http.Server {
+	// otelhttp continues the caller's trace from its traceparent header
+	http.Handle("/internal/cache-account", otelhttp.NewHandler(instrumentHandler("/internal/cache-account", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
@@ -50,82 +64,198 @@ func StartInternalServer(conn *yottadb.Conn, client *horizonclient.Client) {
 			return
 		}
 
-		log.Printf("Received hydration request for account: %s", req.AccountID)
-
-		// Debug logging for request tracing
-		fmt.Printf("[DEBUG] Processing hydration for: %s\n", req.AccountID)
+		logger := slog.With("account", req.AccountID)
+		if id := r.Header.Get("X-Request-ID"); id != "" {
+			logger = logger.With("request_id", id)
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		logger.Info("Received hydration request")
 
 		// 1. Fetch from Horizon
 		accountReq := horizonclient.AccountRequest{AccountID: req.AccountID}
-		hAccount, err := client.AccountDetail(accountReq)
+		var hAccount horizon.Account
+		err := tracing.Horizon(r.Context(), tracer, "account", func() (err error) {
+			hAccount, err = client.AccountDetail(accountReq)
+			return err
+		})
 		if err != nil {
-			log.Printf("Error fetching account %s from Horizon: %v", req.AccountID, err)
-			fmt.Printf("[DEBUG] Horizon fetch failed for %s: %v\n", req.AccountID, err)
+			logger.Error("Failed to fetch account from Horizon", "error", err)
 			http.Error(w, fmt.Sprintf("Horizon error: %v", err), http.StatusBadGateway)
+			cacheAccountRequests.WithLabelValues("horizon_error").Inc()
 			return
 		}
-		fmt.Printf("[DEBUG] Successfully fetched account %s from Horizon (Seq: %d)\n", req.AccountID, hAccount.Sequence)
+		logger.Debug("Fetched account from Horizon", "seq_num", hAccount.Sequence)
 
 		// 2. Persist to YottaDB (Hydrate)
 		// Use a transaction for atomicity
-		ok := conn.Transaction("", nil, func() int {
+		ok := transaction(r.Context(), conn, "hydrate", func() int {
 			// Store balances
 			for _, bal := range hAccount.Balances {
 				if bal.Asset.Type == "native" {
-					conn.Node("^Account", req.AccountID, "balance").Set(bal.Balance)
+					conn.Node(gAccount, req.AccountID, "balance").Set(bal.Balance)
 				} else {
 					assetCode := bal.Asset.Code
 					if assetCode == "" {
 						assetCode = bal.Asset.Type // fallback
 					}
 					// Standardized Schema: ^Account(req.AccountID, "trustlines", code, issuer, "balance")
-					conn.Node("^Account", req.AccountID, "trustlines", assetCode, bal.Issuer, "balance").Set(bal.Balance)
-					conn.Node("^Account", req.AccountID, "trustlines", assetCode, bal.Issuer, "limit").Set(bal.Limit)
+					conn.Node(gAccount, req.AccountID, "trustlines", assetCode, bal.Issuer, "balance").Set(bal.Balance)
+					conn.Node(gAccount, req.AccountID, "trustlines", assetCode, bal.Issuer, "limit").Set(bal.Limit)
 				}
 			}
-			conn.Node("^Account", req.AccountID, "seq_num").Set(hAccount.Sequence)
+			conn.Node(gAccount, req.AccountID, "seq_num").Set(hAccount.Sequence)
 
 			// Mark as Tracked for Sparse History
-			conn.Node("^Tracked", req.AccountID).Set("1")
+			conn.Node(gTracked, req.AccountID).Set("1")
 
 			return yottadb.YDB_OK
 		})
 
 		if !ok {
-			log.Printf("ERROR: Hydration transaction failed for account %s", req.AccountID)
+			logger.Error("Hydration transaction failed")
 			http.Error(w, "Hydration failed", http.StatusInternalServerError)
+			cacheAccountRequests.WithLabelValues("commit_failed").Inc()
 			return
 		}
+		cacheAccountRequests.WithLabelValues("ok").Inc()
 
-		log.Printf("Hydrated account %s (Seq: %d)", req.AccountID, hAccount.Sequence)
+		logger.Info("Hydrated account", "seq_num", hAccount.Sequence)
 
 		// 3. Gap Detection & Backfill (Robust Hydration)
-		go backfillHistory(conn, client, req.AccountID)
+		startBackfill(ctx, trace.SpanContextFromContext(r.Context()), client, req.AccountID)
 
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"status":"hydrated"}`))
-	})
+	}), "POST /internal/cache-account"))
+	http.Handle("/metrics", promhttp.Handler())
+
+	srv := &http.Server{Addr: ":8081", ReadHeaderTimeout: 10 * time.Second}
+	slog.Info("Internal API starting", "addr", srv.Addr)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logging.Fatal("Internal server crashed", "error", err)
+		}
+	}()
+	return srv
+}
+
+// Backfill progress is checkpointed with each page so an interrupted job resumes where
+// it stopped, at startup or on the account's next hydration:
+//
+//	^Ledger("backfill", account, "account")   the account (for iteration)
+//	^Ledger("backfill", account, "cursor")    paging token of the last stored transaction
+//	^Ledger("backfill", account, "count")     transactions stored so far
+//
+// The checkpoint is removed once the job finishes.
+
+// backfills tracks running jobs so one account has at most one, and so shutdown can
+// wait for them to checkpoint
+var backfills struct {
+	sync.Mutex
+	wg      sync.WaitGroup
+	running map[string]bool
+}
 
-	log.Println("INTERNAL API STARTING ON :8081...")
+// startBackfill runs backfillHistory for accountID unless it is already running
+func startBackfill(ctx context.Context, parent trace.SpanContext, client *horizonclient.Client, accountID string) {
+	backfills.Lock()
+	defer backfills.Unlock()
+	if backfills.running[accountID] {
+		slog.Debug("Backfill already running", "account", accountID)
+		return
+	}
+	if backfills.running == nil {
+		backfills.running = make(map[string]bool)
+	}
+	backfills.running[accountID] = true
+	backfills.wg.Add(1)
 	go func() {
-		if err := http.ListenAndServe(":8081", nil); err != nil {
-			log.Fatalf("INTERNAL SERVER CRASHED: %v", err)
+		defer func() {
+			backfills.Lock()
+			delete(backfills.running, accountID)
+			backfills.Unlock()
+			backfills.wg.Done()
+		}()
+		backfillHistory(ctx, parent, client, accountID)
+	}()
+}
+
+// resumeBackfills restarts the jobs left checkpointed by a previous run
+func resumeBackfills(ctx context.Context, conn *yottadb.Conn, client *horizonclient.Client) {
+	node := conn.Node(gLedger, "backfill", "").Next()
+	for node != nil {
+		if accountID := node.Child("account").Get(""); accountID != "" {
+			slog.Info("Resuming interrupted backfill", "account", accountID, "cursor", node.Child("cursor").Get(""))
+			startBackfill(ctx, trace.SpanContext{}, client, accountID)
 		}
+		node = node.Next()
+	}
+}
+
+// waitBackfills waits for running jobs to stop, reporting false if deadline came first
+func waitBackfills(deadline context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		backfills.wg.Wait()
+		close(done)
 	}()
+	select {
+	case <-done:
+		return true
+	case <-deadline.Done():
+		return false
+	}
 }
 
-func backfillHistory(conn *yottadb.Conn, client *horizonclient.Client, accountID string) {
-	log.Printf("Starting history backfill for %s...", accountID)
+// backfillHistory pages back through an account's history until it meets a transaction
+// already stored. It outlives the hydration request, so it gets its own trace linked to
+// the request's span, and its own connection. Cancelling ctx stops it between pages.
+func backfillHistory(ctx context.Context, parent trace.SpanContext, client *horizonclient.Client, accountID string) {
+	ctx, span := tracer.Start(ctx, "backfill history", trace.WithNewRoot(),
+		trace.WithLinks(trace.Link{SpanContext: parent}),
+		trace.WithAttributes(attribute.String("stellar.account", accountID)))
+	defer span.End()
+
+	conn := yottadb.NewConn()
+	checkpoint := conn.Node(gLedger, "backfill", accountID)
 
-	cursor := "now"
-	count := 0
+	logger := slog.With("account", accountID)
+	if sc := span.SpanContext(); sc.IsValid() {
+		logger = logger.With("trace_id", sc.TraceID().String())
+	}
+	backfillRunning.Inc()
+	result := "error"
+	cursor := checkpoint.Child("cursor").Get("now")
+	count, _ := strconv.Atoi(checkpoint.Child("count").Get("0"))
 	maxTx := 1000 // Safety limit for Community Node
+	defer func() {
+		backfillRunning.Dec()
+		backfillJobs.WithLabelValues(result).Inc()
+		span.SetAttributes(attribute.String("backfill.result", result), attribute.Int("backfill.transactions", count))
+		if result == "error" {
+			span.SetStatus(codes.Error, "backfill failed")
+		}
+		if result != "error" && result != "interrupted" {
+			checkpoint.Kill()
+		}
+	}()
+	logger.Info("Starting history backfill", "cursor", cursor, "transactions", count)
 
 	for {
 		if count >= maxTx {
-			log.Printf("Backfill limit reached (%d txs) for %s", maxTx, accountID)
+			logger.Info("Backfill limit reached", "transactions", maxTx)
+			result = "limit"
 			break
 		}
+		if ctx.Err() != nil {
+			logger.Info("Backfill interrupted, will resume from checkpoint", "cursor", cursor, "transactions", count)
+			result = "interrupted"
+			break
+		}
+
+		pageCtx, pageSpan := tracer.Start(ctx, "backfill page", trace.WithAttributes(attribute.String("horizon.cursor", cursor)))
 
 		txReq := horizonclient.TransactionRequest{
 			ForAccount: accountID,
@@ -134,51 +264,82 @@ func backfillHistory(conn *yottadb.Conn, client *horizonclient.Client, accountID
 			Cursor:     cursor,
 		}
 
-		page, err := client.Transactions(txReq)
+		var page horizon.TransactionsPage
+		err := tracing.Horizon(pageCtx, tracer, "transactions", func() (err error) {
+			page, err = client.Transactions(txReq)
+			return err
+		})
 		if err != nil {
-			log.Printf("Error backfilling history for %s: %v", accountID, err)
+			logger.Error("Backfill failed", "cursor", cursor, "error", err)
+			tracing.End(pageSpan, err)
 			return
 		}
+		pageSpan.SetAttributes(attribute.Int("backfill.page_size", len(page.Embedded.Records)))
 
 		if len(page.Embedded.Records) == 0 {
-			log.Printf("Backfill complete for %s (End of history)", accountID)
+			logger.Info("Backfill complete (end of history)", "transactions", count)
+			result = "end_of_history"
+			pageSpan.End()
 			break
 		}
 
-		for _, tx := range page.Embedded.Records {
-			// Check if we already have this tx
-			// Using the index we added in main.go: ^Stellar("tx_hash", hash)
-			if conn.Node("^Stellar", "tx_hash", tx.Hash).HasValue() {
-				log.Printf("Backfill overlap found at tx %s. Stopping.", tx.Hash)
-				return
-			}
+		// The page and its checkpoint commit together, so a resumed job never re-reads
+		// transactions it stored and mistakes them for the overlap
+		var written int
+		var overlap *horizon.Transaction
+		pageCursor := cursor
+		ok := transaction(pageCtx, conn, "backfill", func() int {
+			written, overlap, pageCursor = 0, nil, cursor
+			for i, tx := range page.Embedded.Records {
+				// Check if we already have this tx
+				// Using the index we added in main.go: ^Stellar("tx_hash", hash)
+				// A transaction the retention policy pruned is stored again instead
+				if seq := conn.Node(gStellar, "tx_hash", tx.Hash).Get(""); seq != "" && !txPruned(conn, seq, tx.Hash) {
+					overlap = &page.Embedded.Records[i]
+					break
+				}
 
-			// Persist
-			seqStr := fmt.Sprintf("%d", tx.Ledger)
-			idxStr := "0" // We don't know the exact index within ledger easily here without parsing logic, using 0 for cache
-			// Wait, main.go uses a counter. Here we are inserting potentially out of order or duplicating index 0.
-			// Ideally we should query the ledger node to find the next index.
-			// But for "Community" cache, maybe we just store passing "999" or hash-based?
-			// Better to use a hash-based index or just increment.
-			// Let's use a high number + loop to find generic slot?
-			// Or just simple scan for next slot.
-
-			txRoot := conn.Node("^Stellar", "ledger", seqStr, "tx")
-			nextIdx := 0
-			for range txRoot.Children() {
-				nextIdx++
-			}
-			idxStr = fmt.Sprintf("%d", nextIdx) // Append mode
+				// Persist, appending after the ledger's existing transactions. Backfilled
+				// transactions don't keep their position within the ledger.
+				seqStr := fmt.Sprintf("%d", tx.Ledger)
+				txRoot := conn.Node(gStellar, "ledger", seqStr, "tx")
+				nextIdx := 0
+				for range txRoot.Children() {
+					nextIdx++
+				}
+				idxStr := fmt.Sprintf("%d", nextIdx) // Append mode
 
-			txNode := conn.Node("^Stellar", "ledger", seqStr, "tx", idxStr)
-			txNode.Child("xdr").Set(tx.EnvelopeXdr)
-			txNode.Child("hash").Set(tx.Hash)
+				txNode := conn.Node(gStellar, "ledger", seqStr, "tx", idxStr)
+				txNode.Child("xdr").Set(tx.EnvelopeXdr)
+				txNode.Child("hash").Set(tx.Hash)
+				// Dates the ledger for the retention policy when it has no header
+				txNode.Child("created_at").Set(tx.LedgerCloseTime.Unix())
 
-			// Update Index
-			conn.Node("^Stellar", "tx_hash", tx.Hash).Set(seqStr)
+				// Update Index
+				conn.Node(gStellar, "tx_hash", tx.Hash).Set(seqStr)
 
-			count++
-			cursor = tx.PagingToken()
+				written++
+				pageCursor = tx.PagingToken()
+			}
+			checkpoint.Child("account").Set(accountID)
+			checkpoint.Child("cursor").Set(pageCursor)
+			checkpoint.Child("count").Set(count + written)
+			return yottadb.YDB_OK
+		})
+		if !ok {
+			logger.Error("Backfill page failed to commit", "cursor", cursor)
+			tracing.End(pageSpan, fmt.Errorf("backfill page commit failed"))
+			return
+		}
+		count += written
+		cursor = pageCursor
+		backfillTransactions.Add(float64(written))
+		pageSpan.End()
+
+		if overlap != nil {
+			logger.Info("Backfill overlap found, stopping", "tx_hash", overlap.Hash, "ledger", overlap.Ledger, "transactions", count)
+			result = "overlap"
+			return
 		}
 	}
 }
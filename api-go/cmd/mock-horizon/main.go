@@ -0,0 +1,68 @@
+// Command mock-horizon serves internal/mockhorizon standalone: just enough of Horizon
+// for the ingestor to stream from. Ledger sequences follow the wall clock (one per
+// -close since a fixed epoch), so a restarted mock carries on where the old one would
+// have been, and killing it mid-stream exercises the ingestor's reconnection and
+// resume. -fail answers every request with 503 to keep the circuit breaker open without
+// killing the process. -lag and -network make a mock that trails the others or serves
+// another network, for exercising failover. -latency delays every non-streaming
+// response, standing in for a remote Horizon when load testing hydration.
+//
+//	go run ./cmd/mock-horizon -addr :8000 -close 2s
+//	HORIZON_URL=http://localhost:8000 STREAM_BACKOFF_BASE=200ms go run .
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lockb0x-llc/pakana-node-0/api-go/internal/mockhorizon"
+)
+
+func main() {
+	cfg := mockhorizon.Config{
+		// Ledger 0 closed at the start of 2024
+		Epoch: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	addr := flag.String("addr", ":8000", "listen address")
+	flag.DurationVar(&cfg.Close, "close", 5*time.Second, "ledger close interval")
+	fail := flag.Bool("fail", false, "answer every request with 503 Service Unavailable")
+	flag.IntVar(&cfg.Lag, "lag", 0, "ledgers to trail the wall-clock schedule by")
+	flag.StringVar(&cfg.Passphrase, "network", "Test SDF Network ; September 2015", "network passphrase to report")
+	latency := flag.Duration("latency", 0, "delay before answering each non-streaming request")
+	flag.Parse()
+
+	handler := mockhorizon.Handler(cfg)
+	if *latency > 0 {
+		handler = delayed(handler, *latency)
+	}
+	if *fail {
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "mock outage", http.StatusServiceUnavailable)
+		})
+	}
+
+	log.Printf("mock Horizon on %s, latest ledger %d, closing every %s", *addr, cfg.LatestLedger(), cfg.Close)
+	log.Fatal(http.ListenAndServe(*addr, logRequests(handler)))
+}
+
+// delayed holds each request for d before answering; ledger streams are not delayed
+func delayed(next http.Handler, d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ledgers" {
+			time.Sleep(d)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/ledgers/") {
+			log.Printf("%s %s", r.Method, r.URL.RequestURI())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
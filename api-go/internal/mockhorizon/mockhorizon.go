@@ -0,0 +1,124 @@
+// Package mockhorizon serves just enough of Horizon for the ingestor to stream from:
+// the root document, a ledger stream, and empty transaction pages. Ledger sequences
+// follow the wall clock (one per Close since Epoch), so a restarted mock carries on
+// where the old one would have been. cmd/mock-horizon serves it standalone; the
+// ingestor's tests start it in-process.
+package mockhorizon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/stellar/go-stellar-sdk/protocols/horizon"
+	"github.com/stellar/go-stellar-sdk/toid"
+)
+
+// Config describes the ledger schedule a mock serves
+type Config struct {
+	Epoch      time.Time     // When ledger 0 closed
+	Close      time.Duration // Ledger close interval
+	Lag        int           // Ledgers to trail the wall-clock schedule by
+	Passphrase string        // Network passphrase to report
+}
+
+// LatestLedger is the last ledger closed on the schedule
+func (cfg Config) LatestLedger() int32 {
+	return int32(time.Since(cfg.Epoch)/cfg.Close) - int32(cfg.Lag)
+}
+
+// Ledger is the header of ledger seq
+func (cfg Config) Ledger(seq int32) horizon.Ledger {
+	closedAt := cfg.Epoch.Add(time.Duration(seq+int32(cfg.Lag)) * cfg.Close)
+	return horizon.Ledger{
+		ID:                         fmt.Sprintf("%064x", seq),
+		PT:                         toid.New(seq, 0, 0).String(),
+		Hash:                       fmt.Sprintf("%064x", seq),
+		Sequence:                   seq,
+		SuccessfulTransactionCount: 0,
+		ClosedAt:                   closedAt,
+		BaseFee:                    100,
+		BaseReserve:                5000000,
+		MaxTxSetSize:               1000,
+		ProtocolVersion:            22,
+	}
+}
+
+// Handler serves the root document, the ledger stream and empty transaction pages
+func Handler(cfg Config) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", cfg.serveRoot)
+	mux.HandleFunc("/ledgers", cfg.serveLedgers)
+	mux.HandleFunc("/ledgers/{seq}/transactions", serveEmptyPage)
+	mux.HandleFunc("/accounts/{id}/transactions", serveEmptyPage)
+	mux.HandleFunc("/transactions", serveEmptyPage)
+	return mux
+}
+
+func (cfg Config) serveRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	latest := cfg.LatestLedger()
+	writeJSON(w, horizon.Root{
+		HorizonVersion:    "mock",
+		HorizonSequence:   latest,
+		IngestSequence:    uint32(latest),
+		CoreSequence:      latest,
+		NetworkPassphrase: cfg.Passphrase,
+	})
+}
+
+// serveLedgers streams ledgers after the cursor as server-sent events, catching up on
+// any the client missed before following new closes
+func (cfg Config) serveLedgers(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || r.Header.Get("Accept") != "text/event-stream" {
+		http.Error(w, "only streaming is supported", http.StatusNotAcceptable)
+		return
+	}
+
+	next := cfg.LatestLedger() + 1
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" && cursor != "now" {
+		pt, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			http.Error(w, "bad cursor", http.StatusBadRequest)
+			return
+		}
+		next = toid.Parse(pt).LedgerSequence + 1
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprint(w, "retry: 1000\nevent: open\ndata: \"hello\"\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(cfg.Close / 4)
+	defer ticker.Stop()
+	for {
+		for ; next <= cfg.LatestLedger(); next++ {
+			data, _ := json.Marshal(cfg.Ledger(next))
+			fmt.Fprintf(w, "id: %s\ndata: %s\n\n", toid.New(next, 0, 0).String(), data)
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func serveEmptyPage(w http.ResponseWriter, r *http.Request) {
+	var page horizon.TransactionsPage
+	page.Embedded.Records = []horizon.Transaction{}
+	writeJSON(w, page)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/hal+json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -3,19 +3,33 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/lockb0x-llc/pakana-node-0/pkg/horizonpool"
+	"github.com/lockb0x-llc/pakana-node-0/pkg/logging"
+	"github.com/lockb0x-llc/pakana-node-0/pkg/tracing"
 	"github.com/stellar/go-stellar-sdk/clients/horizonclient"
 	"github.com/stellar/go-stellar-sdk/protocols/horizon"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"lang.yottadb.com/go/yottadb/v2"
 )
 
 // Pakana Ingestor: Streams ledgers from Stellar and persists to YottaDB
 func main() {
-	log.Println("Pakana API-Go Service Starting...")
+	logging.Init("api-go")
+	slog.Info("Pakana API-Go Service Starting...", "version", buildVersion())
+	shutdownTracing := tracing.Init("api-go", buildVersion())
+
+	// SIGTERM (docker stop) or SIGINT cancels ctx, which stops the stream and backfills
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// Initialize YottaDB (Standard v2 pattern)
 	defer yottadb.Shutdown(yottadb.MustInit())
@@ -23,49 +37,76 @@ func main() {
 
 	// Initialize BlockList
 	initBlockList()
+	net := initNetwork()
 
-	// 1. Steel Thread PoC Verification (Heartbeat)
+	// 1. Steel Thread PoC Verification (Heartbeat), kept fresh by reportStatus
 	timestampStr := fmt.Sprintf("%d", time.Now().Unix())
-	conn.Node("^Ledger", "timestamp").Set(timestampStr)
+	conn.Node(gLedger, "timestamp").Set(timestampStr)
 
 	// 2. Stellar Ingestion Logic
-	horizonURL := os.Getenv("HORIZON_URL")
-	if horizonURL == "" {
-		horizonURL = "https://horizon-testnet.stellar.org"
+	horizonURLs := horizonURLs(net.horizonURL)
+	pool, err := horizonpool.New(horizonURLs, net.passphrase)
+	if err != nil {
+		logging.Fatal("Invalid HORIZON_URLS", "error", err)
 	}
+	validateNetwork(net, pool)
 	client := &horizonclient.Client{
-		HorizonURL: horizonURL,
-		HTTP:       &http.Client{},
+		HorizonURL: horizonURLs[0],
+		HTTP:       pool.Client(0),
 	}
-	log.Printf("Horizon client initialized with URL: %s", horizonURL)
+	slog.Info("Horizon client initialized", "horizon_urls", horizonURLs, "active", pool.Active())
+	go trackHorizonLatest(client, 15*time.Second)
+	go reportStatus(net, pool, 15*time.Second)
 
 	// Start Internal API Server for On-Demand Hydration
-	StartInternalServer(conn, client)
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	srv := StartInternalServer(ctx, conn, client)
+	resumeBackfills(ctx, conn, client)
+	if cfg := loadRetentionConfig(); cfg.enabled() {
+		go runRetention(ctx, cfg)
+	}
 
-	request := horizonclient.LedgerRequest{Cursor: "now"}
+	slog.Info("Starting Stellar Ledger Ingestion Stream...")
 
-	log.Println("Starting Stellar Ledger Ingestion Stream...")
+	// Stream ledgers. The handler runs on the stream's goroutine, so once the stream
+	// returns no ledger is in flight. An error reconnects the stream from the last
+	// committed ledger, so the failed ledger is retried rather than skipped.
+	handleLedger := func(ledger horizon.Ledger) error {
+		// Each ledger is its own trace
+		ledgerCtx, span := tracer.Start(context.Background(), "ingest ledger", trace.WithNewRoot(),
+			trace.WithAttributes(attribute.Int("stellar.ledger", int(ledger.Sequence))))
+		defer span.End()
 
-	// Stream ledgers
-	err := client.StreamLedgers(ctx, request, func(ledger horizon.Ledger) {
-		log.Printf("Ingested Stellar Ledger: %d (Closed at: %s)", ledger.Sequence, ledger.ClosedAt)
+		logger := slog.With("ledger", ledger.Sequence)
+		if sc := span.SpanContext(); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		logger.Debug("Received Stellar ledger", "closed_at", ledger.ClosedAt)
+		recordLedgerSeen(ledger.Sequence, ledger.PagingToken())
 
 		seqStr := fmt.Sprintf("%d", ledger.Sequence)
 
 		// 1. Fetch transactions first (Outside TP to keep txn window small)
-		txCount, txs, txErr := fetchTransactions(client, ledger.Sequence)
+		txCount, txs, txErr := fetchTransactions(ledgerCtx, client, ledger.Sequence)
 		if txErr != nil {
-			log.Printf("Error fetching transactions for ledger %d: %v", ledger.Sequence, txErr)
-			return
+			logger.Error("Failed to fetch ledger transactions", "error", txErr)
+			ledgerFetchFailures.Inc()
+			span.SetStatus(codes.Error, "transaction fetch failed")
+			return txErr
 		}
 
+		// Past this point the commit runs to completion. Before it, a ledger seen during
+		// shutdown is dropped; ^Stellar("ingested") only moves inside the transaction.
+		if ctx.Err() != nil {
+			logger.Info("Shutting down, ledger abandoned before commit")
+			span.SetStatus(codes.Error, "abandoned at shutdown")
+			return ctx.Err()
+		}
+		span.SetAttributes(attribute.Int("stellar.tx_count", txCount))
+
 		// 2. Atomic Write Block
-		ok := conn.Transaction("", nil, func() int {
+		ok := transaction(ledgerCtx, conn, "ledger", func() int {
 			// Write Header
-			ledgerNode := conn.Node("^Stellar", "ledger", seqStr)
+			ledgerNode := conn.Node(gStellar, "ledger", seqStr)
 			ledgerNode.Child("closed_at").Set(ledger.ClosedAt.String())
 			ledgerNode.Child("hash").Set(ledger.Hash)
 			ledgerNode.Child("total_tx_count").Set(txCount)
@@ -83,43 +124,108 @@ func main() {
 				txNode.Child("hash").Set(tx.Hash)
 
 				// Index Hash -> Ledger Sequence (For Gap Detection)
-				conn.Node("^Stellar", "tx_hash", tx.Hash).Set(seqStr)
+				conn.Node(gStellar, "tx_hash", tx.Hash).Set(seqStr)
 			}
 
-			// Store the filtered count
+			// Store the filtered count. Only this transaction writes it, so core-rust takes
+			// it to mean the ingestor wrote the whole ledger.
 			ledgerNode.Child("filtered_tx_count").Set(filteredCount)
 
-			// Update ^Stellar("latest") = sequence (The atomic commit pointer)
-			conn.Node("^Stellar", "latest").Set(seqStr)
+			// ^Stellar("ingested") is the ingestor's own commit pointer, resumed from after a
+			// reconnect or restart. ^Stellar("latest") is shared with api-report hydration,
+			// which may already have moved it past this ledger.
+			conn.Node(gStellar, "ingested").Set(seqStr)
+			latest, _ := strconv.ParseInt(conn.Node(gStellar, "latest").Get("0"), 10, 32)
+			if int32(latest) < ledger.Sequence {
+				conn.Node(gStellar, "latest").Set(seqStr)
+			}
 
 			return yottadb.YDB_OK
 		})
 
 		if !ok {
-			log.Printf("CRITICAL: Transaction failed for ledger %d", ledger.Sequence)
-		} else {
-			log.Printf("✓ Committed Ledger %d (%d txs processed)", ledger.Sequence, txCount)
+			logger.Error("Ledger transaction failed to commit")
+			span.SetStatus(codes.Error, "commit failed")
+			return fmt.Errorf("ledger %d failed to commit", ledger.Sequence)
 		}
-	})
+		logger.Info("Committed ledger", "txs", txCount, "closed_at", ledger.ClosedAt)
+		recordCommittedLedger(ledger.Sequence)
+		return nil
+	}
+	streamDone := make(chan struct{})
+	go func() {
+		resume := func() string { return committedCursor(conn) }
+		streamLedgers(ctx, pool, client, resume, handleLedger)
+		close(streamDone)
+	}()
+
+	// streamLedgers reconnects on its own, so it only returns once shutdown begins
+	<-ctx.Done()
+	stop()
+
+	timeout := shutdownTimeout()
+	slog.Info("Shutting down", "timeout", timeout.String())
+	deadline, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	if err != nil {
-		log.Fatalf("Stellar StreamLedgers error: %v", err)
+	// 1. Let the ledger in flight commit
+	select {
+	case <-streamDone:
+	case <-deadline.Done():
+		// Exiting mid-transaction rolls it back, so the ledger is simply not committed
+		logging.Fatal("Shutdown deadline exceeded with a ledger in flight")
+	}
+
+	// 2. Drain hydration requests, then 3. wait for backfills to checkpoint
+	if err := srv.Shutdown(deadline); err != nil {
+		slog.Warn("Internal server did not drain before the deadline", "error", err)
+	}
+	if !waitBackfills(deadline) {
+		slog.Warn("Backfills still running at the shutdown deadline; they resume from their last checkpoint")
+	}
+
+	if err := shutdownTracing(deadline); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
 	}
+	slog.Info("Ingestor stopped", "last_committed", int64(metricValue(lastCommittedLedger)))
+}
 
-	select {}
+// shutdownTimeout bounds the whole shutdown sequence (SHUTDOWN_TIMEOUT, default 20s).
+// Keep it below the container's stop grace period.
+func shutdownTimeout() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && v > 0 {
+		return v
+	}
+	return 20 * time.Second
 }
 
-// fetchTransactions fetches all transactions for a given ledger sequence
-func fetchTransactions(client *horizonclient.Client, ledgerSeq int32) (int, []horizon.Transaction, error) {
+// fetchTransactions fetches all transactions for a given ledger sequence, following
+// the pages' next links until Horizon returns an empty page
+func fetchTransactions(ctx context.Context, client *horizonclient.Client, ledgerSeq int32) (int, []horizon.Transaction, error) {
 	txRequest := horizonclient.TransactionRequest{
 		ForLedger: uint(ledgerSeq),
 		Limit:     200,
 	}
 
-	txPage, err := client.Transactions(txRequest)
+	var txPage horizon.TransactionsPage
+	err := tracing.Horizon(ctx, tracer, "transactions", func() (err error) {
+		txPage, err = client.Transactions(txRequest)
+		return err
+	})
+	var txs []horizon.Transaction
+	for err == nil && len(txPage.Embedded.Records) > 0 {
+		txs = append(txs, txPage.Embedded.Records...)
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		err = tracing.Horizon(ctx, tracer, "transactions", func() (err error) {
+			txPage, err = client.NextTransactionsPage(txPage)
+			return err
+		})
+	}
 	if err != nil {
 		return 0, nil, fmt.Errorf("failed to fetch transactions: %w", err)
 	}
 
-	return len(txPage.Embedded.Records), txPage.Embedded.Records, nil
+	return len(txs), txs, nil
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stellar/go-stellar-sdk/clients/horizonclient"
+	"github.com/stellar/go-stellar-sdk/protocols/horizon"
+)
+
+// servePagedTransactions serves total transactions for ledger 7, limit per page, with
+// next links carrying the cursor the way Horizon's do
+func servePagedTransactions(t *testing.T, total int) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ledgers/7/transactions" {
+			http.NotFound(w, r)
+			return
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		cursor, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		var page horizon.TransactionsPage
+		page.Embedded.Records = []horizon.Transaction{}
+		for i := cursor; i < total && i < cursor+limit; i++ {
+			page.Embedded.Records = append(page.Embedded.Records, horizon.Transaction{
+				Hash: fmt.Sprintf("%064x", i), PT: strconv.Itoa(i + 1), Ledger: 7,
+			})
+		}
+		next := cursor + len(page.Embedded.Records)
+		page.Links.Next.Href = fmt.Sprintf("%s/ledgers/7/transactions?cursor=%d&limit=%d", srv.URL, next, limit)
+		w.Header().Set("Content-Type", "application/hal+json")
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchTransactionsFollowsPages(t *testing.T) {
+	for _, total := range []int{0, 3, 200, 450} {
+		srv := servePagedTransactions(t, total)
+		client := &horizonclient.Client{HorizonURL: srv.URL + "/", HTTP: srv.Client()}
+
+		count, txs, err := fetchTransactions(context.Background(), client, 7)
+		if err != nil {
+			t.Fatalf("%d transactions: %v", total, err)
+		}
+		if count != total || len(txs) != total {
+			t.Fatalf("%d transactions: fetched count %d, %d records", total, count, len(txs))
+		}
+		for i, tx := range txs {
+			if tx.Hash != fmt.Sprintf("%064x", i) {
+				t.Fatalf("%d transactions: record %d is %s", total, i, tx.Hash)
+			}
+		}
+	}
+}
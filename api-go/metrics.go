@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stellar/go-stellar-sdk/clients/horizonclient"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// The ingestor's metrics go to the default registry, which the internal server exposes
+// at /metrics with the Go runtime and process collectors. The shared Horizon pool adds
+// its pakana_horizon_* series (pkg/horizonpool/metrics.go).
+
+// metricValue totals the current value of every counter or gauge series c collects.
+// /status reports a few of them.
+func metricValue(c prometheus.Collector) float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	total := 0.0
+	for m := range ch {
+		var pb dto.Metric
+		if m.Write(&pb) == nil {
+			total += pb.GetCounter().GetValue() + pb.GetGauge().GetValue()
+		}
+	}
+	return total
+}
+
+// Ingestor metrics
+var (
+	ledgersIngested = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pakana_ledgers_ingested_total",
+		Help: "Ledgers committed to ^Stellar.",
+	})
+	lastCommittedLedger = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pakana_last_committed_ledger",
+		Help: "Sequence of the last ledger committed to ^Stellar.",
+	})
+	horizonLatestLedger = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pakana_horizon_latest_ledger",
+		Help: "Latest ledger ingested by Horizon.",
+	})
+	ingestLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pakana_ingest_lag_ledgers",
+		Help: "Ledgers between Horizon's latest and the last committed ledger.",
+	})
+	ledgerFetchFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pakana_ledger_fetch_failures_total",
+		Help: "Ledger transaction fetches from Horizon that failed; the stream reconnects and retries the ledger.",
+	})
+	tpCommitFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pakana_tp_commit_failures_total",
+		Help: "YottaDB transactions that failed to commit, by operation.",
+	}, []string{"op"})
+	tpRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pakana_tp_retries_total",
+		Help: "YottaDB transaction restarts, by operation.",
+	}, []string{"op"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pakana_http_request_duration_seconds",
+		Help:    "Internal HTTP request latency by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+	cacheAccountRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pakana_cache_account_requests_total",
+		Help: "Account hydrations requested over /internal/cache-account, by result.",
+	}, []string{"result"})
+	streamState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pakana_stream_state",
+		Help: "1 for the ledger stream's current state (connecting, connected, backoff, open, half_open), 0 otherwise.",
+	}, []string{"state"})
+	streamFailures = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pakana_stream_consecutive_failures",
+		Help: "Ledger stream connections that failed in a row; the circuit opens at STREAM_BREAKER_THRESHOLD.",
+	})
+	streamReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pakana_stream_reconnects_total",
+		Help: "Times the ledger stream failed and was reconnected.",
+	})
+	backfillJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pakana_backfill_jobs_total",
+		Help: "Finished history backfill jobs, by result (overlap, end_of_history, limit, interrupted, error).",
+	}, []string{"result"})
+	backfillRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pakana_backfill_jobs_running",
+		Help: "History backfill jobs in progress.",
+	})
+	backfillTransactions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pakana_backfill_transactions_total",
+		Help: "Transactions written by history backfill.",
+	})
+	pruneTransactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pakana_prune_transactions_total",
+		Help: "Transactions the retention policy pruned (delete), would prune (dry_run) or kept (tracked, lockb0x, undecodable).",
+	}, []string{"result"})
+	pruneReclaimedNodes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pakana_prune_reclaimed_nodes_total",
+		Help: "Nodes with a value deleted by the retention policy, by mode (delete, dry_run).",
+	}, []string{"mode"})
+	pruneReclaimedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pakana_prune_reclaimed_bytes_total",
+		Help: "Value bytes deleted by the retention policy, by mode (delete, dry_run).",
+	}, []string{"mode"})
+	pruneThrough = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pakana_prune_through_ledger",
+		Help: "Last ledger the retention policy has pruned.",
+	})
+)
+
+// transaction runs fn in a YottaDB transaction, counting restarts and failures under op.
+// Inside a traced operation it adds a "ydb.tp <op>" span; periodic writes such as the
+// status heartbeat have no parent and stay untraced.
+func transaction(ctx context.Context, conn *yottadb.Conn, op string, fn func() int) bool {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		_, span = tracer.Start(ctx, "ydb.tp "+op)
+		defer span.End()
+	}
+
+	calls := 0
+	ok := conn.Transaction("", nil, func() int {
+		calls++
+		return fn()
+	})
+	if calls > 1 {
+		tpRetries.WithLabelValues(op).Add(float64(calls - 1))
+	}
+	span.SetAttributes(attribute.Int("ydb.tp.attempts", calls))
+	if !ok {
+		tpCommitFailures.WithLabelValues(op).Inc()
+		span.SetStatus(codes.Error, "transaction failed")
+	}
+	return ok
+}
+
+// Ingest lag is Horizon's latest ledger minus the last committed one, recomputed when
+// either changes
+var lag struct {
+	sync.Mutex
+	committed, horizon int32
+}
+
+func updateIngestLag() {
+	if lag.committed == 0 || lag.horizon == 0 {
+		return
+	}
+	ingestLag.Set(float64(max(lag.horizon-lag.committed, 0)))
+}
+
+// recordCommittedLedger updates the ingest metrics after a ledger commits
+func recordCommittedLedger(seq int32) {
+	ledgersIngested.Inc()
+	lastCommittedLedger.Set(float64(seq))
+	lag.Lock()
+	lag.committed = seq
+	updateIngestLag()
+	lag.Unlock()
+}
+
+// trackHorizonLatest polls Horizon's root for its latest ledger, so lag keeps growing
+// while the stream is stalled
+func trackHorizonLatest(client *horizonclient.Client, interval time.Duration) {
+	for {
+		if root, err := client.Root(); err == nil {
+			horizonLatestLedger.Set(float64(root.HorizonSequence))
+			lag.Lock()
+			lag.horizon = root.HorizonSequence
+			updateIngestLag()
+			lag.Unlock()
+		}
+		time.Sleep(interval)
+	}
+}
+
+// instrumentHandler records latency and status for an internal route
+func instrumentHandler(route string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		fn(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		httpRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Observe(time.Since(start).Seconds())
+	}
+}
+
+// statusRecorder captures the response status for instrumentHandler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/lockb0x-llc/pakana-node-0/pkg/horizonpool"
+	"github.com/lockb0x-llc/pakana-node-0/pkg/logging"
+	"github.com/lockb0x-llc/pakana-node-0/pkg/stellarnet"
+)
+
+// Each ingestor indexes one Stellar network, named by STELLAR_NETWORK: testnet
+// (default), pubnet or futurenet. The name sets the passphrase Horizon must report and
+// the Horizon used when HORIZON_URLS is unset. STELLAR_NETWORK_PASSPHRASE overrides the
+// passphrase, and is required for any other name (a private network, say). To index
+// several networks, run one ingestor per network against the same database.
+//
+// Every network keeps its data in its own globals. Testnet uses the unqualified names
+// (^Stellar, ^Account, ^Tracked, ^Ledger), so databases written before networks were
+// configurable stay readable; any other network appends its capitalised name:
+//
+//	^StellarPubnet("ledger", seq, ...)   ^AccountPubnet(id, ...)
+//	^TrackedPubnet(id)                   ^LedgerPubnet("status", ...)
+
+type stellarNetwork struct {
+	name       string
+	passphrase string
+	horizonURL string // Default Horizon when HORIZON_URLS is unset
+}
+
+// Global names for the configured network, set by initNetwork
+var (
+	gStellar = "^Stellar"
+	gAccount = "^Account"
+	gTracked = "^Tracked"
+	gLedger  = "^Ledger"
+)
+
+// initNetwork reads the network configuration and points the globals at its namespace
+func initNetwork() stellarNetwork {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("STELLAR_NETWORK")))
+	passphrase := os.Getenv("STELLAR_NETWORK_PASSPHRASE")
+	if name == "" && passphrase != "" {
+		// Deployments that only set the passphrase keep working
+		if name = stellarnet.NameOf(passphrase); name == "" {
+			logging.Fatal("STELLAR_NETWORK is required with a custom STELLAR_NETWORK_PASSPHRASE")
+		}
+	}
+	if name == "" {
+		name = stellarnet.Default
+	}
+	if !stellarnet.ValidName(name) {
+		logging.Fatal("Invalid STELLAR_NETWORK: use lowercase letters and digits, at most 20", "network", name)
+	}
+
+	known, ok := stellarnet.Known[name]
+	if !ok && passphrase == "" {
+		logging.Fatal("Unknown STELLAR_NETWORK needs STELLAR_NETWORK_PASSPHRASE", "network", name)
+	}
+	net := stellarNetwork{name: name, passphrase: known.Passphrase, horizonURL: known.HorizonURL}
+	if passphrase != "" {
+		net.passphrase = passphrase
+	}
+
+	gStellar = stellarnet.Global("^Stellar", name)
+	gAccount = stellarnet.Global("^Account", name)
+	gTracked = stellarnet.Global("^Tracked", name)
+	gLedger = stellarnet.Global("^Ledger", name)
+	slog.Info("Stellar network configured", "network", name, "passphrase", net.passphrase, "globals", gStellar)
+	return net
+}
+
+// horizonURLs reads HORIZON_URLS, falling back to HORIZON_URL and then defaultURL
+func horizonURLs(defaultURL string) []string {
+	raw := os.Getenv("HORIZON_URLS")
+	if raw == "" {
+		raw = os.Getenv("HORIZON_URL")
+	}
+	return horizonpool.URLs(raw, defaultURL)
+}
+
+// validateNetwork stops startup if Horizon answers for a different network. With no
+// Horizon reachable yet, startup goes ahead: the stream retries, and the pool's probes
+// rule out any endpoint that comes up on the wrong network.
+func validateNetwork(net stellarNetwork, pool *horizonpool.Pool) {
+	reported, answered := pool.Networks()
+	for _, passphrase := range reported {
+		if passphrase == net.passphrase {
+			return
+		}
+	}
+	if answered == 0 {
+		slog.Warn("No Horizon reachable to validate the network against", "network", net.name)
+		return
+	}
+	logging.Fatal("No Horizon endpoint is on the configured network", "network", net.name,
+		"expected", net.passphrase, "reported", strings.Join(reported, " | "))
+}
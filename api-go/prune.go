@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lockb0x-llc/pakana-node-0/pkg/stellartx"
+	"github.com/stellar/go-stellar-sdk/xdr"
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// Raw envelope XDR is most of ^Stellar, and once core-rust has derived ^Account state
+// from a ledger it is only read to serve /transactions. With a retention policy set, a
+// worker deletes ^Stellar("ledger", seq, "tx", ...) records (including the hydrated
+// slot) for ledgers more than PRUNE_KEEP_LEDGERS behind the latest or older than
+// PRUNE_KEEP_DAYS, whichever keeps more. Headers, the tx_hash index and ^Account are
+// never touched, nor is anything above ^Stellar("processed_through"), the contiguous
+// mark below which core-rust will not read a ledger again. A ledger's age is its
+// header's closed_at; a ledger only written by backfill or hydration has no header and
+// takes the latest created_at of its transactions instead. A transaction is
+// always kept if it touches an account in ^Tracked, is indexed at ^Codex("tx", hash),
+// or commits to a Lockb0x record or draft in its memo or lockb0x manageData entry.
+//
+//	^Stellar("ledger", seq, "pruned")      transactions deleted from the ledger
+//	^Ledger("prune", "through")            last ledger pruned, where the next pass starts
+//
+// A pruned transaction is hydrated from Horizon again when api-report is asked for it,
+// and a backfill stores it again rather than taking it for the overlap.
+
+// Lockb0x commitments, as api-report writes them (see api-report/codex)
+const (
+	anchorDataName     = "lockb0x"
+	revocationDataName = "lockb0x_revoke"
+)
+
+type retentionConfig struct {
+	keepLedgers int64         // Ledgers kept behind the latest; 0 for no limit
+	keepAge     time.Duration // Age of ledgers kept; 0 for no limit
+	interval    time.Duration
+	dryRun      bool // Report what would be reclaimed without deleting
+}
+
+// pruneResult totals one pass
+type pruneResult struct {
+	through  int64 // Last ledger the pass covered
+	ledgers  int
+	pruned   int // Transactions deleted, or that would be in a dry run
+	kept     int
+	nodes    int64 // Nodes with a value under the pruned transactions
+	bytes    int64 // Value bytes (XDR and hashes) under the pruned transactions
+	finished time.Time
+}
+
+var pruneHealth struct {
+	sync.Mutex
+	enabled bool
+	dryRun  bool
+	last    pruneResult
+}
+
+func loadRetentionConfig() retentionConfig {
+	cfg := retentionConfig{interval: time.Hour}
+	if v, err := strconv.ParseInt(os.Getenv("PRUNE_KEEP_LEDGERS"), 10, 64); err == nil && v > 0 {
+		cfg.keepLedgers = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("PRUNE_KEEP_DAYS")); err == nil && v > 0 {
+		cfg.keepAge = time.Duration(v) * 24 * time.Hour
+	}
+	if v, err := time.ParseDuration(os.Getenv("PRUNE_KEEP_AGE")); err == nil && v > 0 {
+		cfg.keepAge = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("PRUNE_INTERVAL")); err == nil && v > 0 {
+		cfg.interval = v
+	}
+	cfg.dryRun = os.Getenv("PRUNE_DRY_RUN") == "true"
+	return cfg
+}
+
+func (cfg retentionConfig) enabled() bool {
+	return cfg.keepLedgers > 0 || cfg.keepAge > 0
+}
+
+// runRetention prunes every interval on its own connection until ctx is cancelled. Each
+// ledger is pruned in its own transaction, so stopping mid-pass loses nothing.
+func runRetention(ctx context.Context, cfg retentionConfig) {
+	pruneHealth.Lock()
+	pruneHealth.enabled, pruneHealth.dryRun = true, cfg.dryRun
+	pruneHealth.Unlock()
+	slog.Info("Retention policy enabled", "keep_ledgers", cfg.keepLedgers, "keep_age", cfg.keepAge.String(),
+		"interval", cfg.interval.String(), "dry_run", cfg.dryRun)
+
+	conn := yottadb.NewConn()
+	// A dry run never moves the stored cursor, so it keeps its own
+	cursor, _ := strconv.ParseInt(conn.Node(gLedger, "prune", "through").Get("0"), 10, 64)
+	for {
+		res := pruneLedgers(ctx, conn, cfg, cursor)
+		res.finished = time.Now()
+		cursor = res.through
+
+		pruneHealth.Lock()
+		pruneHealth.last = res
+		pruneHealth.Unlock()
+		pruneThrough.Set(float64(res.through))
+		if res.ledgers > 0 {
+			msg := "Pruned raw transaction XDR"
+			if cfg.dryRun {
+				msg = "Dry run: raw transaction XDR that would be pruned"
+			}
+			slog.Info(msg, "ledgers", res.ledgers, "through", res.through, "transactions", res.pruned,
+				"kept", res.kept, "nodes", res.nodes, "bytes", res.bytes)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cfg.interval):
+		}
+	}
+}
+
+// pruneLedgers prunes the ledgers after cursor that fall outside the retention window
+func pruneLedgers(ctx context.Context, conn *yottadb.Conn, cfg retentionConfig, cursor int64) pruneResult {
+	res := pruneResult{through: cursor}
+
+	// core-rust derives ^Account from each ledger, so its XDR must outlive processing.
+	// ^Stellar("processed") from older core-rust versions could skip ledgers, so only the
+	// contiguous mark counts.
+	limit, _ := strconv.ParseInt(conn.Node(gStellar, "processed_through").Get("0"), 10, 64)
+	if limit == 0 {
+		slog.Warn("core-rust has not recorded processed_through yet; nothing pruned")
+		return res
+	}
+	if cfg.keepLedgers > 0 {
+		latest, _ := strconv.ParseInt(conn.Node(gStellar, "latest").Get("0"), 10, 64)
+		limit = min(limit, latest-cfg.keepLedgers)
+	}
+	cutoff := time.Now().Add(-cfg.keepAge)
+
+	mode := "delete"
+	if cfg.dryRun {
+		mode = "dry_run"
+	}
+	var bound closedBound
+	ledger := conn.Node(gStellar, "ledger", cursor).Next()
+	for ledger != nil && ctx.Err() == nil {
+		seq, err := strconv.ParseInt(ledger.Subscript(-1), 10, 64)
+		if err != nil || seq > limit {
+			break
+		}
+		if cfg.keepAge > 0 {
+			closedAt, ok := ledgerClosedAt(ledger)
+			if !ok {
+				closedAt, ok = bound.after(conn, seq, limit)
+			}
+			if !ok || closedAt.After(cutoff) {
+				break
+			}
+		}
+
+		var lp ledgerPrune
+		ok := transaction(ctx, conn, "prune", func() int {
+			lp = pruneLedger(conn, ledger, cfg.dryRun)
+			if !cfg.dryRun {
+				conn.Node(gLedger, "prune", "through").Set(seq)
+			}
+			return yottadb.YDB_OK
+		})
+		if !ok {
+			slog.Error("Failed to prune ledger", "ledger", seq)
+			break
+		}
+		res.through = seq
+		res.ledgers++
+		res.pruned += lp.pruned
+		res.nodes += lp.nodes
+		res.bytes += lp.bytes
+		for reason, n := range lp.kept {
+			res.kept += n
+			pruneTransactions.WithLabelValues(reason).Add(float64(n))
+		}
+		pruneTransactions.WithLabelValues(mode).Add(float64(lp.pruned))
+		pruneReclaimedNodes.WithLabelValues(mode).Add(float64(lp.nodes))
+		pruneReclaimedBytes.WithLabelValues(mode).Add(float64(lp.bytes))
+		ledger = ledger.Next()
+	}
+	return res
+}
+
+// closedAtLayout is how ledger headers store closed_at (time.Time.String)
+const closedAtLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// ledgerClosedAt is when a ledger closed: its header's closed_at or, without a header,
+// the latest created_at (unix seconds) stored with its transactions
+func ledgerClosedAt(ledger *yottadb.Node) (time.Time, bool) {
+	if closedAt, err := time.Parse(closedAtLayout, ledger.Child("closed_at").Get("")); err == nil {
+		return closedAt, true
+	}
+	var latest int64
+	for tx := range ledger.Child("tx").Children() {
+		if tx.Subscript(-1) != "hydrated" {
+			created, _ := strconv.ParseInt(tx.Child("created_at").Get("0"), 10, 64)
+			latest = max(latest, created)
+			continue
+		}
+		for hydrated := range tx.Children() {
+			created, _ := strconv.ParseInt(hydrated.Child("created_at").Get("0"), 10, 64)
+			latest = max(latest, created)
+		}
+	}
+	return time.Unix(latest, 0), latest > 0
+}
+
+// closedBound dates ledgers whose transactions were backfilled before created_at was
+// stored. Ledgers close in sequence order, so the next ledger up to limit whose age is
+// known closed no earlier; it is remembered for the run of undated ledgers below it.
+type closedBound struct {
+	seq int64
+	at  time.Time
+}
+
+func (b *closedBound) after(conn *yottadb.Conn, seq, limit int64) (time.Time, bool) {
+	if b.seq > seq {
+		return b.at, true
+	}
+	for next := conn.Node(gStellar, "ledger", seq).Next(); next != nil; next = next.Next() {
+		nextSeq, err := strconv.ParseInt(next.Subscript(-1), 10, 64)
+		if err != nil || nextSeq > limit {
+			break
+		}
+		if closedAt, ok := ledgerClosedAt(next); ok {
+			b.seq, b.at = nextSeq, closedAt
+			return closedAt, true
+		}
+	}
+	return time.Time{}, false
+}
+
+type ledgerPrune struct {
+	pruned       int
+	kept         map[string]int // By keepReason
+	nodes, bytes int64
+}
+
+// pruneLedger deletes the ledger's transactions that nothing needs kept. Call inside a
+// transaction.
+func pruneLedger(conn *yottadb.Conn, ledger *yottadb.Node, dryRun bool) ledgerPrune {
+	lp := ledgerPrune{kept: map[string]int{}}
+	var txs []*yottadb.Node
+	for tx := range ledger.Child("tx").Children() {
+		if sub := tx.Subscript(-1); sub != "hydrated" {
+			txs = append(txs, ledger.Child("tx", sub))
+			continue
+		}
+		for hydrated := range tx.Children() {
+			txs = append(txs, ledger.Child("tx", "hydrated", hydrated.Subscript(-1)))
+		}
+	}
+
+	for _, tx := range txs {
+		if reason := keepReason(conn, tx.Child("hash").Get(""), tx.Child("xdr").Get("")); reason != "" {
+			lp.kept[reason]++
+			continue
+		}
+		nodes, bytes := subtreeSize(tx)
+		lp.nodes += nodes
+		lp.bytes += bytes
+		lp.pruned++
+		if !dryRun {
+			tx.Kill()
+		}
+	}
+	if lp.pruned > 0 && !dryRun {
+		previous, _ := strconv.Atoi(ledger.Child("pruned").Get("0"))
+		ledger.Child("pruned").Set(previous + lp.pruned)
+	}
+	return lp
+}
+
+// keepReason says why a transaction must be kept (tracked, lockb0x or undecodable), or
+// "" if it can be pruned
+func keepReason(conn *yottadb.Conn, hash, envelopeXDR string) string {
+	if hash != "" && conn.Node("^Codex", "tx", hash).HasValue() {
+		return "lockb0x"
+	}
+
+	var envelope xdr.TransactionEnvelope
+	if err := xdr.SafeUnmarshalBase64(envelopeXDR, &envelope); err != nil {
+		return "undecodable"
+	}
+	for _, commitment := range lockb0xCommitments(envelope) {
+		if conn.Node("^Codex", commitment).HasTree() || conn.Node("^Codex", "draft", commitment).HasTree() {
+			return "lockb0x"
+		}
+	}
+	for account := range stellartx.Participants(envelope) {
+		if conn.Node(gTracked, account).HasValue() {
+			return "tracked"
+		}
+	}
+	return ""
+}
+
+// lockb0xCommitments are the hex pointer hashes a transaction commits to, as core-rust
+// reads them: a MEMO_HASH or MEMO_RETURN, and 32-byte lockb0x or lockb0x_revoke entries
+func lockb0xCommitments(envelope xdr.TransactionEnvelope) []string {
+	var hashes []string
+	memo := envelope.Memo()
+	if h, ok := memo.GetHash(); ok {
+		hashes = append(hashes, hex.EncodeToString(h[:]))
+	}
+	if h, ok := memo.GetRetHash(); ok {
+		hashes = append(hashes, hex.EncodeToString(h[:]))
+	}
+	for _, op := range envelope.Operations() {
+		data, ok := op.Body.GetManageDataOp()
+		if !ok || data.DataValue == nil || len(*data.DataValue) != 32 {
+			continue
+		}
+		if name := string(data.DataName); name == anchorDataName || name == revocationDataName {
+			hashes = append(hashes, hex.EncodeToString(*data.DataValue))
+		}
+	}
+	return hashes
+}
+
+// subtreeSize counts the nodes holding a value under node, and their value bytes
+func subtreeSize(node *yottadb.Node) (nodes, bytes int64) {
+	if node.HasValue() {
+		nodes++
+		bytes += int64(len(node.Get("")))
+	}
+	for child := range node.Children() {
+		n, b := subtreeSize(child)
+		nodes += n
+		bytes += b
+	}
+	return nodes, bytes
+}
+
+// txPruned reports whether the pruner deleted the transaction hash from ledger seq,
+// leaving only its tx_hash index entry
+func txPruned(conn *yottadb.Conn, seq, hash string) bool {
+	ledger := conn.Node(gStellar, "ledger", seq)
+	if !ledger.Child("pruned").HasValue() || ledger.Child("tx", "hydrated", hash).HasTree() {
+		return false
+	}
+	for tx := range ledger.Child("tx").Children() {
+		if tx.Child("hash").Get("") == hash {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/lockb0x-llc/pakana-node-0/pkg/horizonpool"
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// The ingestor's status lives at ^Ledger("status") (in the network's ^Ledger global)
+// and is rewritten every interval, along with the ^Ledger("timestamp") heartbeat:
+//
+//	^Ledger("status", "heartbeat" | "started_at")          unix seconds
+//	^Ledger("status", "last_seen" | "last_committed")      ledger sequences
+//	^Ledger("status", "cursor")                            paging token of the last ledger seen
+//	^Ledger("status", "horizon_url" | "version" | "hostname" | "pid")   horizon_url is the active endpoint
+//	^Ledger("status", "network" | "passphrase")           the configured network
+//	^Ledger("status", "errors", name)                      counts since start
+//	^Ledger("status", "stream", "state" | "since" | "failures" | "reconnects" | "last_error")
+//	^Ledger("status", "retention", "dry_run" | "through" | "last_run" | "ledgers" | "transactions" | "kept" | "nodes" | "bytes")
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+var ingestStatus struct {
+	sync.Mutex
+	startedAt time.Time
+	lastSeen  int32
+	cursor    string
+}
+
+// buildVersion is version, with the VCS revision when the binary was built from a checkout
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return version + "+" + setting.Value[:12]
+		}
+	}
+	return version
+}
+
+// recordLedgerSeen notes a ledger received from the stream, before it is committed
+func recordLedgerSeen(seq int32, cursor string) {
+	ingestStatus.Lock()
+	ingestStatus.lastSeen = seq
+	ingestStatus.cursor = cursor
+	ingestStatus.Unlock()
+}
+
+// reportStatus writes the heartbeat and status subtree every interval on its own connection
+func reportStatus(net stellarNetwork, pool *horizonpool.Pool, interval time.Duration) {
+	ingestStatus.Lock()
+	ingestStatus.startedAt = time.Now()
+	ingestStatus.Unlock()
+
+	conn := yottadb.NewConn()
+	hostname, _ := os.Hostname()
+	ver := buildVersion()
+	for {
+		writeStatus(conn, net, pool.Active(), hostname, ver)
+		time.Sleep(interval)
+	}
+}
+
+func writeStatus(conn *yottadb.Conn, net stellarNetwork, horizonURL, hostname, ver string) {
+	ingestStatus.Lock()
+	startedAt := ingestStatus.startedAt
+	lastSeen, cursor := ingestStatus.lastSeen, ingestStatus.cursor
+	ingestStatus.Unlock()
+
+	streamHealth.Lock()
+	state, since, lastErr := streamHealth.state, streamHealth.since, streamHealth.lastError
+	failures, reconnects := streamHealth.failures, streamHealth.reconnects
+	streamHealth.Unlock()
+
+	pruneHealth.Lock()
+	pruneEnabled, pruneDryRun, prune := pruneHealth.enabled, pruneHealth.dryRun, pruneHealth.last
+	pruneHealth.Unlock()
+
+	now := fmt.Sprintf("%d", time.Now().Unix())
+	errors := map[string]float64{
+		"ledger_fetch":  metricValue(ledgerFetchFailures),
+		"ledger_commit": metricValue(tpCommitFailures.WithLabelValues("ledger")),
+		"hydration":     metricValue(cacheAccountRequests.WithLabelValues("horizon_error")) + metricValue(cacheAccountRequests.WithLabelValues("commit_failed")),
+		"backfill":      metricValue(backfillJobs.WithLabelValues("error")),
+	}
+
+	ok := transaction(context.Background(), conn, "status", func() int {
+		status := conn.Node(gLedger, "status")
+		status.Child("heartbeat").Set(now)
+		status.Child("started_at").Set(startedAt.Unix())
+		status.Child("last_seen").Set(lastSeen)
+		status.Child("last_committed").Set(int64(metricValue(lastCommittedLedger)))
+		status.Child("cursor").Set(cursor)
+		status.Child("horizon_url").Set(horizonURL)
+		status.Child("network").Set(net.name)
+		status.Child("passphrase").Set(net.passphrase)
+		status.Child("version").Set(ver)
+		status.Child("hostname").Set(hostname)
+		status.Child("pid").Set(os.Getpid())
+		for name, count := range errors {
+			status.Child("errors", name).Set(int64(count))
+		}
+		stream := status.Child("stream")
+		if state != "" {
+			stream.Child("state").Set(state)
+			stream.Child("since").Set(since.Unix())
+		}
+		stream.Child("failures").Set(failures)
+		stream.Child("reconnects").Set(reconnects)
+		stream.Child("last_error").Set(lastErr)
+		// Figures are for the last pass; retention is absent while no policy is set
+		retention := status.Child("retention")
+		retention.Kill()
+		if pruneEnabled {
+			retention.Child("dry_run").Set(fmt.Sprintf("%t", pruneDryRun))
+			retention.Child("through").Set(prune.through)
+			if !prune.finished.IsZero() {
+				retention.Child("last_run").Set(prune.finished.Unix())
+			}
+			retention.Child("ledgers").Set(prune.ledgers)
+			retention.Child("transactions").Set(prune.pruned)
+			retention.Child("kept").Set(prune.kept)
+			retention.Child("nodes").Set(prune.nodes)
+			retention.Child("bytes").Set(prune.bytes)
+		}
+		conn.Node(gLedger, "timestamp").Set(now)
+		return yottadb.YDB_OK
+	})
+	if !ok {
+		slog.Error("Failed to write ingestor status")
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lockb0x-llc/pakana-node-0/pkg/horizonpool"
+	"github.com/stellar/go-stellar-sdk/clients/horizonclient"
+	"github.com/stellar/go-stellar-sdk/protocols/horizon"
+	"github.com/stellar/go-stellar-sdk/toid"
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// The ledger stream reconnects in-process when Horizon drops it or a ledger fails to
+// ingest. Each connection, including the first after a restart, resumes from
+// ^Stellar("ingested"), the last committed ledger, so ledgers closed during an outage,
+// while the ingestor was down or after a failed fetch or commit are ingested rather than
+// skipped. Failed attempts back off exponentially with jitter; after
+// STREAM_BREAKER_THRESHOLD consecutive failures the circuit opens and only one probe
+// attempt is made per STREAM_BREAKER_COOLDOWN until a ledger arrives again.
+
+// Stream states, reported in ^Ledger("status", "stream", "state")
+const (
+	streamConnecting = "connecting" // Waiting for the first ledger of a connection
+	streamConnected  = "connected"  // Ledgers are arriving
+	streamBackoff    = "backoff"    // Waiting to retry after a failure
+	streamOpen       = "open"       // Circuit open: Horizon is treated as unavailable
+	streamHalfOpen   = "half_open"  // Probing Horizon after the cooldown
+)
+
+var streamStates = []string{streamConnecting, streamConnected, streamBackoff, streamOpen, streamHalfOpen}
+
+type streamConfig struct {
+	backoffBase      time.Duration
+	backoffMax       time.Duration
+	breakerThreshold int
+	breakerCooldown  time.Duration
+}
+
+var streamHealth struct {
+	sync.Mutex
+	state      string
+	since      time.Time
+	failures   int // Consecutive failed connections
+	reconnects int
+	lastError  string
+}
+
+func loadStreamConfig() streamConfig {
+	cfg := streamConfig{
+		backoffBase:      time.Second,
+		backoffMax:       time.Minute,
+		breakerThreshold: 5,
+		breakerCooldown:  2 * time.Minute,
+	}
+	if v, err := time.ParseDuration(os.Getenv("STREAM_BACKOFF_BASE")); err == nil && v > 0 {
+		cfg.backoffBase = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("STREAM_BACKOFF_MAX")); err == nil && v > 0 {
+		cfg.backoffMax = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("STREAM_BREAKER_THRESHOLD")); err == nil && v > 0 {
+		cfg.breakerThreshold = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("STREAM_BREAKER_COOLDOWN")); err == nil && v > 0 {
+		cfg.breakerCooldown = v
+	}
+	return cfg
+}
+
+// backoffDelay doubles from backoffBase per failed attempt up to backoffMax, then picks
+// uniformly from the upper half so reconnecting nodes don't retry in lockstep
+func (cfg streamConfig) backoffDelay(attempt int) time.Duration {
+	d := cfg.backoffMax
+	if attempt < 32 {
+		if exp := cfg.backoffBase << attempt; exp > 0 && exp < d {
+			d = exp
+		}
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// setStreamState records the stream's state for the status subtree and metrics
+func setStreamState(state string, failures int, err error) {
+	streamHealth.Lock()
+	defer streamHealth.Unlock()
+	if state != streamHealth.state {
+		streamHealth.state = state
+		streamHealth.since = time.Now()
+	}
+	streamHealth.failures = failures
+	if err != nil {
+		streamHealth.lastError = err.Error()
+	}
+	for _, s := range streamStates {
+		v := 0.0
+		if s == state {
+			v = 1
+		}
+		streamState.WithLabelValues(s).Set(v)
+	}
+	streamFailures.Set(float64(failures))
+}
+
+// committedCursor resumes after ^Stellar("ingested"), which only the ingestor's ledger
+// transaction moves. ^Stellar("latest") is no use here: api-report hydration moves it to
+// any ledger it fetches, ahead of ledgers the stream has yet to write.
+func committedCursor(conn *yottadb.Conn) string {
+	return resumeCursor(conn.Node(gStellar, "ingested").Get(""), conn.Node(gStellar, "latest").Get(""))
+}
+
+// resumeCursor is the cursor after the ingested ledger. A database written before
+// "ingested" existed falls back to latest until its first ledger commits.
+func resumeCursor(ingested, latest string) string {
+	seq, err := strconv.ParseInt(ingested, 10, 32)
+	if err != nil {
+		seq, _ = strconv.ParseInt(latest, 10, 32)
+	}
+	return ledgerCursor(int32(seq))
+}
+
+// ledgerCursor is the paging token just after ledger seq, or "now" before any commit
+func ledgerCursor(seq int32) string {
+	if seq > 0 {
+		return toid.New(seq, 0, 0).String()
+	}
+	return "now"
+}
+
+// streamLedgers passes ledgers to handler until ctx is cancelled, reconnecting with
+// backoff whenever the stream fails or handler returns an error, and straight away when
+// the pool fails over. Each connection starts at the cursor resume returns; it runs on
+// the stream's goroutine, like handler.
+func streamLedgers(ctx context.Context, pool *horizonpool.Pool, client *horizonclient.Client, resume func() string, handler func(horizon.Ledger) error) {
+	cfg := loadStreamConfig()
+	failures := 0
+	for ctx.Err() == nil {
+		state := streamConnecting
+		if failures >= cfg.breakerThreshold {
+			state = streamHalfOpen
+		}
+		cursor := resume()
+		setStreamState(state, failures, nil)
+		slog.Info("Connecting to Horizon ledger stream", "cursor", cursor, "state", state, "horizon_url", pool.Active())
+
+		// A failover ends this connection so the stream follows the active endpoint
+		connCtx, cancel := context.WithCancel(ctx)
+		switched := pool.Switched()
+		go func() {
+			select {
+			case <-switched:
+				cancel()
+			case <-connCtx.Done():
+			}
+		}()
+
+		// A ledger that fails to ingest ends the connection; ledgers already read after it
+		// are dropped and streamed again from the resume cursor
+		delivered := false
+		var handlerErr error
+		err := client.StreamLedgers(connCtx, horizonclient.LedgerRequest{Cursor: cursor}, func(ledger horizon.Ledger) {
+			if handlerErr != nil {
+				return
+			}
+			if handlerErr = handler(ledger); handlerErr != nil {
+				cancel()
+				return
+			}
+			if !delivered {
+				delivered = true
+				failures = 0
+				setStreamState(streamConnected, 0, nil)
+			}
+		})
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-switched:
+			slog.Info("Horizon endpoint changed, reconnecting the ledger stream", "horizon_url", pool.Active())
+			continue
+		default:
+		}
+		switch {
+		case handlerErr != nil:
+			// Not the stream endpoint's fault: a fetch failure already counts against the
+			// upstream that served it, and a commit failure against none
+			err = handlerErr
+		case err == nil:
+			err = errors.New("stream ended")
+			pool.StreamFailed(err)
+		default:
+			pool.StreamFailed(err)
+		}
+
+		failures++
+		streamReconnects.Inc()
+		streamHealth.Lock()
+		streamHealth.reconnects++
+		streamHealth.Unlock()
+
+		wait, next := cfg.backoffDelay(failures-1), streamBackoff
+		if failures >= cfg.breakerThreshold {
+			wait, next = cfg.breakerCooldown, streamOpen
+		}
+		setStreamState(next, failures, err)
+		slog.Warn("Horizon ledger stream failed", "error", err, "failures", failures,
+			"state", next, "retry_in", wait.Round(time.Millisecond).String())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lockb0x-llc/pakana-node-0/api-go/internal/mockhorizon"
+	"github.com/lockb0x-llc/pakana-node-0/pkg/horizonpool"
+	"github.com/stellar/go-stellar-sdk/clients/horizonclient"
+	"github.com/stellar/go-stellar-sdk/protocols/horizon"
+)
+
+// serveMock serves h on addr until the returned server is closed, and returns the
+// address it listens on
+func serveMock(t *testing.T, addr string, h http.Handler) (*http.Server, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("listen on %s: %v", addr, err)
+	}
+	srv := &http.Server{Handler: h}
+	go srv.Serve(ln)
+	return srv, ln.Addr().String()
+}
+
+// waitFor polls cond until it holds or the deadline passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// startStream runs the stream as the ingestor does and returns a function that stops it
+func startStream(pool *horizonpool.Pool, client *horizonclient.Client, resume func() string, handler func(horizon.Ledger) error) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		streamLedgers(ctx, pool, client, resume, handler)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// newMockStream serves a fast mock Horizon and returns its config, server and a client
+// going through a pool, with stream backoff short enough for tests
+func newMockStream(t *testing.T) (mockhorizon.Config, *http.Server, string, *horizonpool.Pool, *horizonclient.Client) {
+	t.Setenv("STREAM_BACKOFF_BASE", "10ms")
+	t.Setenv("STREAM_BACKOFF_MAX", "50ms")
+	t.Setenv("STREAM_BREAKER_COOLDOWN", "50ms")
+	t.Setenv("HORIZON_PROBE_INTERVAL", "1h")
+
+	cfg := mockhorizon.Config{
+		Epoch:      time.Now().Add(-time.Second),
+		Close:      20 * time.Millisecond,
+		Passphrase: "Test SDF Network ; September 2015",
+	}
+	srv, addr := serveMock(t, "127.0.0.1:0", mockhorizon.Handler(cfg))
+	url := "http://" + addr
+	pool, err := horizonpool.New([]string{url}, cfg.Passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg, srv, addr, pool, &horizonclient.Client{HorizonURL: url, HTTP: pool.Client(0)}
+}
+
+// ledgerLog records the sequences a handler committed, in order
+type ledgerLog struct {
+	mu   sync.Mutex
+	seen []int32
+}
+
+func (l *ledgerLog) add(seq int32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seen = append(l.seen, seq)
+}
+
+func (l *ledgerLog) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.seen)
+}
+
+// checkContiguous fails the test if any sequence was skipped or committed twice
+func (l *ledgerLog) checkContiguous(t *testing.T) {
+	t.Helper()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := 1; i < len(l.seen); i++ {
+		if l.seen[i] != l.seen[i-1]+1 {
+			t.Fatalf("ledger %d followed %d: sequences missing or repeated", l.seen[i], l.seen[i-1])
+		}
+	}
+}
+
+func TestStreamResumesAfterDropAndRestart(t *testing.T) {
+	cfg, srv, addr, pool, client := newMockStream(t)
+
+	// committed stands in for ^Stellar("ingested"): it only moves once a ledger is handled
+	var committed atomic.Int32
+	var log ledgerLog
+	handler := func(ledger horizon.Ledger) error {
+		log.add(ledger.Sequence)
+		committed.Store(ledger.Sequence)
+		return nil
+	}
+	resume := func() string { return ledgerCursor(committed.Load()) }
+
+	stop := startStream(pool, client, resume, handler)
+	waitFor(t, "the first ledgers", func() bool { return log.count() >= 5 })
+
+	// Drop Horizon mid-stream and keep it down while several ledgers close
+	srv.Close()
+	dropped := committed.Load()
+	time.Sleep(10 * cfg.Close)
+	if cfg.LatestLedger() <= dropped+5 {
+		t.Fatalf("only %d ledgers closed during the outage", cfg.LatestLedger()-dropped)
+	}
+	srv, _ = serveMock(t, addr, mockhorizon.Handler(cfg))
+	defer srv.Close()
+
+	target := cfg.LatestLedger() + 3
+	waitFor(t, "the stream to catch up", func() bool { return committed.Load() >= target })
+
+	// Restart the ingestor: a new stream resumes from the committed ledger, not "now"
+	stop()
+	time.Sleep(5 * cfg.Close)
+	stop = startStream(pool, client, resume, handler)
+	defer stop()
+	target = cfg.LatestLedger() + 3
+	waitFor(t, "the restarted stream to catch up", func() bool { return committed.Load() >= target })
+
+	streamHealth.Lock()
+	reconnects := streamHealth.reconnects
+	streamHealth.Unlock()
+	if reconnects == 0 {
+		t.Error("the stream never reconnected")
+	}
+	log.checkContiguous(t)
+}
+
+func TestStreamResumesBehindHydratedLedger(t *testing.T) {
+	cfg, srv, addr, pool, client := newMockStream(t)
+
+	// pointers stands in for ^Stellar: the handler moves "ingested" and, if it is behind,
+	// "latest", as the ledger transaction does; hydration only moves "latest"
+	var mu sync.Mutex
+	pointers := map[string]int32{}
+	setPointer := func(key string, seq int32) {
+		mu.Lock()
+		defer mu.Unlock()
+		pointers[key] = seq
+	}
+	pointer := func(key string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if seq, ok := pointers[key]; ok {
+			return strconv.Itoa(int(seq))
+		}
+		return ""
+	}
+	var log ledgerLog
+	handler := func(ledger horizon.Ledger) error {
+		log.add(ledger.Sequence)
+		mu.Lock()
+		defer mu.Unlock()
+		pointers["ingested"] = ledger.Sequence
+		pointers["latest"] = max(pointers["latest"], ledger.Sequence)
+		return nil
+	}
+	resume := func() string { return resumeCursor(pointer("ingested"), pointer("latest")) }
+
+	stop := startStream(pool, client, resume, handler)
+	waitFor(t, "the first ledgers", func() bool { return log.count() >= 5 })
+
+	// While Horizon is down, api-report hydrates a ledger the stream has not reached
+	srv.Close()
+	time.Sleep(10 * cfg.Close)
+	hydrated := cfg.LatestLedger()
+	setPointer("latest", hydrated)
+	ingested, _ := strconv.Atoi(pointer("ingested"))
+	if int32(ingested) >= hydrated-3 {
+		t.Fatalf("hydrated ledger %d is not ahead of ingested ledger %d", hydrated, ingested)
+	}
+
+	// The reconnect, and a restart after it, carry on from the ingested ledger
+	srv, _ = serveMock(t, addr, mockhorizon.Handler(cfg))
+	defer srv.Close()
+	waitFor(t, "the stream to pass the hydrated ledger", func() bool {
+		seq, _ := strconv.Atoi(pointer("ingested"))
+		return int32(seq) > hydrated
+	})
+	stop()
+	stop = startStream(pool, client, resume, handler)
+	defer stop()
+	target := cfg.LatestLedger() + 3
+	waitFor(t, "the restarted stream to catch up", func() bool {
+		seq, _ := strconv.Atoi(pointer("ingested"))
+		return int32(seq) >= target
+	})
+	log.checkContiguous(t)
+}
+
+func TestStreamRetriesLedgerThatFailedToIngest(t *testing.T) {
+	cfg, _, _, pool, client := newMockStream(t)
+
+	var committed atomic.Int32
+	var log ledgerLog
+	var failAt atomic.Int32
+	attempts := map[int32]int{}
+	handler := func(ledger horizon.Ledger) error {
+		attempts[ledger.Sequence]++
+		if ledger.Sequence == failAt.Load() && attempts[ledger.Sequence] == 1 {
+			return errors.New("transaction fetch failed")
+		}
+		log.add(ledger.Sequence)
+		committed.Store(ledger.Sequence)
+		return nil
+	}
+	resume := func() string { return ledgerCursor(committed.Load()) }
+
+	failAt.Store(cfg.LatestLedger() + 5)
+	stop := startStream(pool, client, resume, handler)
+	defer stop()
+	target := failAt.Load() + 5
+	waitFor(t, "the stream to pass the failed ledger", func() bool { return committed.Load() >= target })
+
+	stop()
+	if n := attempts[failAt.Load()]; n != 2 {
+		t.Errorf("failed ledger handled %d times, want 2", n)
+	}
+	log.checkContiguous(t)
+}
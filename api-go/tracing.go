@@ -0,0 +1,9 @@
+package main
+
+import "go.opentelemetry.io/otel"
+
+// Tracing is set up by pkg/tracing and is a no-op unless an OTLP endpoint is set. Each
+// ledger is a root "ingest ledger" span; /internal/cache-account continues the caller's
+// trace from its traceparent header.
+
+var tracer = otel.Tracer("api-go")
@@ -0,0 +1,129 @@
+// Command loadtest drives concurrent read traffic at api-report and reports throughput
+// and latency percentiles. Mixing in cache misses (-miss) shows how hydration affects
+// the requests that are served locally.
+//
+//	go run ./cmd/loadtest -url http://localhost:8080 -key $API_KEY -c 64 -d 30s -miss 0.05
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	mrand "math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type result struct {
+	latency time.Duration
+	status  int
+	miss    bool
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "api-report base URL")
+	apiKey := flag.String("key", os.Getenv("API_KEY"), "X-API-Key to send")
+	concurrency := flag.Int("c", 32, "concurrent workers")
+	duration := flag.Duration("d", 20*time.Second, "test duration")
+	paths := flag.String("paths", "/api/v1/ledgers/latest", "comma-separated paths for local (hit) requests")
+	missRatio := flag.Float64("miss", 0, "fraction of requests for random transaction hashes (forces hydration)")
+	flag.Parse()
+
+	hitPaths := strings.Split(*paths, ",")
+	client := &http.Client{Timeout: 60 * time.Second}
+	results := make(chan result, 4096)
+	deadline := time.Now().Add(*duration)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := mrand.New(mrand.NewSource(seed))
+			for time.Now().Before(deadline) {
+				path, miss := hitPaths[rng.Intn(len(hitPaths))], false
+				if rng.Float64() < *missRatio {
+					path, miss = "/api/v1/transactions/"+randomHash(), true
+				}
+				results <- fire(client, *baseURL+path, *apiKey, miss)
+			}
+		}(int64(i))
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var hits, misses []time.Duration
+	statuses := make(map[int]int)
+	for res := range results {
+		statuses[res.status]++
+		if res.miss {
+			misses = append(misses, res.latency)
+		} else {
+			hits = append(hits, res.latency)
+		}
+	}
+
+	total := len(hits) + len(misses)
+	fmt.Printf("Requests:   %d in %s (%d workers)\n", total, *duration, *concurrency)
+	fmt.Printf("Throughput: %.1f req/s\n", float64(total)/duration.Seconds())
+	report("Local hits", hits)
+	report("Hydrations", misses)
+
+	codes := make([]int, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Printf("  HTTP %d: %d\n", code, statuses[code])
+	}
+}
+
+func fire(client *http.Client, url, apiKey string, miss bool) result {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		log.Fatalf("invalid URL %s: %v", url, err)
+	}
+	req.Header.Set("X-API-Key", apiKey)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result{latency: time.Since(start), status: 0, miss: miss}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return result{latency: time.Since(start), status: resp.StatusCode, miss: miss}
+}
+
+func report(label string, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	pct := func(p float64) time.Duration {
+		idx := int(math.Ceil(p*float64(len(latencies)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return latencies[idx]
+	}
+	fmt.Printf("%-11s n=%-7d p50=%-10s p95=%-10s p99=%-10s max=%s\n",
+		label+":", len(latencies), pct(0.50), pct(0.95), pct(0.99), latencies[len(latencies)-1])
+}
+
+func randomHash() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
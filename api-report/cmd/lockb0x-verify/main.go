@@ -0,0 +1,186 @@
+// Command lockb0x-verify checks a signed Lockb0x Codex export without trusting the node
+// that produced it. Offline it verifies the ed25519 signature, that the anchoring
+// envelope hashes to its transaction hash and commits to the pointer hash, and
+// (with -doc) that the document hashes to the pointer hash. Every party attestation
+// carried by the export must be validly signed; -roles names roles that must have
+// attested to the current version. With -horizon it also confirms the transaction and
+// ledger against an independent Horizon.
+//
+//	go run ./cmd/lockb0x-verify -key G... -doc contract.pdf -roles owner,notary -horizon https://horizon.stellar.org export.json
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"api-report/codex"
+
+	"github.com/stellar/go-stellar-sdk/clients/horizonclient"
+)
+
+func main() {
+	key := flag.String("key", "", "expected signer (G... address); without it any valid signature is accepted")
+	docPath := flag.String("doc", "", "document whose SHA-256 must equal the pointer hash")
+	horizonURL := flag.String("horizon", "", "Horizon URL to confirm ledger inclusion against")
+	roles := flag.String("roles", "", "comma-separated roles that must have attested to the current version")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: lockb0x-verify [flags] <export.json | ->\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	doc, err := readExport(flag.Arg(0))
+	if err != nil {
+		fail("reading export: %v", err)
+	}
+	entry := doc.Entry
+
+	if err := codex.VerifySignature(doc, *key); err != nil {
+		fail("signature: %v", err)
+	}
+	if *key == "" {
+		fmt.Printf("WARN  signer %s not pinned (use -key)\n", doc.Signature.PublicKey)
+	}
+	pass("signature by %s", doc.Signature.PublicKey)
+
+	if *docPath != "" {
+		sum, err := hashFile(*docPath)
+		if err != nil {
+			fail("document: %v", err)
+		}
+		if sum != entry.PointerHash {
+			fail("document SHA-256 %s does not match pointer hash %s", sum, entry.PointerHash)
+		}
+		pass("document matches pointer hash %s", entry.PointerHash)
+	}
+
+	checkAttestations(entry, *roles)
+
+	if entry.Anchor == nil {
+		fmt.Printf("WARN  entry is not anchored (status %q)\n", entry.Status)
+		return
+	}
+	if err := codex.VerifyAnchor(entry); err != nil {
+		fail("anchor: %v", err)
+	}
+	pass("transaction %s commits to the pointer hash (%s)", entry.Anchor.TxHash, entry.Anchor.Commitment)
+
+	if *horizonURL == "" {
+		fmt.Printf("WARN  ledger %d inclusion not checked (use -horizon)\n", entry.Anchor.Ledger)
+		return
+	}
+	if err := checkHorizon(*horizonURL, entry.Anchor); err != nil {
+		fail("horizon: %v", err)
+	}
+	pass("included in ledger %d (%s) closed at %s", entry.Anchor.Ledger, entry.Anchor.LedgerHash, entry.Anchor.LedgerClosedAt)
+}
+
+// checkAttestations verifies every attestation and that each required role attested to
+// the entry as exported
+func checkAttestations(entry codex.Entry, roles string) {
+	attested := map[string]bool{}
+	for _, a := range entry.Attestations {
+		role := a.Statement.Role
+		if err := codex.VerifyAttestation(a); err != nil {
+			fail("attestation by %s (%s): %v", a.Signature.PublicKey, role, err)
+		}
+		if a.Statement.PointerHash != entry.PointerHash {
+			fail("attestation by %s (%s) is for pointer hash %s", a.Signature.PublicKey, role, a.Statement.PointerHash)
+		}
+		if a.Statement != codex.StatementFor(entry, role) {
+			fmt.Printf("WARN  attestation by %s (%s) covers record version %d, not the exported version\n", a.Signature.PublicKey, role, a.Statement.RecordVersion)
+			continue
+		}
+		attested[role] = true
+		pass("attestation by %s as %s", a.Signature.PublicKey, role)
+	}
+
+	if roles == "" {
+		return
+	}
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.TrimSpace(role); role != "" && !attested[role] {
+			fail("no current attestation in role %s", role)
+		}
+	}
+}
+
+func readExport(path string) (*codex.SignedEntry, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var doc codex.SignedEntry
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkHorizon confirms the transaction succeeded in the claimed ledger and that the
+// ledger hash and close time match
+func checkHorizon(url string, a *codex.Anchor) error {
+	client := &horizonclient.Client{HorizonURL: url, HTTP: &http.Client{Timeout: 30 * time.Second}}
+
+	tx, err := client.TransactionDetail(a.TxHash)
+	if err != nil {
+		return fmt.Errorf("transaction %s: %v", a.TxHash, err)
+	}
+	if !tx.Successful {
+		return fmt.Errorf("transaction %s failed on-chain", a.TxHash)
+	}
+	if int64(tx.Ledger) != a.Ledger {
+		return fmt.Errorf("transaction is in ledger %d, export claims %d", tx.Ledger, a.Ledger)
+	}
+
+	ledger, err := client.LedgerDetail(uint32(a.Ledger))
+	if err != nil {
+		return fmt.Errorf("ledger %d: %v", a.Ledger, err)
+	}
+	if ledger.Hash != a.LedgerHash {
+		return fmt.Errorf("ledger hash is %s, export claims %s", ledger.Hash, a.LedgerHash)
+	}
+	if claimed, err := time.Parse(time.RFC3339, a.LedgerClosedAt); err != nil || !claimed.Equal(ledger.ClosedAt) {
+		return fmt.Errorf("ledger closed at %s, export claims %s", ledger.ClosedAt.UTC().Format(time.RFC3339), a.LedgerClosedAt)
+	}
+	return nil
+}
+
+func pass(format string, args ...interface{}) {
+	fmt.Printf("OK    "+format+"\n", args...)
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Printf("FAIL  "+format+"\n", args...)
+	os.Exit(1)
+}
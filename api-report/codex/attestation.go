@@ -0,0 +1,62 @@
+package codex
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/stellar/go-stellar-sdk/keypair"
+)
+
+// Statement is what a party attests to: an entry's content at one record version, in
+// one role. Status and anchor are left out, so attestations survive anchoring; a
+// correction bumps RecordVersion, leaving older attestations valid but stale.
+type Statement struct {
+	Version       int    `json:"version"`
+	PointerHash   string `json:"pointer_hash"`
+	Location      string `json:"location"`
+	Description   string `json:"description"`
+	Provider      string `json:"provider"`
+	CreatedAt     int64  `json:"created_at"`
+	RecordVersion int    `json:"record_version"`
+	Role          string `json:"role"` // e.g. owner, custodian, notary
+}
+
+// Attestation is one party's ed25519 signature over the canonical JSON of a Statement
+type Attestation struct {
+	Statement Statement `json:"statement"`
+	Signature Signature `json:"signature"`
+	SignedAt  int64     `json:"signed_at"`
+}
+
+// StatementFor returns the statement a party in role signs for entry
+func StatementFor(entry Entry, role string) Statement {
+	return Statement{
+		Version:       FormatVersion,
+		PointerHash:   entry.PointerHash,
+		Location:      entry.Location,
+		Description:   entry.Description,
+		Provider:      entry.Provider,
+		CreatedAt:     entry.CreatedAt,
+		RecordVersion: entry.RecordVersion,
+		Role:          role,
+	}
+}
+
+// VerifyAttestation checks that the attestation is signed by its public key
+func VerifyAttestation(a Attestation) error {
+	if a.Signature.Algorithm != "ed25519" {
+		return fmt.Errorf("unsupported signature algorithm %q", a.Signature.Algorithm)
+	}
+	kp, err := keypair.ParseAddress(a.Signature.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(a.Signature.Value)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if err := verifyCanonical(kp, a.Statement, sig); err != nil {
+		return fmt.Errorf("signature does not match statement")
+	}
+	return nil
+}
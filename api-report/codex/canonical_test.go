@@ -0,0 +1,95 @@
+package codex
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stellar/go-stellar-sdk/keypair"
+)
+
+func canonicalString(t *testing.T, input string) string {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(input), &v); err != nil {
+		t.Fatalf("bad input %s: %v", input, err)
+	}
+	out, err := Canonical(v)
+	if err != nil {
+		t.Fatalf("Canonical(%s): %v", input, err)
+	}
+	return string(out)
+}
+
+func TestCanonicalVectors(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{
+			name:  "html characters are not escaped",
+			input: `{"description":"Tom & Jerry <draft>","a":1}`,
+			want:  `{"a":1,"description":"Tom & Jerry <draft>"}`,
+		},
+		{
+			name:  "line and paragraph separators are literal",
+			input: `{"s":"a\u2028b\u2029c"}`,
+			want:  "{\"s\":\"a\u2028b\u2029c\"}",
+		},
+		{
+			// RFC 8785 section 3.2.2
+			name:  "rfc 8785 sample",
+			input: `{"numbers":[333333333.33333329,1E30,4.50,2e-3,0.000000000000000000000000001],"string":"\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/","literals":[null,true,false]}`,
+			want:  `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			// RFC 8785 section 3.2.3: members sort by UTF-16 code units
+			name:  "rfc 8785 sorting",
+			input: `{"\u20ac":"Euro Sign","\r":"Carriage Return","\ufb33":"Hebrew Letter Dalet With Dagesh","1":"One","\ud83d\ude00":"Emoji: Grinning Face","\u0080":"Control","\u00f6":"Latin Small Letter O With Diaeresis"}`,
+			want:  "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\",\"\u20ac\":\"Euro Sign\",\"\U0001F600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{
+			name:  "number notation",
+			input: `[1e20,1e21,0.000001,1e-7,-0,-1.5,1700000000]`,
+			want:  `[100000000000000000000,1e+21,0.000001,1e-7,0,-1.5,1700000000]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canonicalString(t, tt.input); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedEntryWithAmpersand(t *testing.T) {
+	kp := keypair.MustRandom()
+	entry := Entry{
+		Version:     FormatVersion,
+		PointerHash: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		Location:    "https://example.com/a?x=1&y=2",
+		Description: "Terms & Conditions <v2>",
+		Provider:    "https",
+		Status:      "anchored",
+		CreatedAt:   1700000000,
+	}
+
+	doc, err := Sign(entry, kp)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	payload, _ := Canonical(entry)
+	want := `{"created_at":1700000000,"description":"Terms & Conditions <v2>","exported_at":0,` +
+		`"location":"https://example.com/a?x=1&y=2","pointer_hash":"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",` +
+		`"provider":"https","status":"anchored","version":1}`
+	if string(payload) != want {
+		t.Errorf("canonical entry\ngot  %s\nwant %s", payload, want)
+	}
+	if err := VerifySignature(doc, kp.Address()); err != nil {
+		t.Errorf("VerifySignature: %v", err)
+	}
+
+	doc.Entry.Description = "Terms & Conditions <v3>"
+	if err := VerifySignature(doc, ""); err == nil {
+		t.Error("VerifySignature accepted a modified entry")
+	}
+}
@@ -0,0 +1,195 @@
+// Package codex defines the portable, signed export format for Lockb0x Codex entries.
+// It has no YottaDB dependency so entries can be verified offline (see cmd/lockb0x-verify).
+package codex
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/stellar/go-stellar-sdk/keypair"
+	"github.com/stellar/go-stellar-sdk/txnbuild"
+)
+
+// FormatVersion is bumped on any change to the Entry layout
+const FormatVersion = 1
+
+// Ways a pointer hash can be committed on-chain
+const (
+	CommitmentMemoHash   = "memo_hash"
+	CommitmentManageData = "manage_data"
+)
+
+// CommitmentRevocation marks a transaction revoking a previously anchored pointer hash
+const CommitmentRevocation = "revocation"
+
+// manageData entry names used by manage_data commitments and by revocations
+const (
+	AnchorDataName     = "lockb0x"
+	RevocationDataName = "lockb0x_revoke"
+)
+
+// Entry is the exported form of a ^Codex record
+type Entry struct {
+	Version     int         `json:"version"`
+	PointerHash string      `json:"pointer_hash"`
+	Location    string      `json:"location"`
+	Description string      `json:"description"`
+	Provider    string      `json:"provider"`
+	Status      string      `json:"status"`
+	CreatedAt   int64       `json:"created_at"`
+	ExportedAt  int64       `json:"exported_at"`
+	Batch       *BatchProof `json:"batch,omitempty"`
+	Anchor      *Anchor     `json:"anchor,omitempty"`
+
+	RecordVersion int           `json:"record_version,omitempty"` // Bumped by each correction
+	Attestations  []Attestation `json:"attestations,omitempty"`
+}
+
+// Anchor is the on-chain proof for an entry: the envelope hashes to TxHash under
+// NetworkPassphrase, commits to the pointer hash, and was included in Ledger
+type Anchor struct {
+	TxHash            string `json:"tx_hash"`
+	Commitment        string `json:"commitment"`
+	EnvelopeXDR       string `json:"envelope_xdr"`
+	NetworkPassphrase string `json:"network_passphrase"`
+	Ledger            int64  `json:"ledger"`
+	LedgerHash        string `json:"ledger_hash"`
+	LedgerClosedAt    string `json:"ledger_closed_at"` // RFC 3339, UTC
+}
+
+// Signature is an ed25519 signature over the canonical JSON of an Entry
+type Signature struct {
+	Algorithm string `json:"algorithm"`  // Always "ed25519"
+	PublicKey string `json:"public_key"` // Stellar G... address
+	Value     string `json:"value"`      // Base64
+}
+
+// SignedEntry is the exported document
+type SignedEntry struct {
+	Entry     Entry     `json:"entry"`
+	Signature Signature `json:"signature"`
+}
+
+// Sign canonicalises entry and signs it with kp
+func Sign(entry Entry, kp *keypair.Full) (*SignedEntry, error) {
+	payload, err := Canonical(entry)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := kp.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedEntry{
+		Entry: entry,
+		Signature: Signature{
+			Algorithm: "ed25519",
+			PublicKey: kp.Address(),
+			Value:     base64.StdEncoding.EncodeToString(sig),
+		},
+	}, nil
+}
+
+// VerifySignature checks the document's signature. If expectedKey is set the document
+// must also be signed by that key.
+func VerifySignature(doc *SignedEntry, expectedKey string) error {
+	if doc.Signature.Algorithm != "ed25519" {
+		return fmt.Errorf("unsupported signature algorithm %q", doc.Signature.Algorithm)
+	}
+	if expectedKey != "" && doc.Signature.PublicKey != expectedKey {
+		return fmt.Errorf("signed by %s, expected %s", doc.Signature.PublicKey, expectedKey)
+	}
+	kp, err := keypair.ParseAddress(doc.Signature.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(doc.Signature.Value)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if err := verifyCanonical(kp, doc.Entry, sig); err != nil {
+		return fmt.Errorf("signature does not match entry")
+	}
+	return nil
+}
+
+// VerifyAnchor checks that the anchor's envelope is the transaction it claims to be and
+// commits to the entry's pointer hash, or to the Merkle root the entry was batched
+// under. Ledger inclusion needs a Horizon lookup.
+func VerifyAnchor(entry Entry) error {
+	if entry.Anchor == nil {
+		return fmt.Errorf("entry has no anchor")
+	}
+	a := entry.Anchor
+
+	committed := entry.PointerHash
+	if entry.Batch != nil {
+		if !VerifyMerkleProof(entry.PointerHash, entry.Batch.Proof, entry.Batch.Root) {
+			return fmt.Errorf("pointer hash is not included in batch root %s", entry.Batch.Root)
+		}
+		committed = entry.Batch.Root
+	}
+
+	parsed, err := txnbuild.TransactionFromXDR(a.EnvelopeXDR)
+	if err != nil {
+		return fmt.Errorf("invalid envelope: %w", err)
+	}
+	txHash, err := parsed.HashHex(a.NetworkPassphrase)
+	if err != nil {
+		return err
+	}
+	if txHash != a.TxHash {
+		return fmt.Errorf("envelope hashes to %s, not %s", txHash, a.TxHash)
+	}
+
+	tx, ok := parsed.Transaction()
+	if !ok {
+		feeBump, ok := parsed.FeeBump()
+		if !ok {
+			return fmt.Errorf("invalid envelope")
+		}
+		tx = feeBump.InnerTransaction()
+	}
+	commitment := Commitment(tx, committed)
+	if commitment == "" {
+		return fmt.Errorf("transaction does not commit to %s", committed)
+	}
+	if commitment != a.Commitment {
+		return fmt.Errorf("transaction commits via %s, not %s", commitment, a.Commitment)
+	}
+	return nil
+}
+
+// Commitment returns how tx commits to hash (CommitmentMemoHash or
+// CommitmentManageData), or "" if it does not
+func Commitment(tx *txnbuild.Transaction, hash string) string {
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return ""
+	}
+	if memo, ok := tx.Memo().(txnbuild.MemoHash); ok && bytes.Equal(memo[:], raw) {
+		return CommitmentMemoHash
+	}
+	for _, op := range tx.Operations() {
+		if data, ok := op.(*txnbuild.ManageData); ok && data.Name == AnchorDataName && bytes.Equal(data.Value, raw) {
+			return CommitmentManageData
+		}
+	}
+	return ""
+}
+
+// Revokes reports whether tx carries a lockb0x_revoke manageData entry for hash
+func Revokes(tx *txnbuild.Transaction, hash string) bool {
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return false
+	}
+	for _, op := range tx.Operations() {
+		if data, ok := op.(*txnbuild.ManageData); ok && data.Name == RevocationDataName && bytes.Equal(data.Value, raw) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package codex
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Merkle trees over pointer hashes. Leaves and interior nodes are domain-separated
+// (0x00 / 0x01 prefixes) so a leaf can never be passed off as an interior node. An
+// odd node at the end of a level is carried up unchanged.
+
+// ProofStep is one sibling on the path from a leaf to the root
+type ProofStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"` // Sibling is on the left
+}
+
+// BatchProof places an entry's pointer hash under an anchored Merkle root
+type BatchProof struct {
+	ID    int64       `json:"id"`
+	Root  string      `json:"root"`
+	Proof []ProofStep `json:"proof"`
+}
+
+func leafHash(pointerHash []byte) []byte {
+	sum := sha256.Sum256(append([]byte{0x00}, pointerHash...))
+	return sum[:]
+}
+
+func nodeHash(left, right []byte) []byte {
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, 0x01)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+	sum := sha256.Sum256(buf)
+	return sum[:]
+}
+
+// MerkleTree returns the root of the tree over the hex pointer hashes and the inclusion
+// proof for each of them, in order
+func MerkleTree(pointerHashes []string) (string, [][]ProofStep, error) {
+	if len(pointerHashes) == 0 {
+		return "", nil, fmt.Errorf("no leaves")
+	}
+
+	level := make([][]byte, len(pointerHashes))
+	for i, h := range pointerHashes {
+		raw, err := hex.DecodeString(h)
+		if err != nil {
+			return "", nil, fmt.Errorf("leaf %d: %w", i, err)
+		}
+		level[i] = leafHash(raw)
+	}
+
+	proofs := make([][]ProofStep, len(pointerHashes))
+	// position[i] is the index of leaf i's ancestor in the current level
+	position := make([]int, len(pointerHashes))
+	for i := range position {
+		position[i] = i
+	}
+
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, nodeHash(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+
+		for leaf, pos := range position {
+			sibling := pos ^ 1
+			if sibling < len(level) {
+				proofs[leaf] = append(proofs[leaf], ProofStep{
+					Hash: hex.EncodeToString(level[sibling]),
+					Left: sibling < pos,
+				})
+			}
+			position[leaf] = pos / 2
+		}
+		level = next
+	}
+
+	return hex.EncodeToString(level[0]), proofs, nil
+}
+
+// VerifyMerkleProof reports whether proof places pointerHash under root
+func VerifyMerkleProof(pointerHash string, proof []ProofStep, root string) bool {
+	raw, err := hex.DecodeString(pointerHash)
+	if err != nil {
+		return false
+	}
+	want, err := hex.DecodeString(root)
+	if err != nil {
+		return false
+	}
+
+	current := leafHash(raw)
+	for _, step := range proof {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return false
+		}
+		if step.Left {
+			current = nodeHash(sibling, current)
+		} else {
+			current = nodeHash(current, sibling)
+		}
+	}
+	return bytes.Equal(current, want)
+}
@@ -0,0 +1,97 @@
+package codex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// testLeaves are n distinct pointer hashes
+func testLeaves(n int) []string {
+	leaves := make([]string, n)
+	for i := range leaves {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("document %d", i)))
+		leaves[i] = hex.EncodeToString(sum[:])
+	}
+	return leaves
+}
+
+// flipHex changes the last hex digit of h
+func flipHex(h string) string {
+	last := byte('0')
+	if h[len(h)-1] == '0' {
+		last = '1'
+	}
+	return h[:len(h)-1] + string(last)
+}
+
+func TestMerkleProofs(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 5, 8} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			leaves := testLeaves(n)
+			root, proofs, err := MerkleTree(leaves)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(proofs) != n {
+				t.Fatalf("%d proofs for %d leaves", len(proofs), n)
+			}
+
+			for i, leaf := range leaves {
+				proof := proofs[i]
+				if !VerifyMerkleProof(leaf, proof, root) {
+					t.Errorf("leaf %d: proof does not verify", i)
+				}
+				if VerifyMerkleProof(flipHex(leaf), proof, root) {
+					t.Errorf("leaf %d: tampered leaf verifies", i)
+				}
+				if n > 1 && VerifyMerkleProof(leaves[(i+1)%n], proof, root) {
+					t.Errorf("leaf %d: proof verifies leaf %d", i, (i+1)%n)
+				}
+				for s := range proof {
+					tampered := append([]ProofStep(nil), proof...)
+					tampered[s].Hash = flipHex(tampered[s].Hash)
+					if VerifyMerkleProof(leaf, tampered, root) {
+						t.Errorf("leaf %d: tampered sibling %d verifies", i, s)
+					}
+					tampered[s] = proof[s]
+					tampered[s].Left = !tampered[s].Left
+					if VerifyMerkleProof(leaf, tampered, root) {
+						t.Errorf("leaf %d: sibling %d on the wrong side verifies", i, s)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMerkleRootLayout(t *testing.T) {
+	leaves := testLeaves(3)
+	l := make([][]byte, len(leaves))
+	for i, h := range leaves {
+		raw, _ := hex.DecodeString(h)
+		l[i] = leafHash(raw)
+	}
+
+	// The odd third leaf is carried up unchanged and paired at the next level
+	want := hex.EncodeToString(nodeHash(nodeHash(l[0], l[1]), l[2]))
+	root, proofs, err := MerkleTree(leaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != want {
+		t.Errorf("root = %s, want %s", root, want)
+	}
+	if len(proofs[2]) != 1 || !proofs[2][0].Left {
+		t.Errorf("proof for the carried leaf = %+v, want one left sibling", proofs[2])
+	}
+
+	single, _, _ := MerkleTree(leaves[:1])
+	if single != hex.EncodeToString(l[0]) {
+		t.Errorf("single-leaf root = %s, want the leaf hash", single)
+	}
+	if _, _, err := MerkleTree(nil); err == nil {
+		t.Error("MerkleTree accepted no leaves")
+	}
+}
@@ -0,0 +1,502 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-report/codex"
+
+	"github.com/lockb0x-llc/pakana-node-0/pkg/logging"
+	"github.com/lockb0x-llc/pakana-node-0/pkg/tracing"
+	"github.com/stellar/go-stellar-sdk/clients/horizonclient"
+	"github.com/stellar/go-stellar-sdk/keypair"
+	"github.com/stellar/go-stellar-sdk/network"
+	"github.com/stellar/go-stellar-sdk/protocols/horizon"
+	"github.com/stellar/go-stellar-sdk/txnbuild"
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// Ways a Lockb0x pointer hash can be committed on-chain
+const (
+	AnchorModeMemoHash   = codex.CommitmentMemoHash
+	AnchorModeManageData = codex.CommitmentManageData
+)
+
+// Lockb0x draft lifecycle. core-rust moves a record to anchored (at ^Codex(hash)) when
+// the ingestor sees the transaction land. Batched drafts go queued → batched → anchored
+// as their Merkle root is anchored.
+const (
+	Lockb0xPendingTx = "pending_tx"
+	Lockb0xSubmitted = "submitted"
+	Lockb0xAnchored  = "anchored"
+	Lockb0xFailed    = "failed"
+	Lockb0xQueued    = "queued"
+	Lockb0xBatched   = "batched"
+	Lockb0xRevoked   = "revoked"
+)
+
+// Anchoring configuration set by InitLockb0xAnchoring
+var (
+	anchorAccount     string
+	anchorMode        = AnchorModeMemoHash
+	anchorTimeout     = 15 * time.Minute
+	networkPassphrase = network.TestNetworkPassphrase
+)
+
+type AnchorSubmitRequest struct {
+	XDR string `json:"xdr"` // Signed TransactionEnvelope (base64)
+}
+
+type AnchorTransactionRequest struct {
+	Mode string `json:"mode"` // memo_hash (default) or manage_data
+}
+
+// AnchorTransactionResponse carries an unsigned envelope for external signing
+type AnchorTransactionResponse struct {
+	Hash              string `json:"hash"`
+	XDR               string `json:"xdr"`
+	TxHash            string `json:"tx_hash"`
+	SourceAccount     string `json:"source_account"`
+	Sequence          int64  `json:"sequence"`
+	Mode              string `json:"mode"`
+	NetworkPassphrase string `json:"network_passphrase"`
+	ValidUntil        int64  `json:"valid_until"`
+}
+
+// InitLockb0xAnchoring reads the anchoring account from the environment. Records are
+// anchored on LOCKB0X_NETWORK, resolved by InitNetworks.
+func InitLockb0xAnchoring() {
+	networkPassphrase = lockb0xNetwork.passphrase
+	if mode := os.Getenv("LOCKB0X_ANCHOR_MODE"); mode != "" {
+		if mode != AnchorModeMemoHash && mode != AnchorModeManageData {
+			logging.Fatal("LOCKB0X_ANCHOR_MODE must be "+AnchorModeMemoHash+" or "+AnchorModeManageData, "mode", mode)
+		}
+		anchorMode = mode
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("LOCKB0X_TX_TIMEOUT")); err == nil && timeout > 0 {
+		anchorTimeout = timeout
+	}
+
+	anchorAccount = os.Getenv("LOCKB0X_ANCHOR_ACCOUNT")
+	if anchorAccount == "" {
+		slog.Info("LOCKB0X_ANCHOR_ACCOUNT not set, anchoring transactions disabled")
+		return
+	}
+	if _, err := keypair.ParseAddress(anchorAccount); err != nil {
+		logging.Fatal("Invalid LOCKB0X_ANCHOR_ACCOUNT", "error", err)
+	}
+	slog.Info("Lockb0x anchoring enabled", "account", anchorAccount, "mode", anchorMode)
+}
+
+// BuildLockb0xTransaction returns an unsigned envelope committing the draft's pointer
+// hash from the anchoring account. Signing happens off-node.
+func BuildLockb0xTransaction(w http.ResponseWriter, r *http.Request) {
+	hash := getPathVar(r, "hash")
+	if !isPointerHash(hash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+	if anchorAccount == "" {
+		sendError(w, "Anchoring account not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req AnchorTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	mode := req.Mode
+	if mode == "" {
+		mode = anchorMode
+	}
+	if mode != AnchorModeMemoHash && mode != AnchorModeManageData {
+		sendError(w, "mode must be memo_hash or manage_data", http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	draftNode := conn.Node("^Codex", "draft", hash)
+	if !draftNode.HasTree() {
+		if conn.Node("^Codex", hash).HasTree() {
+			sendError(w, "Lockb0x record is already anchored", http.StatusConflict)
+			return
+		}
+		sendError(w, "Lockb0x draft not found", http.StatusNotFound)
+		return
+	}
+	switch draftNode.Child("status").Get("") {
+	case Lockb0xSubmitted:
+		sendError(w, "Anchoring transaction already submitted", http.StatusConflict)
+		return
+	case Lockb0xQueued, Lockb0xBatched:
+		sendError(w, "Draft is anchored through a batch; anchor its batch root instead", http.StatusConflict)
+		return
+	case Lockb0xRevoked:
+		sendError(w, "Draft is revoked", http.StatusConflict)
+		return
+	}
+
+	sequence, ok := anchorSequence(w, r, conn)
+	if !ok {
+		return
+	}
+	resp, ok := buildAnchorResponse(w, hash, mode, sequence)
+	if !ok {
+		return
+	}
+
+	draftNode.Child("anchor_account").Set(anchorAccount)
+	draftNode.Child("anchor_mode").Set(mode)
+
+	sendJSON(w, resp)
+}
+
+// anchorSequence reads the anchoring account's current sequence from ^Account,
+// hydrating (and so tracking) the account on first use
+func anchorSequence(w http.ResponseWriter, r *http.Request, conn *yottadb.Conn) (int64, bool) {
+	seqNode := conn.Node(lockb0xNetwork.account, anchorAccount, "seq_num")
+	if !seqNode.HasValue() {
+		if !allowHydration(w, r) {
+			return 0, false
+		}
+		if err := hydrateAccount(withNetwork(r.Context(), lockb0xNetwork), anchorAccount); err != nil {
+			requestLogger(r).Error("Failed to hydrate anchoring account", "account", anchorAccount, "error", err)
+			sendError(w, "Anchoring account not found", http.StatusBadGateway)
+			return 0, false
+		}
+	}
+	sequence, err := strconv.ParseInt(seqNode.Get("0"), 10, 64)
+	if err != nil {
+		sendError(w, "Invalid sequence number for anchoring account", http.StatusInternalServerError)
+		return 0, false
+	}
+	return sequence, true
+}
+
+// buildAnchorResponse builds and encodes the unsigned transaction for hash
+func buildAnchorResponse(w http.ResponseWriter, hash, mode string, sequence int64) (*AnchorTransactionResponse, bool) {
+	tx, err := buildAnchorTransaction(hash, mode, sequence)
+	if err != nil {
+		slog.Error("Failed to build anchoring transaction", "mode", mode, "hash", hash, "error", err)
+		sendError(w, "Failed to build transaction", http.StatusInternalServerError)
+		return nil, false
+	}
+	envelope, err := tx.Base64()
+	if err != nil {
+		sendError(w, "Failed to encode transaction", http.StatusInternalServerError)
+		return nil, false
+	}
+	txHash, err := tx.HashHex(networkPassphrase)
+	if err != nil {
+		sendError(w, "Failed to hash transaction", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return &AnchorTransactionResponse{
+		Hash:              hash,
+		XDR:               envelope,
+		TxHash:            txHash,
+		SourceAccount:     anchorAccount,
+		Sequence:          tx.SequenceNumber(),
+		Mode:              mode,
+		NetworkPassphrase: networkPassphrase,
+		ValidUntil:        tx.Timebounds().MaxTime,
+	}, true
+}
+
+// buildAnchorTransaction commits hash either as MEMO_HASH (with a no-op BumpSequence,
+// since a transaction needs one operation) or as a manageData entry. Revocations are
+// always a lockb0x_revoke manageData entry.
+func buildAnchorTransaction(hash, mode string, sequence int64) (*txnbuild.Transaction, error) {
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	params := txnbuild.TransactionParams{
+		SourceAccount:        &txnbuild.SimpleAccount{AccountID: anchorAccount, Sequence: sequence},
+		IncrementSequenceNum: true,
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions: txnbuild.Preconditions{
+			TimeBounds: txnbuild.NewTimeout(int64(anchorTimeout.Seconds())),
+		},
+	}
+
+	switch mode {
+	case codex.CommitmentRevocation:
+		params.Operations = []txnbuild.Operation{&txnbuild.ManageData{Name: codex.RevocationDataName, Value: raw}}
+	case AnchorModeManageData:
+		params.Operations = []txnbuild.Operation{&txnbuild.ManageData{Name: codex.AnchorDataName, Value: raw}}
+	default:
+		var memo txnbuild.MemoHash
+		copy(memo[:], raw)
+		params.Memo = memo
+		params.Operations = []txnbuild.Operation{&txnbuild.BumpSequence{BumpTo: 0}}
+	}
+
+	return txnbuild.NewTransaction(params)
+}
+
+// SubmitLockb0xTransaction accepts the signed anchoring envelope, checks that it comes
+// from the anchoring account and commits to the draft's pointer hash, and submits it to
+// Horizon. The draft moves to submitted, or to failed when Horizon rejects it with result
+// codes; a failed draft can be rebuilt and resubmitted. When Horizon can't be reached or
+// doesn't answer, the draft stays submitted and ingestion confirms it if it lands. Once
+// the ingested ledgers pass the envelope's upper time bound without it, the draft may be
+// submitted again.
+func SubmitLockb0xTransaction(w http.ResponseWriter, r *http.Request) {
+	hash := getPathVar(r, "hash")
+	if !isPointerHash(hash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+
+	var req AnchorSubmitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.XDR == "" {
+		sendError(w, "Request body must contain the signed xdr", http.StatusBadRequest)
+		return
+	}
+
+	parsed, err := txnbuild.TransactionFromXDR(req.XDR)
+	if err != nil {
+		sendError(w, "Invalid transaction envelope", http.StatusBadRequest)
+		return
+	}
+	tx, signatures := innerTransaction(parsed)
+	if tx == nil {
+		sendError(w, "Invalid transaction envelope", http.StatusBadRequest)
+		return
+	}
+	if signatures == 0 {
+		sendError(w, "Transaction is not signed", http.StatusBadRequest)
+		return
+	}
+	if !fromAnchorAccount(w, tx) {
+		return
+	}
+	if anchorCommitment(tx, hash) == "" {
+		sendError(w, "Transaction does not commit to the pointer hash", http.StatusUnprocessableEntity)
+		return
+	}
+	txHash, err := parsed.HashHex(networkPassphrase)
+	if err != nil {
+		sendError(w, "Failed to hash transaction", http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	// Claim the draft: only pending_tx or failed drafts may be submitted
+	conflict := ""
+	success := transaction(r.Context(), conn, "lockb0x submit", func() int {
+		conflict = ""
+		draftNode := conn.Node("^Codex", "draft", hash)
+		if !draftNode.HasTree() {
+			if conn.Node("^Codex", hash).HasTree() {
+				conflict = "Lockb0x record is already anchored"
+			} else {
+				conflict = "Lockb0x draft not found"
+			}
+			return yottadb.YDB_OK
+		}
+		status := draftNode.Child("status").Get("")
+		resubmit := status == Lockb0xSubmitted && submissionExpired(conn, draftNode)
+		if status != Lockb0xPendingTx && status != Lockb0xFailed && !resubmit {
+			conflict = fmt.Sprintf("Draft is not awaiting an anchoring transaction (status: %s)", status)
+			return yottadb.YDB_OK
+		}
+
+		draftNode.Child("status").Set(Lockb0xSubmitted)
+		draftNode.Child("tx_hash").Set(txHash)
+		draftNode.Child("submitted_at").Set(time.Now().Unix())
+		draftNode.Child("valid_until").Set(tx.Timebounds().MaxTime)
+		draftNode.Child("error").Kill()
+		draftNode.Child("error_codes").Kill()
+
+		// ^Codex("tx", tx_hash) = pointer hash, for lookups from the ledger side
+		conn.Node("^Codex", "tx", txHash).Set(hash)
+		appendCodexEvent(conn, hash, "submitted", map[string]interface{}{"tx_hash": txHash})
+		return yottadb.YDB_OK
+	})
+	if !success {
+		sendError(w, "Failed to update draft", http.StatusInternalServerError)
+		return
+	}
+	if conflict == "Lockb0x draft not found" {
+		sendError(w, conflict, http.StatusNotFound)
+		return
+	}
+	if conflict != "" {
+		sendError(w, conflict, http.StatusConflict)
+		return
+	}
+	go notifyLockb0xStatus(hash, Lockb0xSubmitted)
+
+	logger := requestLogger(r).With("hash", hash, "tx_hash", txHash)
+	logger.Info("Submitting Lockb0x anchor")
+	result := submitEnvelope(r.Context(), req.XDR)
+
+	status := http.StatusOK
+	switch {
+	case result.Pending:
+		// No definitive answer from Horizon; the transaction may still land, and the
+		// ingestor will confirm it if it does
+		logger.Warn("Lockb0x anchor submission unconfirmed, awaiting ingestion", "error", result.Message)
+		status = http.StatusAccepted
+	case result.Failed:
+		logger.Warn("Lockb0x anchor failed", "message", result.Message, "codes", result.Codes)
+		updateSubmittedDraft(conn, hash, func(draftNode *yottadb.Node) {
+			draftNode.Child("status").Set(Lockb0xFailed)
+			draftNode.Child("error").Set(result.Message)
+			draftNode.Child("error_codes").Set(result.Codes)
+			appendCodexEvent(conn, hash, "failed", map[string]interface{}{
+				"tx_hash": txHash, "error": result.Message, "error_codes": result.Codes,
+			})
+		})
+		go notifyLockb0xStatus(hash, Lockb0xFailed)
+		status = http.StatusBadGateway
+	default:
+		updateSubmittedDraft(conn, hash, func(draftNode *yottadb.Node) {
+			draftNode.Child("ledger").Set(result.Ledger)
+		})
+	}
+
+	record, err := fetchLockb0xRecord(conn, hash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(record)
+}
+
+// updateSubmittedDraft applies update only while the draft is still submitted; core-rust
+// may already have promoted it to ^Codex(hash) while Horizon was answering
+func updateSubmittedDraft(conn *yottadb.Conn, hash string, update func(draftNode *yottadb.Node)) {
+	conn.Transaction("", nil, func() int {
+		draftNode := conn.Node("^Codex", "draft", hash)
+		if draftNode.Child("status").Get("") == Lockb0xSubmitted {
+			update(draftNode)
+		}
+		return yottadb.YDB_OK
+	})
+}
+
+// fromAnchorAccount rejects envelopes that aren't sourced from the anchoring account or
+// that have no upper time bound, which submissionExpired relies on. It writes the error
+// response and returns false.
+func fromAnchorAccount(w http.ResponseWriter, tx *txnbuild.Transaction) bool {
+	if anchorAccount == "" {
+		sendError(w, "Anchoring account not configured", http.StatusServiceUnavailable)
+		return false
+	}
+	if tx.SourceAccount().AccountID != anchorAccount {
+		sendError(w, "Transaction source account is not the anchoring account", http.StatusUnprocessableEntity)
+		return false
+	}
+	if tx.Timebounds().MaxTime == 0 {
+		sendError(w, "Transaction must have an upper time bound", http.StatusUnprocessableEntity)
+		return false
+	}
+	return true
+}
+
+// submissionExpired reports whether the ingested ledgers on the anchoring network have
+// passed the submitted envelope's valid_until, so it can no longer land
+func submissionExpired(conn *yottadb.Conn, node *yottadb.Node) bool {
+	validUntil, _ := strconv.ParseInt(node.Child("valid_until").Get("0"), 10, 64)
+	if validUntil == 0 {
+		return false
+	}
+	seq := conn.Node(lockb0xNetwork.stellar, "latest").Get("")
+	closedAt, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", conn.Node(lockb0xNetwork.stellar, "ledger", seq, "closed_at").Get(""))
+	return err == nil && closedAt.Unix() > validUntil
+}
+
+// innerTransaction unwraps fee bumps, returning the transaction carrying the commitment
+// and the number of signatures on the outer envelope
+func innerTransaction(parsed *txnbuild.GenericTransaction) (*txnbuild.Transaction, int) {
+	if tx, ok := parsed.Transaction(); ok {
+		return tx, len(tx.Signatures())
+	}
+	if feeBump, ok := parsed.FeeBump(); ok {
+		return feeBump.InnerTransaction(), len(feeBump.Signatures())
+	}
+	return nil, 0
+}
+
+// anchorCommitment returns how tx commits to hash (AnchorModeMemoHash or
+// AnchorModeManageData), or "" if it does not
+func anchorCommitment(tx *txnbuild.Transaction, hash string) string {
+	return codex.Commitment(tx, hash)
+}
+
+// submissionResult is the outcome of handing a signed envelope to Horizon. Failed is set
+// only when Horizon rejected the transaction; Pending covers timeouts, transport errors
+// and server errors, after which the transaction may still land.
+type submissionResult struct {
+	Ledger  int32
+	Pending bool
+	Failed  bool
+	Message string
+	Codes   string
+}
+
+func submitEnvelope(ctx context.Context, envelope string) submissionResult {
+	var resp horizon.Transaction
+	err := tracing.Horizon(ctx, tracer, "submit", func() (err error) {
+		resp, err = lockb0xNetwork.client.SubmitTransactionXDR(envelope)
+		return err
+	}, horizonServer(lockb0xNetwork))
+	switch {
+	case err == nil:
+		return submissionResult{Ledger: resp.Ledger}
+	case isSubmissionRejected(err):
+		message, codes := submissionError(err)
+		return submissionResult{Failed: true, Message: message, Codes: codes}
+	default:
+		message, _ := submissionError(err)
+		return submissionResult{Pending: true, Message: message}
+	}
+}
+
+// isSubmissionRejected reports whether Horizon answered with a definitive rejection:
+// 400 for transaction_failed (with result codes) and transaction_malformed
+func isSubmissionRejected(err error) bool {
+	hErr := horizonclient.GetError(err)
+	return hErr != nil && hErr.Problem.Status == http.StatusBadRequest
+}
+
+// submissionError extracts a message and comma-separated result codes
+// (transaction code first, then operation codes) from a Horizon error
+func submissionError(err error) (string, string) {
+	hErr := horizonclient.GetError(err)
+	if hErr == nil {
+		return err.Error(), ""
+	}
+	codes, cErr := hErr.ResultCodes()
+	if cErr != nil || codes == nil {
+		return hErr.Problem.Title, ""
+	}
+	all := []string{codes.TransactionCode}
+	if codes.InnerTransactionCode != "" {
+		all = append(all, codes.InnerTransactionCode)
+	}
+	all = append(all, codes.OperationCodes...)
+	return hErr.Problem.Title, strings.Join(all, ",")
+}
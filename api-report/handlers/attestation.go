@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api-report/codex"
+
+	"github.com/stellar/go-stellar-sdk/keypair"
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// Parties attest to a record by signing its codex.Statement with their Stellar key.
+// Requests live at ^Codex("attest", hash, "request", public_key) and signatures at
+// ^Codex("attest", hash, "sig", public_key), so each party holds one role per record.
+
+// Attester is a party asked to attest to a record
+type Attester struct {
+	PublicKey string `json:"public_key"` // Stellar G... address
+	Role      string `json:"role"`       // e.g. owner, custodian, notary
+}
+
+// AttestationRequest is an outstanding or fulfilled request, with the exact bytes to sign
+type AttestationRequest struct {
+	PublicKey   string          `json:"public_key"`
+	Role        string          `json:"role"`
+	RequestedAt int64           `json:"requested_at"`
+	Statement   codex.Statement `json:"statement"`
+	Payload     string          `json:"payload"` // Base64 canonical JSON of statement: sign these bytes
+	Fulfilled   bool            `json:"fulfilled"`
+}
+
+// AttestationStatus is a stored attestation checked against the current record
+type AttestationStatus struct {
+	codex.Attestation
+	Valid   bool   `json:"valid"`
+	Current bool   `json:"current"` // Signed over the current record version
+	Reason  string `json:"reason,omitempty"`
+}
+
+// AttestationSet is every request and attestation for a record
+type AttestationSet struct {
+	PointerHash   string               `json:"pointer_hash"`
+	RecordVersion int                  `json:"record_version"`
+	Requests      []AttestationRequest `json:"requests"`
+	Attestations  []AttestationStatus  `json:"attestations"`
+	Complete      bool                 `json:"complete"` // Every requested party has attested to the current version
+}
+
+type AttestationRequestBody struct {
+	Attesters []Attester `json:"attesters"`
+}
+
+type AttestationSubmitRequest struct {
+	PublicKey string `json:"public_key"`
+	Role      string `json:"role,omitempty"` // Defaults to the requested role
+	Signature string `json:"signature"`      // Base64 ed25519 signature over the statement payload
+}
+
+// validateAttester checks a requested party
+func validateAttester(a Attester) string {
+	if _, err := keypair.ParseAddress(a.PublicKey); err != nil {
+		return "Invalid attester public_key (must be a Stellar G... address)"
+	}
+	if a.Role == "" || len(a.Role) > 64 {
+		return "Attester role is required (max 64 characters)"
+	}
+	return ""
+}
+
+// writeAttestationRequest records a request for a's attestation. Call inside a transaction.
+func writeAttestationRequest(conn *yottadb.Conn, hash string, a Attester) {
+	reqNode := conn.Node("^Codex", "attest", hash, "request", a.PublicKey)
+	reqNode.Set(a.PublicKey)
+	reqNode.Child("role").Set(a.Role)
+	reqNode.Child("requested_at").Set(time.Now().Unix())
+	appendCodexEvent(conn, hash, "attestation_requested", map[string]interface{}{"public_key": a.PublicKey, "role": a.Role})
+}
+
+// storedAttestations reads the signatures recorded for hash
+func storedAttestations(conn *yottadb.Conn, hash string) []codex.Attestation {
+	var attestations []codex.Attestation
+	node := conn.Node("^Codex", "attest", hash, "sig", "").Next()
+	for node != nil {
+		var a codex.Attestation
+		if err := json.Unmarshal([]byte(node.Child("statement").Get("{}")), &a.Statement); err == nil {
+			a.Signature = codex.Signature{
+				Algorithm: "ed25519",
+				PublicKey: node.Get(""),
+				Value:     node.Child("signature").Get(""),
+			}
+			a.SignedAt, _ = strconv.ParseInt(node.Child("signed_at").Get("0"), 10, 64)
+			attestations = append(attestations, a)
+		}
+		node = node.Next()
+	}
+	return attestations
+}
+
+// attestationSet checks every attestation for record and matches them to its requests
+func attestationSet(conn *yottadb.Conn, record *Lockb0xRecord) *AttestationSet {
+	entry := codexEntry(record)
+	set := &AttestationSet{
+		PointerHash:   record.PointerHash,
+		RecordVersion: record.Version,
+		Requests:      []AttestationRequest{},
+		Attestations:  []AttestationStatus{},
+	}
+
+	current := map[string]string{} // public key -> role of a valid, current attestation
+	for _, a := range storedAttestations(conn, record.PointerHash) {
+		status := AttestationStatus{Attestation: a}
+		if err := codex.VerifyAttestation(a); err != nil {
+			status.Reason = err.Error()
+		} else if a.Statement.PointerHash != record.PointerHash {
+			status.Reason = "statement is for a different pointer hash"
+		} else {
+			status.Valid = true
+			status.Current = a.Statement == codex.StatementFor(entry, a.Statement.Role)
+			if status.Current {
+				current[a.Signature.PublicKey] = a.Statement.Role
+			}
+		}
+		set.Attestations = append(set.Attestations, status)
+	}
+
+	set.Complete = true
+	node := conn.Node("^Codex", "attest", record.PointerHash, "request", "").Next()
+	for node != nil {
+		req := AttestationRequest{
+			PublicKey: node.Get(""),
+			Role:      node.Child("role").Get(""),
+		}
+		req.RequestedAt, _ = strconv.ParseInt(node.Child("requested_at").Get("0"), 10, 64)
+		req.Statement = codex.StatementFor(entry, req.Role)
+		if payload, err := codex.Canonical(req.Statement); err == nil {
+			req.Payload = base64.StdEncoding.EncodeToString(payload)
+		}
+		req.Fulfilled = current[req.PublicKey] == req.Role
+		set.Complete = set.Complete && req.Fulfilled
+		set.Requests = append(set.Requests, req)
+		node = node.Next()
+	}
+	set.Complete = set.Complete && len(set.Requests) > 0
+	return set
+}
+
+// ListLockb0xAttestations returns a record's attestation requests and signatures
+func ListLockb0xAttestations(w http.ResponseWriter, r *http.Request) {
+	hash := getPathVar(r, "hash")
+	if !isPointerHash(hash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	record, err := fetchLockb0xRecord(conn, hash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sendJSON(w, attestationSet(conn, record))
+}
+
+// RequestLockb0xAttestations asks parties to attest to a record. Each request carries
+// the statement payload the party signs off-node.
+func RequestLockb0xAttestations(w http.ResponseWriter, r *http.Request) {
+	hash := getPathVar(r, "hash")
+	if !isPointerHash(hash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+
+	var req AttestationRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Attesters) == 0 {
+		sendError(w, "Request body must list attesters", http.StatusBadRequest)
+		return
+	}
+	for _, a := range req.Attesters {
+		if msg := validateAttester(a); msg != "" {
+			sendError(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	conflict := ""
+	success := transaction(r.Context(), conn, "attestation request", func() int {
+		conflict = ""
+		node := codexRecordNode(conn, hash)
+		if node == nil {
+			conflict = "Lockb0x record not found"
+			return yottadb.YDB_OK
+		}
+		if node.Child("status").Get("") == Lockb0xRevoked {
+			conflict = "Lockb0x record is revoked"
+			return yottadb.YDB_OK
+		}
+		for _, a := range req.Attesters {
+			writeAttestationRequest(conn, hash, a)
+		}
+		return yottadb.YDB_OK
+	})
+	if !success {
+		sendError(w, "Failed to save attestation requests", http.StatusInternalServerError)
+		return
+	}
+	if conflict == "Lockb0x record not found" {
+		sendError(w, conflict, http.StatusNotFound)
+		return
+	}
+	if conflict != "" {
+		sendError(w, conflict, http.StatusConflict)
+		return
+	}
+
+	record, err := fetchLockb0xRecord(conn, hash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sendJSON(w, attestationSet(conn, record))
+}
+
+// SubmitLockb0xAttestation records a party's signature over the record's current
+// statement. A party that was asked to attest signs in the requested role.
+func SubmitLockb0xAttestation(w http.ResponseWriter, r *http.Request) {
+	hash := getPathVar(r, "hash")
+	if !isPointerHash(hash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+
+	var req AttestationSubmitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Signature == "" {
+		sendError(w, "Request body must contain public_key and signature", http.StatusBadRequest)
+		return
+	}
+	if _, err := keypair.ParseAddress(req.PublicKey); err != nil {
+		sendError(w, "Invalid public_key (must be a Stellar G... address)", http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	record, err := fetchLockb0xRecord(conn, hash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if record.Status == Lockb0xRevoked {
+		sendError(w, "Lockb0x record is revoked", http.StatusConflict)
+		return
+	}
+
+	role := req.Role
+	if requested := conn.Node("^Codex", "attest", hash, "request", req.PublicKey, "role").Get(""); requested != "" {
+		if role != "" && role != requested {
+			sendError(w, "Role does not match the attestation request ("+requested+")", http.StatusBadRequest)
+			return
+		}
+		role = requested
+	}
+	if msg := validateAttester(Attester{PublicKey: req.PublicKey, Role: role}); msg != "" {
+		sendError(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	attestation := codex.Attestation{
+		Statement: codex.StatementFor(codexEntry(record), role),
+		Signature: codex.Signature{Algorithm: "ed25519", PublicKey: req.PublicKey, Value: req.Signature},
+		SignedAt:  time.Now().Unix(),
+	}
+	if err := codex.VerifyAttestation(attestation); err != nil {
+		sendError(w, "Signature does not match the record's current statement: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	statement, _ := json.Marshal(attestation.Statement)
+
+	conflict := ""
+	success := transaction(r.Context(), conn, "attestation submit", func() int {
+		conflict = ""
+		// The record may have been corrected or revoked since the statement was built
+		node := codexRecordNode(conn, hash)
+		if node == nil || node.Child("status").Get("") == Lockb0xRevoked ||
+			node.Child("version").Get("1") != strconv.Itoa(attestation.Statement.RecordVersion) {
+			conflict = "Lockb0x record changed while attesting; fetch the current statement and sign again"
+			return yottadb.YDB_OK
+		}
+
+		sigNode := conn.Node("^Codex", "attest", hash, "sig", req.PublicKey)
+		sigNode.Set(req.PublicKey)
+		sigNode.Child("statement").Set(string(statement))
+		sigNode.Child("signature").Set(req.Signature)
+		sigNode.Child("signed_at").Set(attestation.SignedAt)
+
+		appendCodexEvent(conn, hash, "attested", map[string]interface{}{
+			"public_key": req.PublicKey, "role": role, "record_version": attestation.Statement.RecordVersion,
+		})
+		return yottadb.YDB_OK
+	})
+	if !success {
+		sendError(w, "Failed to save attestation", http.StatusInternalServerError)
+		return
+	}
+	if conflict != "" {
+		sendError(w, conflict, http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(AttestationStatus{Attestation: attestation, Valid: true, Current: true})
+}
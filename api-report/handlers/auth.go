@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// API key scopes. ScopeAdmin implies every other scope.
+const (
+	ScopeReadAccounts     = "read:accounts"
+	ScopeReadLedgers      = "read:ledgers"
+	ScopeReadTransactions = "read:transactions"
+	ScopeReadLockb0x      = "read:lockb0x"
+	ScopeWriteLockb0x     = "write:lockb0x"
+	ScopeWriteWebhooks    = "write:webhooks"
+	ScopeAdmin            = "admin"
+)
+
+var validScopes = map[string]bool{
+	ScopeReadAccounts:     true,
+	ScopeReadLedgers:      true,
+	ScopeReadTransactions: true,
+	ScopeReadLockb0x:      true,
+	ScopeWriteLockb0x:     true,
+	ScopeWriteWebhooks:    true,
+	ScopeAdmin:            true,
+}
+
+const (
+	apiKeyPrefix       = "pk_"
+	lastUsedResolution = 60 // Seconds between ^ApiKey last_used writes for a key
+)
+
+// APIKey is stored under ^ApiKey(id). Only the SHA-256 of the secret is persisted.
+type APIKey struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt int64    `json:"created_at"`
+	ExpiresAt int64    `json:"expires_at,omitempty"`
+	LastUsed  int64    `json:"last_used,omitempty"`
+	Revoked   bool     `json:"revoked"`
+	Key       string   `json:"key,omitempty"` // Plaintext, returned only on create/rotate
+	hash      string
+}
+
+type apiKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expires_at"` // RFC 3339, optional
+}
+
+type apiKeyContextKey struct{}
+
+// HasScope reports whether the key grants scope (admin grants all)
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyMiddleware authenticates X-API-Key against ^ApiKey. The API_KEY environment
+// variable remains valid as a bootstrap admin key.
+func APIKeyMiddleware(bootstrapKey string) func(http.Handler) http.Handler {
+	bootstrapHash := hashAPIKey(bootstrapKey)
+	bootstrap := &APIKey{ID: "env", Name: "API_KEY", Scopes: []string{ScopeAdmin}}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			presented := r.Header.Get("X-API-Key")
+			if presented == "" {
+				sendError(w, "Missing X-API-Key header", http.StatusUnauthorized)
+				return
+			}
+
+			var key *APIKey
+			if subtle.ConstantTimeCompare([]byte(hashAPIKey(presented)), []byte(bootstrapHash)) == 1 {
+				key = bootstrap
+			} else {
+				key = authenticateAPIKey(presented)
+			}
+			if key == nil {
+				sendError(w, "Invalid API key", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+		})
+	}
+}
+
+// RequireScope rejects requests whose authenticated key lacks scope
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := APIKeyFromContext(r.Context())
+		if key == nil || !key.HasScope(scope) {
+			sendError(w, fmt.Sprintf("API key lacks required scope: %s", scope), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// APIKeyFromContext returns the key authenticated by APIKeyMiddleware, if any
+func APIKeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
+
+// authenticateAPIKey resolves a "pk_<id>.<secret>" key, returning nil if it is unknown,
+// revoked, expired or does not match the stored hash
+func authenticateAPIKey(presented string) *APIKey {
+	id, _, ok := strings.Cut(strings.TrimPrefix(presented, apiKeyPrefix), ".")
+	if !ok || !strings.HasPrefix(presented, apiKeyPrefix) {
+		return nil
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	key, err := loadAPIKey(conn, id)
+	if err != nil {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(presented)), []byte(key.hash)) != 1 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	if key.Revoked || (key.ExpiresAt > 0 && now >= key.ExpiresAt) {
+		return nil
+	}
+	if now-key.LastUsed >= lastUsedResolution {
+		conn.Node("^ApiKey", id, "last_used").Set(now)
+		key.LastUsed = now
+	}
+	return key
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ListAPIKeys returns every key (hashes and secrets omitted)
+func ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	keys := []APIKey{}
+	node := conn.Node("^ApiKey", "").Next()
+	for node != nil {
+		keys = append(keys, *readAPIKey(node))
+		node = node.Next()
+	}
+
+	sendJSON(w, map[string]interface{}{"keys": keys})
+}
+
+// CreateAPIKey issues a new key; the plaintext is returned only in this response
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		sendError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		sendError(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, s := range req.Scopes {
+		if !validScopes[s] {
+			sendError(w, fmt.Sprintf("Unknown scope: %s", s), http.StatusBadRequest)
+			return
+		}
+	}
+
+	key := &APIKey{
+		ID:        newID()[:12],
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now().Unix(),
+	}
+	if req.ExpiresAt != "" {
+		expires, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			sendError(w, "expires_at must be RFC 3339", http.StatusBadRequest)
+			return
+		}
+		key.ExpiresAt = expires.Unix()
+	}
+	issueSecret(key)
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	if !saveAPIKey(conn, key) {
+		sendError(w, "Failed to save API key", http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("API key created", "key_id", key.ID, "name", key.Name, "scopes", key.Scopes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// RotateAPIKey replaces the secret of an existing key; the old secret stops working immediately
+func RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	id := getPathVar(r, "key")
+
+	key, err := loadAPIKey(conn, id)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if key.Revoked {
+		sendError(w, "API key is revoked", http.StatusConflict)
+		return
+	}
+
+	issueSecret(key)
+	if !saveAPIKey(conn, key) {
+		sendError(w, "Failed to rotate API key", http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("API key rotated", "key_id", key.ID, "name", key.Name)
+
+	sendJSON(w, key)
+}
+
+// RevokeAPIKey disables a key; the record is kept for audit
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	id := getPathVar(r, "key")
+
+	key, err := loadAPIKey(conn, id)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	conn.Node("^ApiKey", id, "revoked").Set("1")
+	key.Revoked = true
+	requestLogger(r).Info("API key revoked", "key_id", key.ID, "name", key.Name)
+
+	sendJSON(w, key)
+}
+
+func issueSecret(key *APIKey) {
+	key.Key = apiKeyPrefix + key.ID + "." + newID() + newID()
+	key.hash = hashAPIKey(key.Key)
+}
+
+func saveAPIKey(conn *yottadb.Conn, key *APIKey) bool {
+	return conn.Transaction("", nil, func() int {
+		node := conn.Node("^ApiKey", key.ID)
+		node.Child("id").Set(key.ID)
+		node.Child("name").Set(key.Name)
+		node.Child("hash").Set(key.hash)
+		node.Child("scopes").Set(strings.Join(key.Scopes, ","))
+		node.Child("created_at").Set(key.CreatedAt)
+		node.Child("expires_at").Set(key.ExpiresAt)
+		return yottadb.YDB_OK
+	})
+}
+
+func loadAPIKey(conn *yottadb.Conn, id string) (*APIKey, error) {
+	if id == "" {
+		return nil, fmt.Errorf("API key id required")
+	}
+	node := conn.Node("^ApiKey", id)
+	if !node.HasTree() {
+		return nil, fmt.Errorf("API key %s not found", id)
+	}
+	return readAPIKey(node), nil
+}
+
+func readAPIKey(node *yottadb.Node) *APIKey {
+	createdAt, _ := strconv.ParseInt(node.Child("created_at").Get("0"), 10, 64)
+	expiresAt, _ := strconv.ParseInt(node.Child("expires_at").Get("0"), 10, 64)
+	lastUsed, _ := strconv.ParseInt(node.Child("last_used").Get("0"), 10, 64)
+	var scopes []string
+	if s := node.Child("scopes").Get(""); s != "" {
+		scopes = strings.Split(s, ",")
+	}
+	return &APIKey{
+		ID:        node.Child("id").Get(""),
+		Name:      node.Child("name").Get(""),
+		Scopes:    scopes,
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+		LastUsed:  lastUsed,
+		Revoked:   node.Child("revoked").Get("") == "1",
+		hash:      node.Child("hash").Get(""),
+	}
+}
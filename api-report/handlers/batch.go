@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"api-report/codex"
+
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// Batch anchoring settings, set by StartBatcher. A zero window disables batching.
+var (
+	batchWindow time.Duration
+	batchMax    = 1000
+)
+
+// Lockb0xBatch is a sealed Merkle batch stored at ^Codex("batch", id)
+type Lockb0xBatch struct {
+	ID        int64    `json:"id"`
+	Root      string   `json:"root"`
+	Count     int      `json:"count"`
+	CreatedAt int64    `json:"created_at"`
+	Status    string   `json:"status"` // Status of the root's anchor
+	TxHash    string   `json:"tx_hash,omitempty"`
+	Members   []string `json:"members"`
+}
+
+// StartBatcher seals queued drafts into a Merkle batch every LOCKB0X_BATCH_WINDOW. The
+// batch root becomes an ordinary draft, anchored with the transaction/submit endpoints;
+// once core-rust confirms it, the members are promoted along with their inclusion proofs.
+func StartBatcher() {
+	window, err := time.ParseDuration(os.Getenv("LOCKB0X_BATCH_WINDOW"))
+	if err != nil || window <= 0 {
+		slog.Info("LOCKB0X_BATCH_WINDOW not set, batch anchoring disabled")
+		return
+	}
+	batchWindow = window
+	batchMax = envInt("LOCKB0X_BATCH_MAX", batchMax)
+
+	go func() {
+		for range time.Tick(batchWindow) {
+			sealBatch()
+		}
+	}()
+
+	go func() {
+		wake, _ := lockb0xNetwork.hub.subscribe()
+		for range wake {
+			confirmBatches()
+		}
+	}()
+
+	slog.Info("Lockb0x batch anchoring enabled", "window", batchWindow.String(), "max_drafts", batchMax)
+}
+
+// sealBatch moves up to batchMax queued drafts into a new batch and creates the root draft
+func sealBatch() {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	var hashes, stale []string
+	node := conn.Node("^Codex", "batch_queue", "").Next()
+	for node != nil && len(hashes) < batchMax {
+		hash := node.Get("")
+		if lockb0xStatus(conn, hash) == Lockb0xQueued {
+			hashes = append(hashes, hash)
+		} else {
+			stale = append(stale, hash)
+		}
+		node = node.Next()
+	}
+	for _, hash := range stale {
+		conn.Node("^Codex", "batch_queue", hash).Kill()
+	}
+	if len(hashes) == 0 {
+		return
+	}
+
+	root, proofs, err := codex.MerkleTree(hashes)
+	if err != nil {
+		slog.Error("Failed to build Lockb0x batch", "error", err)
+		return
+	}
+
+	var id int64
+	var members []string
+	success := transaction(context.Background(), conn, "batch seal", func() int {
+		members = members[:0]
+		seqNode := conn.Node("^Codex", "batch_seq")
+		id, _ = strconv.ParseInt(seqNode.Get("0"), 10, 64)
+		id++
+		seqNode.Set(id)
+		idStr := strconv.FormatInt(id, 10)
+
+		batchNode := conn.Node("^Codex", "batch", idStr)
+		for i, hash := range hashes {
+			conn.Node("^Codex", "batch_queue", hash).Kill()
+
+			draftNode := conn.Node("^Codex", "draft", hash)
+			if draftNode.Child("status").Get("") != Lockb0xQueued {
+				continue // Changed since it was collected; the root still commits to it harmlessly
+			}
+			proof, _ := json.Marshal(proofs[i])
+			draftNode.Child("status").Set(Lockb0xBatched)
+			draftNode.Child("batch_id").Set(idStr)
+			draftNode.Child("batch_root").Set(root)
+			draftNode.Child("batch_proof").Set(string(proof))
+			appendCodexEvent(conn, hash, "batched", map[string]interface{}{"batch_id": id, "batch_root": root})
+
+			batchNode.Child("member", strconv.Itoa(len(members))).Set(hash)
+			members = append(members, hash)
+		}
+		batchNode.Child("root").Set(root)
+		batchNode.Child("count").Set(len(members))
+		batchNode.Child("created_at").Set(time.Now().Unix())
+
+		// The root is anchored like any other draft
+		rootNode := conn.Node("^Codex", "draft", root)
+		rootNode.Child("hash").Set(root)
+		rootNode.Child("url").Set(fmt.Sprintf("lockb0x-batch:%d", id))
+		rootNode.Child("description").Set(fmt.Sprintf("Merkle root of %d Lockb0x drafts", len(members)))
+		rootNode.Child("provider").Set("batch")
+		rootNode.Child("status").Set(Lockb0xPendingTx)
+		rootNode.Child("timestamp").Set(time.Now().Unix())
+		rootNode.Child("batch_of").Set(idStr)
+		appendCodexIndex(conn, root)
+
+		conn.Node("^Codex", "batch_open", idStr).Set(idStr)
+		return yottadb.YDB_OK
+	})
+	if !success {
+		slog.Error("Failed to seal Lockb0x batch", "drafts", len(hashes))
+		return
+	}
+
+	slog.Info("Sealed Lockb0x batch", "batch", id, "drafts", len(members), "root", root)
+	for _, hash := range members {
+		notifyLockb0xStatus(hash, Lockb0xBatched)
+	}
+	notifyLockb0xStatus(root, Lockb0xPendingTx)
+}
+
+// confirmBatches promotes the members of every batch whose root core-rust has anchored
+func confirmBatches() {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	var open []string
+	node := conn.Node("^Codex", "batch_open", "").Next()
+	for node != nil {
+		open = append(open, node.Get(""))
+		node = node.Next()
+	}
+
+	for _, idStr := range open {
+		batchNode := conn.Node("^Codex", "batch", idStr)
+		root := batchNode.Child("root").Get("")
+		rootNode := conn.Node("^Codex", root)
+		if rootNode.Child("status").Get("") != Lockb0xAnchored {
+			continue
+		}
+
+		var promoted []string
+		transaction(context.Background(), conn, "batch confirm", func() int {
+			promoted = promoted[:0]
+			count, _ := strconv.Atoi(batchNode.Child("count").Get("0"))
+			for i := 0; i < count; i++ {
+				hash := batchNode.Child("member", strconv.Itoa(i)).Get("")
+				if promoteBatchMember(conn, hash, rootNode) {
+					promoted = append(promoted, hash)
+				}
+			}
+			batchNode.Child("anchored_at").Set(time.Now().Unix())
+			conn.Node("^Codex", "batch_open", idStr).Kill()
+			return yottadb.YDB_OK
+		})
+
+		slog.Info("Lockb0x batch anchored", "batch", idStr, "promoted", len(promoted))
+		for _, hash := range promoted {
+			notifyLockb0xStatus(hash, Lockb0xAnchored)
+		}
+	}
+}
+
+// promoteBatchMember mirrors core-rust's promote_anchor for a draft anchored through its
+// batch root, keeping the inclusion proof. Call inside a transaction.
+func promoteBatchMember(conn *yottadb.Conn, hash string, rootNode *yottadb.Node) bool {
+	draftNode := conn.Node("^Codex", "draft", hash)
+	if draftNode.Child("status").Get("") != Lockb0xBatched {
+		return false // Gone, or revoked while the batch was in flight
+	}
+
+	activeNode := conn.Node("^Codex", hash)
+	for _, field := range []string{"url", "description", "provider", "timestamp", "content_verified", "batch_id", "batch_root", "batch_proof", "version", "supersedes", "superseded_by"} {
+		if value := draftNode.Child(field).Get(""); value != "" {
+			activeNode.Child(field).Set(value)
+		}
+	}
+	activeNode.Child("status").Set(Lockb0xAnchored)
+	activeNode.Child("tx_hash").Set(rootNode.Child("tx_hash").Get(""))
+	activeNode.Child("ledger").Set(rootNode.Child("ledger").Get("0"))
+	appendCodexEvent(conn, hash, "anchored", map[string]interface{}{
+		"tx_hash": rootNode.Child("tx_hash").Get(""), "batch_root": rootNode.Child("hash").Get(""),
+	})
+
+	draftNode.Kill()
+	return true
+}
+
+// GetLockb0xBatch returns a batch, its members and the state of its root anchor
+func GetLockb0xBatch(w http.ResponseWriter, r *http.Request) {
+	idStr := getPathVar(r, "batch")
+	if _, err := strconv.ParseInt(idStr, 10, 64); err != nil {
+		sendError(w, "Invalid batch id", http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	batchNode := conn.Node("^Codex", "batch", idStr)
+	if !batchNode.HasTree() {
+		sendError(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+
+	id, _ := strconv.ParseInt(idStr, 10, 64)
+	count, _ := strconv.Atoi(batchNode.Child("count").Get("0"))
+	createdAt, _ := strconv.ParseInt(batchNode.Child("created_at").Get("0"), 10, 64)
+	batch := Lockb0xBatch{
+		ID:        id,
+		Root:      batchNode.Child("root").Get(""),
+		Count:     count,
+		CreatedAt: createdAt,
+		Members:   []string{},
+	}
+	for i := 0; i < count; i++ {
+		batch.Members = append(batch.Members, batchNode.Child("member", strconv.Itoa(i)).Get(""))
+	}
+	if root, err := fetchLockb0xRecord(conn, batch.Root); err == nil {
+		batch.Status = root.Status
+		batch.TxHash = root.TxHash
+	}
+
+	sendJSON(w, batch)
+}
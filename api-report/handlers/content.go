@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lockb0x-llc/pakana-node-0/pkg/logging"
+)
+
+// ContentProvider fetches the document a Lockb0x url points to. Providers are keyed by
+// the draft's provider field, falling back to the url scheme.
+type ContentProvider interface {
+	Open(ctx context.Context, rawURL string) (io.ReadCloser, error)
+}
+
+// Limits applied to content verification, set by InitContentVerification
+var (
+	verifyByDefault  = false
+	verifyMaxBytes   = int64(50 << 20)
+	verifyTimeout    = 30 * time.Second
+	verifyInternal   []*net.IPNet // Non-public networks content may be fetched from; none by default
+	contentProviders = map[string]ContentProvider{}
+	providersMu      sync.RWMutex
+)
+
+// RegisterContentProvider makes p available for drafts whose provider (or url scheme) is name
+func RegisterContentProvider(name string, p ContentProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	contentProviders[strings.ToLower(name)] = p
+}
+
+// InitContentVerification configures the limits and registers the built-in providers
+func InitContentVerification() {
+	verifyByDefault = os.Getenv("LOCKB0X_VERIFY_CONTENT") == "true"
+	if max := envInt("LOCKB0X_VERIFY_MAX_BYTES", 0); max > 0 {
+		verifyMaxBytes = int64(max)
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("LOCKB0X_VERIFY_TIMEOUT")); err == nil && timeout > 0 {
+		verifyTimeout = timeout
+	}
+
+	verifyInternal = parseCIDRList("LOCKB0X_VERIFY_ALLOW_NETWORKS")
+
+	web := newHTTPProvider()
+	RegisterContentProvider("http", web)
+	RegisterContentProvider("https", web)
+
+	if root := os.Getenv("LOCKB0X_FILE_ROOT"); root != "" {
+		resolved, err := filepath.EvalSymlinks(filepath.Clean(root))
+		if err != nil {
+			logging.Fatal("Invalid LOCKB0X_FILE_ROOT", "error", err)
+		}
+		RegisterContentProvider("file", &fileProvider{root: resolved})
+	}
+
+	gateway := os.Getenv("LOCKB0X_IPFS_GATEWAY")
+	if gateway == "" {
+		gateway = "https://ipfs.io"
+	}
+	RegisterContentProvider("ipfs", &ipfsProvider{gateway: strings.TrimSuffix(gateway, "/"), web: web})
+
+	slog.Info("Lockb0x content verification configured",
+		"default", verifyByDefault, "max_bytes", verifyMaxBytes, "timeout", verifyTimeout.String(),
+		"internal_networks", len(verifyInternal))
+}
+
+// verifyContent fetches rawURL through the matching provider and compares its SHA-256
+// with pointerHash
+func verifyContent(ctx context.Context, provider, rawURL, pointerHash string) error {
+	p, err := contentProvider(provider, rawURL)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+
+	body, err := p.Open(ctx, rawURL)
+	if err != nil {
+		return fmt.Errorf("fetching content: %w", err)
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, io.LimitReader(body, verifyMaxBytes+1))
+	if err != nil {
+		return fmt.Errorf("reading content: %w", err)
+	}
+	if n > verifyMaxBytes {
+		return fmt.Errorf("content exceeds %d bytes", verifyMaxBytes)
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != pointerHash {
+		return fmt.Errorf("content SHA-256 %s does not match pointer_hash", sum)
+	}
+	return nil
+}
+
+func contentProvider(provider, rawURL string) (ContentProvider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	if p, ok := contentProviders[strings.ToLower(provider)]; ok {
+		return p, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if p, ok := contentProviders[strings.ToLower(u.Scheme)]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("no content provider for %q", u.Scheme)
+}
+
+// httpProvider fetches http(s) URLs from public addresses only. The check runs on the
+// resolved address of every connection, so neither a redirect nor a DNS answer that
+// changes after validation can reach loopback, private or link-local hosts. Networks in
+// LOCKB0X_VERIFY_ALLOW_NETWORKS are exempt.
+type httpProvider struct {
+	client *http.Client
+}
+
+const maxContentRedirects = 5
+
+// publicTransport connects only to public addresses and networks in
+// LOCKB0X_VERIFY_ALLOW_NETWORKS. Content fetches and webhook deliveries both use it, so
+// a URL an API client supplies cannot reach services on the node's own network.
+func publicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("refusing to connect to %s", host)
+			}
+			if !publicAddress(ip) && !inNetworks(ip, verifyInternal) {
+				return fmt.Errorf("refusing to connect to non-public address %s", ip)
+			}
+			return nil
+		},
+	}
+	return &http.Transport{
+		Proxy:               nil, // A proxy would connect on our behalf, bypassing the check
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+func newHTTPProvider() *httpProvider {
+	return &httpProvider{client: &http.Client{
+		Timeout:   verifyTimeout,
+		Transport: publicTransport(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxContentRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxContentRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}}
+}
+
+// publicAddress reports whether ip is globally routable: not loopback, private,
+// link-local, shared (CGNAT), multicast or unspecified
+func publicAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	return !sharedAddressSpace.Contains(ip)
+}
+
+// sharedAddressSpace is RFC 6598's carrier-grade NAT range
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func (p *httpProvider) Open(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if resp.ContentLength > verifyMaxBytes {
+		resp.Body.Close()
+		return nil, fmt.Errorf("content exceeds %d bytes", verifyMaxBytes)
+	}
+	return resp.Body, nil
+}
+
+// fileProvider reads file:// URLs, confined to root (LOCKB0X_FILE_ROOT, with symlinks
+// resolved)
+type fileProvider struct {
+	root string
+}
+
+func (p *fileProvider) Open(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "file" {
+		return nil, fmt.Errorf("not a file:// url")
+	}
+	// Resolve symlinks first, so a link inside root cannot point outside it
+	path, err := filepath.EvalSymlinks(filepath.Clean(u.Path))
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(p.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("path is outside LOCKB0X_FILE_ROOT")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// Stat what was opened, so a device or FIFO swapped in after the check is refused too
+	info, err := f.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = fmt.Errorf("not a regular file")
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// ipfsProvider resolves ipfs://<cid>/<path> through an HTTP gateway. The content is
+// still hashed locally, so a misbehaving gateway cannot forge a match.
+type ipfsProvider struct {
+	gateway string
+	web     *httpProvider
+}
+
+func (p *ipfsProvider) Open(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	cid := strings.TrimPrefix(rawURL, "ipfs://")
+	if cid == rawURL || cid == "" {
+		return nil, fmt.Errorf("not an ipfs:// url")
+	}
+	return p.web.Open(ctx, p.gateway+"/ipfs/"+cid)
+}
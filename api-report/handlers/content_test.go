@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// useProvider registers p under name for the rest of the test
+func useProvider(t *testing.T, name string, p ContentProvider) {
+	t.Helper()
+	providersMu.Lock()
+	saved, had := contentProviders[name]
+	providersMu.Unlock()
+	RegisterContentProvider(name, p)
+	t.Cleanup(func() {
+		providersMu.Lock()
+		defer providersMu.Unlock()
+		if had {
+			contentProviders[name] = saved
+		} else {
+			delete(contentProviders, name)
+		}
+	})
+}
+
+func TestVerifyContentHash(t *testing.T) {
+	allowLoopback(t)
+	useProvider(t, "http", newHTTPProvider())
+	doc := []byte("lockb0x test document\n")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(doc)
+	}))
+	defer srv.Close()
+
+	if err := verifyContent(context.Background(), "", srv.URL+"/doc", sha256Hex(doc)); err != nil {
+		t.Errorf("matching content rejected: %v", err)
+	}
+	err := verifyContent(context.Background(), "", srv.URL+"/doc", sha256Hex([]byte("something else")))
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("mismatched content: err = %v", err)
+	}
+}
+
+func TestVerifyContentSizeLimit(t *testing.T) {
+	allowLoopback(t)
+	useProvider(t, "http", newHTTPProvider())
+	saved := verifyMaxBytes
+	verifyMaxBytes = 1024
+	defer func() { verifyMaxBytes = saved }()
+
+	doc := []byte(strings.Repeat("x", 4096))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// No Content-Length: the limit has to stop the read itself
+			w.Write(doc[:512])
+			w.(http.Flusher).Flush()
+			w.Write(doc[512:])
+			return
+		}
+		w.Write(doc)
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/sized", "/chunked"} {
+		err := verifyContent(context.Background(), "", srv.URL+path, sha256Hex(doc))
+		if err == nil || !strings.Contains(err.Error(), "exceeds 1024 bytes") {
+			t.Errorf("%s: err = %v, want the size limit", path, err)
+		}
+	}
+}
+
+func TestVerifyContentRefusesRedirectToPrivateAddress(t *testing.T) {
+	// Only the first server is allowed; the redirect target is another loopback address
+	saved := verifyInternal
+	verifyInternal = []*net.IPNet{{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(32, 32)}}
+	defer func() { verifyInternal = saved }()
+	useProvider(t, "http", newHTTPProvider())
+
+	ln, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 unavailable: %v", err)
+	}
+	var reached atomic.Bool
+	internal := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached.Store(true)
+	}))
+	internal.Listener.Close()
+	internal.Listener = ln
+	internal.Start()
+	defer internal.Close()
+
+	public := httptest.NewServer(http.RedirectHandler(internal.URL+"/secret", http.StatusFound))
+	defer public.Close()
+
+	err = verifyContent(context.Background(), "", public.URL, sha256Hex(nil))
+	if err == nil || !strings.Contains(err.Error(), "non-public address 127.0.0.2") {
+		t.Errorf("redirect to 127.0.0.2: err = %v, want a refusal", err)
+	}
+	if reached.Load() {
+		t.Error("the redirect target was reached")
+	}
+}
+
+func TestFileProviderStaysInRoot(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	doc := []byte("inside\n")
+	writeFile(t, filepath.Join(root, "doc.txt"), doc)
+	writeFile(t, filepath.Join(outside, "secret.txt"), []byte("outside\n"))
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "escape.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	useProvider(t, "file", &fileProvider{root: root})
+
+	if err := verifyContent(context.Background(), "", "file://"+filepath.Join(root, "doc.txt"), sha256Hex(doc)); err != nil {
+		t.Errorf("file inside root rejected: %v", err)
+	}
+	for name, want := range map[string]string{
+		filepath.Join(root, "escape.txt"):                      "outside LOCKB0X_FILE_ROOT",
+		root + "/../" + filepath.Base(outside) + "/secret.txt": "outside LOCKB0X_FILE_ROOT",
+		filepath.Join(outside, "secret.txt"):                   "outside LOCKB0X_FILE_ROOT",
+		filepath.Join(root, "dir"):                             "not a regular file",
+	} {
+		err := verifyContent(context.Background(), "", "file://"+name, sha256Hex([]byte("outside\n")))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", name, err, want)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path string, b []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
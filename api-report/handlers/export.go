@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"api-report/codex"
+
+	"github.com/lockb0x-llc/pakana-node-0/pkg/logging"
+	"github.com/stellar/go-stellar-sdk/keypair"
+)
+
+// signingKey signs exported Codex entries, set by InitSigningKey
+var signingKey *keypair.Full
+
+// InitSigningKey loads the node's ed25519 export key from LOCKB0X_SIGNING_SEED or from
+// LOCKB0X_SIGNING_KEY_FILE, generating the file on first start. Exports are disabled
+// when neither is set.
+func InitSigningKey() {
+	seed := os.Getenv("LOCKB0X_SIGNING_SEED")
+	path := os.Getenv("LOCKB0X_SIGNING_KEY_FILE")
+
+	if seed == "" && path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			seed = strings.TrimSpace(string(data))
+		case os.IsNotExist(err):
+			kp, err := keypair.Random()
+			if err != nil {
+				logging.Fatal("Failed to generate signing key", "error", err)
+			}
+			if err := os.WriteFile(path, []byte(kp.Seed()+"\n"), 0600); err != nil {
+				logging.Fatal("Failed to write signing key", "path", path, "error", err)
+			}
+			slog.Info("Generated Lockb0x signing key", "path", path)
+			seed = kp.Seed()
+		default:
+			logging.Fatal("Failed to read signing key", "path", path, "error", err)
+		}
+	}
+	if seed == "" {
+		slog.Info("No Lockb0x signing key configured, exports disabled")
+		return
+	}
+
+	kp, err := keypair.ParseFull(seed)
+	if err != nil {
+		logging.Fatal("Invalid Lockb0x signing key", "error", err)
+	}
+	signingKey = kp
+	slog.Info("Lockb0x exports signed", "public_key", kp.Address())
+}
+
+// GetSigningKey publishes the public half of the export key, for pinning by verifiers
+func GetSigningKey(w http.ResponseWriter, r *http.Request) {
+	if signingKey == nil {
+		sendError(w, "Signing key not configured", http.StatusServiceUnavailable)
+		return
+	}
+	sendJSON(w, map[string]string{
+		"algorithm":  "ed25519",
+		"public_key": signingKey.Address(),
+	})
+}
+
+// ExportLockb0x returns the record as a signed, canonical codex.SignedEntry. Anchored
+// records include the transaction envelope and ledger proof.
+func ExportLockb0x(w http.ResponseWriter, r *http.Request) {
+	hash := getPathVar(r, "hash")
+	if !isPointerHash(hash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+	if signingKey == nil {
+		sendError(w, "Signing key not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	record, err := fetchLockb0xRecord(conn, hash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	entry := codexEntry(record)
+	entry.ExportedAt = time.Now().Unix()
+	entry.Attestations = storedAttestations(conn, hash)
+
+	// A revoked record keeps the proof of its original anchor; the revocation shows in Status
+	anchored := record.Status == Lockb0xAnchored || record.Revocation != nil && record.Revocation.OnChain
+	if anchored && record.TxHash != "" {
+		proof, ok := lockb0xProof(w, r, conn, hash, record, "")
+		if !ok {
+			return
+		}
+		closedAt, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", proof.Ledger.ClosedAt)
+		if proof.Verified && err != nil {
+			slog.Error("Ledger close time is not readable", "hash", hash, "ledger", proof.Ledger.Sequence, "closed_at", proof.Ledger.ClosedAt)
+			sendError(w, "Ledger close time is not readable", http.StatusInternalServerError)
+			return
+		}
+		if proof.Verified {
+			entry.Anchor = &codex.Anchor{
+				TxHash:            proof.Transaction.Hash,
+				Commitment:        proof.Commitment,
+				EnvelopeXDR:       proof.Transaction.EnvelopeXDR,
+				NetworkPassphrase: proof.NetworkPassphrase,
+				Ledger:            proof.Ledger.Sequence,
+				LedgerHash:        proof.Ledger.Hash,
+				LedgerClosedAt:    closedAt.UTC().Format(time.RFC3339),
+			}
+		}
+	}
+
+	doc, err := codex.Sign(entry, signingKey)
+	if err != nil {
+		sendError(w, "Failed to sign entry", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="lockb0x-`+hash+`.json"`)
+	sendJSON(w, doc)
+}
+
+// codexEntry is the portable form of record, without anchor or attestations
+func codexEntry(record *Lockb0xRecord) codex.Entry {
+	return codex.Entry{
+		Version:       codex.FormatVersion,
+		PointerHash:   record.PointerHash,
+		Location:      record.URL,
+		Description:   record.Description,
+		Provider:      record.Provider,
+		Status:        record.Status,
+		CreatedAt:     record.Timestamp,
+		Batch:         record.Batch,
+		RecordVersion: record.Version,
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"sync"
+)
+
+var errPanicked = errors.New("shared call panicked")
+
+// flightCall is an in-progress or completed flightGroup.do call
+type flightCall struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+// flightGroup de-duplicates concurrent work by key (singleflight): the first caller
+// runs fn, later callers for the same key wait for and share its result.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do runs fn once per key at a time. shared reports whether the result came from
+// another caller's execution.
+func (g *flightGroup) do(key string, fn func() error) (err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.err, true
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	// Release waiters even if fn panics (net/http recovers handler panics), and give
+	// them an error rather than a nil that would read as success
+	c.err = errPanicked
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+
+	c.err = fn()
+	return c.err, false
+}
@@ -1,9 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
@@ -11,44 +12,43 @@ import (
 	"sync"
 	"time"
 
+	"github.com/lockb0x-llc/pakana-node-0/pkg/tracing"
 	"github.com/stellar/go-stellar-sdk/clients/horizonclient"
+	"github.com/stellar/go-stellar-sdk/protocols/horizon"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"lang.yottadb.com/go/yottadb/v2"
 )
 
-var hzClient *horizonclient.Client
-var ydbConn *yottadb.Conn
-var ydbMu sync.Mutex
+// connPool gives each goroutine its own YottaDB connection, since a Conn must never be
+// used by two goroutines at once. The YottaDB engine is single-threaded within a process,
+// so database calls from all goroutines still run one at a time; what the pool removes
+// is the shared mutex that also held them behind in-flight Horizon requests.
+var connPool = sync.Pool{
+	New: func() interface{} { return yottadb.NewConn() },
+}
+
+// hydrations de-duplicates concurrent Horizon fetches for the same key
+var hydrations flightGroup
 
-// InitYDB initializes the YottaDB connection
+// InitYDB initializes the YottaDB connection pool, seeding it with conn
 func InitYDB(conn *yottadb.Conn) {
 	gbldir := os.Getenv("ydb_gbldir")
 	if gbldir == "" {
 		gbldir = "/data/r2.03_x86_64/g/yottadb.gld"
 	}
 	os.Setenv("ydb_gbldir", gbldir)
-	ydbConn = conn
-	log.Printf("YottaDB v2 initialized in handlers with gbldir: %s", gbldir)
+	connPool.Put(conn)
+	slog.Info("YottaDB v2 initialized in handlers", "gbldir", gbldir)
 }
 
-// InitHorizon initializes the Horizon client
-func InitHorizon() {
-	horizonURL := os.Getenv("HORIZON_URL")
-	if horizonURL == "" {
-		horizonURL = "https://horizon-testnet.stellar.org"
-	}
-	hzClient = &horizonclient.Client{
-		HorizonURL: horizonURL,
-		HTTP:       &http.Client{Timeout: 30 * time.Second},
-	}
-	log.Printf("Horizon client initialized with URL: %s", horizonURL)
+// acquireConn takes a connection from the pool; release it with releaseConn when done
+func acquireConn() *yottadb.Conn {
+	return connPool.Get().(*yottadb.Conn)
 }
 
-// SetHorizonURL updates the Horizon client to use a specific URL
-func SetHorizonURL(url string) {
-	hzClient = &horizonclient.Client{
-		HorizonURL: url,
-		HTTP:       &http.Client{Timeout: 10 * time.Second},
-	}
+func releaseConn(conn *yottadb.Conn) {
+	connPool.Put(conn)
 }
 
 // AccountResponse represents an account's data
@@ -77,9 +77,11 @@ type LedgerResponse struct {
 }
 
 type TransactionResponse struct {
-	Hash      string `json:"hash"`
-	LedgerSeq int64  `json:"ledger_seq"`
-	XDR       string `json:"xdr,omitempty"`
+	Hash       string `json:"hash"`
+	LedgerSeq  int64  `json:"ledger_seq"`
+	XDR        string `json:"xdr,omitempty"`
+	ResultXDR  string `json:"result_xdr,omitempty"`
+	Successful *bool  `json:"successful,omitempty"` // nil when not recorded
 }
 
 type ErrorResponse struct {
@@ -105,24 +107,30 @@ func GetAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conn := yottadb.NewConn()
+	conn := acquireConn()
+	defer releaseConn(conn)
+	net := networkOf(r.Context())
 
 	// 1. Try to fetch locally
-	account, err := fetchAccount(conn, accountID, true)
+	account, err := fetchAccount(conn, net, accountID, true)
+	recordLookup("account", err == nil)
 	if err == nil {
 		sendJSON(w, account)
 		return
 	}
 
 	// 2. Not found locally - Perform Native Hydration
-	log.Printf("Account %s not found in YottaDB. Performing native hydration...", accountID)
-	if err := hydrateAccount(conn, accountID); err != nil {
+	if !allowHydration(w, r) {
+		return
+	}
+	requestLogger(r).Info("Account not found in YottaDB, hydrating from Horizon", "account", accountID)
+	if err := hydrateAccount(r.Context(), accountID); err != nil {
 		sendError(w, fmt.Sprintf("Hydration failed: %v", err), http.StatusNotFound)
 		return
 	}
 
 	// 3. Retry local fetch after hydration
-	account, err = fetchAccount(conn, accountID, true)
+	account, err = fetchAccount(conn, net, accountID, true)
 	if err != nil {
 		sendError(w, "Account not found after hydration", http.StatusNotFound)
 		return
@@ -138,13 +146,18 @@ func GetAccountBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ydbMu.Lock()
-	defer ydbMu.Unlock()
+	conn := acquireConn()
+	defer releaseConn(conn)
+	net := networkOf(r.Context())
 
-	account, err := fetchAccount(ydbConn, accountID, false)
+	account, err := fetchAccount(conn, net, accountID, false)
+	recordLookup("account", err == nil)
 	if err != nil {
-		if err := hydrateAccount(ydbConn, accountID); err == nil {
-			account, err = fetchAccount(ydbConn, accountID, false)
+		if !allowHydration(w, r) {
+			return
+		}
+		if err := hydrateAccount(r.Context(), accountID); err == nil {
+			account, err = fetchAccount(conn, net, accountID, false)
 		}
 	}
 
@@ -170,13 +183,18 @@ func GetAccountTrustlines(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ydbMu.Lock()
-	defer ydbMu.Unlock()
+	conn := acquireConn()
+	defer releaseConn(conn)
+	net := networkOf(r.Context())
 
-	trustlines, err := fetchTrustlines(ydbConn, accountID)
+	trustlines, err := fetchTrustlines(conn, net, accountID)
+	recordLookup("account", err == nil && len(trustlines) > 0)
 	if err != nil || len(trustlines) == 0 {
-		if err := hydrateAccount(ydbConn, accountID); err == nil {
-			trustlines, _ = fetchTrustlines(ydbConn, accountID)
+		if !allowHydration(w, r) {
+			return
+		}
+		if err := hydrateAccount(r.Context(), accountID); err == nil {
+			trustlines, _ = fetchTrustlines(conn, net, accountID)
 		}
 	}
 // ...
@@ -188,10 +206,11 @@ func GetAccountTrustlines(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetLatestLedger(w http.ResponseWriter, r *http.Request) {
-	ydbMu.Lock()
-	defer ydbMu.Unlock()
+	conn := acquireConn()
+	defer releaseConn(conn)
+	net := networkOf(r.Context())
 
-	ledger, err := fetchLatestLedger(ydbConn)
+	ledger, err := fetchLatestLedger(conn, net)
 	if err != nil {
 		sendError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -208,25 +227,30 @@ func GetLedger(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ydbMu.Lock()
-	defer ydbMu.Unlock()
+	conn := acquireConn()
+	defer releaseConn(conn)
+	net := networkOf(r.Context())
 
 	// 1. Try local
-	ledger, err := fetchLedger(ydbConn, seq)
+	ledger, err := fetchLedger(conn, net, seq)
+	recordLookup("ledger", err == nil)
 	if err == nil {
 		sendJSON(w, ledger)
 		return
 	}
 
 	// 2. Hydrate
-	log.Printf("Ledger %d not found locally. Fetching from Horizon...", seq)
-	if err := hydrateLedger(ydbConn, seq); err != nil {
+	if !allowHydration(w, r) {
+		return
+	}
+	requestLogger(r).Info("Ledger not found locally, hydrating from Horizon", "ledger", seq)
+	if err := hydrateLedger(r.Context(), seq); err != nil {
 		sendError(w, fmt.Sprintf("Ledger hydration failed: %v", err), http.StatusNotFound)
 		return
 	}
 
 	// 3. Retry local
-	ledger, err = fetchLedger(ydbConn, seq)
+	ledger, err = fetchLedger(conn, net, seq)
 	if err != nil {
 		sendError(w, "Ledger not found after hydration", http.StatusNotFound)
 		return
@@ -242,25 +266,30 @@ func GetTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ydbMu.Lock()
-	defer ydbMu.Unlock()
+	conn := acquireConn()
+	defer releaseConn(conn)
+	net := networkOf(r.Context())
 
 	// 1. Try local
-	tx, err := fetchTransaction(ydbConn, hash)
+	tx, err := fetchTransaction(conn, net, hash)
+	recordLookup("transaction", err == nil)
 	if err == nil {
 		sendJSON(w, tx)
 		return
 	}
 
 	// 2. Hydrate
-	log.Printf("Transaction %s not found locally. Fetching from Horizon...", hash)
-	if err := hydrateTransaction(ydbConn, hash); err != nil {
+	if !allowHydration(w, r) {
+		return
+	}
+	requestLogger(r).Info("Transaction not found locally, hydrating from Horizon", "tx_hash", hash)
+	if err := hydrateTransaction(r.Context(), hash); err != nil {
 		sendError(w, fmt.Sprintf("Transaction hydration failed: %v", err), http.StatusNotFound)
 		return
 	}
 
 	// 3. Retry local
-	tx, err = fetchTransaction(ydbConn, hash)
+	tx, err = fetchTransaction(conn, net, hash)
 	if err != nil {
 		sendError(w, "Transaction not found after hydration", http.StatusNotFound)
 		return
@@ -278,12 +307,27 @@ func getPathVar(r *http.Request, key string) string {
 		if len(parts) >= 5 && parts[3] == "accounts" {
 			return parts[4]
 		}
+		if len(parts) >= 6 && parts[3] == "stream" && parts[4] == "accounts" {
+			return parts[5]
+		}
 	case "seq":
 		if len(parts) >= 5 && parts[3] == "ledgers" {
 			return parts[4]
 		}
+	case "webhook":
+		if len(parts) >= 5 && parts[3] == "webhooks" {
+			return parts[4]
+		}
+	case "key":
+		if len(parts) >= 6 && parts[3] == "admin" && parts[4] == "keys" {
+			return parts[5]
+		}
+	case "batch":
+		if len(parts) >= 6 && parts[3] == "lockb0x" && parts[4] == "batches" {
+			return parts[5]
+		}
 	case "hash":
-		if len(parts) >= 5 && parts[3] == "transactions" {
+		if len(parts) >= 5 && (parts[3] == "transactions" || parts[3] == "lockb0x") {
 			return parts[4]
 		}
 	}
@@ -301,120 +345,172 @@ func sendError(w http.ResponseWriter, message string, code int) {
 	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
 }
 
-// hydrateAccount fetches account data from Horizon and persists to YottaDB
-func hydrateAccount(conn *yottadb.Conn, accountID string) error {
-	log.Printf("[TRACE] hydrateAccount: Fetching %s from Horizon", accountID)
-	// 1. Fetch from Horizon
-	accountReq := horizonclient.AccountRequest{AccountID: accountID}
-	hAccount, err := hzClient.AccountDetail(accountReq)
-	if err != nil {
-		return fmt.Errorf("horizon error: %v", err)
-	}
-	log.Printf("[TRACE] hydrateAccount: Horizon return %s (Seq: %d)", accountID, hAccount.Sequence)
-
-	// 2. Persist to YottaDB via Transaction (Atomic write)
-	log.Printf("[TRACE] hydrateAccount: Starting YottaDB Transaction for %s", accountID)
-	ok := conn.Transaction("", nil, func() int {
-		accountNode := conn.Node("^Account", accountID)
-
-		// Store balances
-			var trustlineKeys []string
-			for _, bal := range hAccount.Balances {
-				if bal.Asset.Type == "native" {
-					accountNode.Child("balance").Set(bal.Balance)
-				} else {
-					assetCode := bal.Asset.Code
-					if assetCode == "" {
-						assetCode = bal.Asset.Type
+// hydrateAccount fetches account data from Horizon and persists to YottaDB.
+// Concurrent misses for the same account share one Horizon call, and no YottaDB
+// connection is held while waiting on Horizon.
+func hydrateAccount(ctx context.Context, accountID string) error {
+	ctx, span := tracer.Start(ctx, "hydrate account", trace.WithAttributes(attribute.String("stellar.account", accountID)))
+	net := networkOf(ctx)
+	err, shared := hydrations.do(net.name+":account:"+accountID, func() (err error) {
+		defer func() { recordHydration("account", err) }()
+		slog.Debug("hydrateAccount: fetching from Horizon", "account", accountID)
+		// 1. Fetch from Horizon
+		accountReq := horizonclient.AccountRequest{AccountID: accountID}
+		var hAccount horizon.Account
+		err = tracing.Horizon(ctx, tracer, "account", func() (err error) {
+			hAccount, err = net.client.AccountDetail(accountReq)
+			return err
+		}, horizonServer(net))
+		if err != nil {
+			return fmt.Errorf("horizon error: %v", err)
+		}
+		slog.Debug("hydrateAccount: Horizon returned account", "account", accountID, "seq_num", hAccount.Sequence)
+
+		// 2. Persist to YottaDB via Transaction (Atomic write)
+		conn := acquireConn()
+		defer releaseConn(conn)
+
+		ok := transaction(ctx, conn, "hydrate account", func() int {
+			accountNode := conn.Node(net.account, accountID)
+
+			// Store balances
+				var trustlineKeys []string
+				for _, bal := range hAccount.Balances {
+					if bal.Asset.Type == "native" {
+						accountNode.Child("balance").Set(bal.Balance)
+					} else {
+						assetCode := bal.Asset.Code
+						if assetCode == "" {
+							assetCode = bal.Asset.Type
+						}
+						// Store flat index for iteration-free retrieval
+						key := assetCode + ":" + bal.Issuer
+						trustlineKeys = append(trustlineKeys, key)
+
+						accountNode.Child("trustlines", assetCode, bal.Issuer, "balance").Set(bal.Balance)
+						accountNode.Child("trustlines", assetCode, bal.Issuer, "limit").Set(bal.Limit)
 					}
-					// Store flat index for iteration-free retrieval
-					key := assetCode + ":" + bal.Issuer
-					trustlineKeys = append(trustlineKeys, key)
-
-					accountNode.Child("trustlines", assetCode, bal.Issuer, "balance").Set(bal.Balance)
-					accountNode.Child("trustlines", assetCode, bal.Issuer, "limit").Set(bal.Limit)
 				}
-			}
-			accountNode.Child("trustline_list").Set(strings.Join(trustlineKeys, "|"))
-		accountNode.Child("seq_num").Set(hAccount.Sequence)
-		accountNode.Child("last_modified").Set(time.Now().Unix())
+				accountNode.Child("trustline_list").Set(strings.Join(trustlineKeys, "|"))
+			accountNode.Child("seq_num").Set(hAccount.Sequence)
+			accountNode.Child("last_modified").Set(time.Now().Unix())
 
-		// Mark as Tracked for Sparse History
-		conn.Node("^Tracked", accountID).Set("1")
+			// Mark as Tracked for Sparse History
+			conn.Node(net.tracked, accountID).Set("1")
 
-		return yottadb.YDB_OK
-	})
+			return yottadb.YDB_OK
+		})
 
-	if !ok {
-		return fmt.Errorf("yottadb transaction failed")
-	}
+		if !ok {
+			return fmt.Errorf("yottadb transaction failed")
+		}
 
-	log.Printf("[TRACE] hydrateAccount: Transaction committed for %s", accountID)
-	return nil
+		slog.Debug("hydrateAccount: transaction committed", "account", accountID)
+		return nil
+	})
+	span.SetAttributes(attribute.Bool("hydration.shared", shared))
+	tracing.End(span, err)
+	return err
 }
 
 // hydrateLedger fetches a ledger from Horizon and persists to YottaDB
-func hydrateLedger(conn *yottadb.Conn, seq int64) error {
-	hLedger, err := hzClient.LedgerDetail(uint32(seq))
-	if err != nil {
-		return fmt.Errorf("horizon error: %v", err)
-	}
-
-	seqStr := strconv.FormatInt(seq, 10)
-	ok := conn.Transaction("", nil, func() int {
-		ledgerNode := conn.Node("^Stellar", "ledger", seqStr)
-		ledgerNode.Child("closed_at").Set(hLedger.ClosedAt.String())
-		
-		totalTx := hLedger.SuccessfulTransactionCount
-		if hLedger.FailedTransactionCount != nil {
-			totalTx += *hLedger.FailedTransactionCount
+func hydrateLedger(ctx context.Context, seq int64) error {
+	ctx, span := tracer.Start(ctx, "hydrate ledger", trace.WithAttributes(attribute.Int64("stellar.ledger", seq)))
+	net := networkOf(ctx)
+	err, shared := hydrations.do(net.name+":ledger:"+strconv.FormatInt(seq, 10), func() (err error) {
+		defer func() { recordHydration("ledger", err) }()
+		var hLedger horizon.Ledger
+		err = tracing.Horizon(ctx, tracer, "ledger", func() (err error) {
+			hLedger, err = net.client.LedgerDetail(uint32(seq))
+			return err
+		}, horizonServer(net))
+		if err != nil {
+			return fmt.Errorf("horizon error: %v", err)
 		}
-		ledgerNode.Child("total_tx_count").Set(totalTx)
 
-		latestSeqStr := conn.Node("^Stellar", "latest").Get("0")
-		latestSeq, _ := strconv.ParseInt(latestSeqStr, 10, 64)
-		if seq > latestSeq {
-			conn.Node("^Stellar", "latest").Set(seqStr)
-		}
+		seqStr := strconv.FormatInt(seq, 10)
+		conn := acquireConn()
+		defer releaseConn(conn)
 
-		return yottadb.YDB_OK
-	})
+		ok := transaction(ctx, conn, "hydrate ledger", func() int {
+			ledgerNode := conn.Node(net.stellar, "ledger", seqStr)
+			ledgerNode.Child("closed_at").Set(hLedger.ClosedAt.String())
+			ledgerNode.Child("hash").Set(hLedger.Hash)
 
-	if !ok {
-		return fmt.Errorf("yottadb transaction failed")
-	}
+			totalTx := hLedger.SuccessfulTransactionCount
+			if hLedger.FailedTransactionCount != nil {
+				totalTx += *hLedger.FailedTransactionCount
+			}
+			ledgerNode.Child("total_tx_count").Set(totalTx)
+
+			latestSeqStr := conn.Node(net.stellar, "latest").Get("0")
+			latestSeq, _ := strconv.ParseInt(latestSeqStr, 10, 64)
+			if seq > latestSeq {
+				conn.Node(net.stellar, "latest").Set(seqStr)
+			}
+
+			return yottadb.YDB_OK
+		})
+
+		if !ok {
+			return fmt.Errorf("yottadb transaction failed")
+		}
 
-	return nil
+		return nil
+	})
+	span.SetAttributes(attribute.Bool("hydration.shared", shared))
+	tracing.End(span, err)
+	return err
 }
 
 // hydrateTransaction fetches a transaction from Horizon and persists to YottaDB
-func hydrateTransaction(conn *yottadb.Conn, hash string) error {
-	hTx, err := hzClient.TransactionDetail(hash)
-	if err != nil {
-		return fmt.Errorf("horizon error: %v", err)
-	}
+func hydrateTransaction(ctx context.Context, hash string) error {
+	ctx, span := tracer.Start(ctx, "hydrate transaction", trace.WithAttributes(attribute.String("stellar.tx_hash", hash)))
+	net := networkOf(ctx)
+	err, shared := hydrations.do(net.name+":tx:"+hash, func() (err error) {
+		defer func() { recordHydration("transaction", err) }()
+		var hTx horizon.Transaction
+		err = tracing.Horizon(ctx, tracer, "transaction", func() (err error) {
+			hTx, err = net.client.TransactionDetail(hash)
+			return err
+		}, horizonServer(net))
+		if err != nil {
+			return fmt.Errorf("horizon error: %v", err)
+		}
 
-	seqStr := strconv.FormatInt(int64(hTx.Ledger), 10)
-	ok := conn.Transaction("", nil, func() int {
-		conn.Node("^Stellar", "tx_hash", hash).Set(seqStr)
-		
-		// Use a hydrated slot to avoid index collisions
-		txNode := conn.Node("^Stellar", "ledger", seqStr, "tx", "hydrated", hash)
-		txNode.Child("xdr").Set(hTx.EnvelopeXdr)
-		txNode.Child("hash").Set(hash)
+		seqStr := strconv.FormatInt(int64(hTx.Ledger), 10)
+		conn := acquireConn()
+		defer releaseConn(conn)
 
-		return yottadb.YDB_OK
-	})
+		ok := transaction(ctx, conn, "hydrate transaction", func() int {
+			conn.Node(net.stellar, "tx_hash", hash).Set(seqStr)
+		
+			// Use a hydrated slot to avoid index collisions
+			txNode := conn.Node(net.stellar, "ledger", seqStr, "tx", "hydrated", hash)
+			txNode.Child("xdr").Set(hTx.EnvelopeXdr)
+			txNode.Child("hash").Set(hash)
+			// Unlike the ingested ledger slots, a hydrated transaction may have failed
+			txNode.Child("result_xdr").Set(hTx.ResultXdr)
+			txNode.Child("successful").Set(strconv.FormatBool(hTx.Successful))
+			// Dates the ledger for api-go's retention policy when it has no header
+			txNode.Child("created_at").Set(hTx.LedgerCloseTime.Unix())
+
+			return yottadb.YDB_OK
+		})
 
-	if !ok {
-		return fmt.Errorf("yottadb transaction failed")
-	}
+		if !ok {
+			return fmt.Errorf("yottadb transaction failed")
+		}
 
-	return nil
+		return nil
+	})
+	span.SetAttributes(attribute.Bool("hydration.shared", shared))
+	tracing.End(span, err)
+	return err
 }
 
-func fetchAccount(conn *yottadb.Conn, accountID string, includeTrustlines bool) (*AccountResponse, error) {
-	node := conn.Node("^Account", accountID)
+func fetchAccount(conn *yottadb.Conn, net *stellarNetwork, accountID string, includeTrustlines bool) (*AccountResponse, error) {
+	node := conn.Node(net.account, accountID)
 
 	// Check if account exists
 	if !node.HasTree() && !node.HasValue() {
@@ -448,17 +544,17 @@ func fetchAccount(conn *yottadb.Conn, accountID string, includeTrustlines bool)
 	}
 
 	if includeTrustlines {
-		trustlines, _ := fetchTrustlines(conn, accountID)
+		trustlines, _ := fetchTrustlines(conn, net, accountID)
 		response.Trustlines = trustlines
 	}
 	return response, nil
 }
 
-func fetchTrustlines(conn *yottadb.Conn, accountID string) ([]TrustlineResponse, error) {
+func fetchTrustlines(conn *yottadb.Conn, net *stellarNetwork, accountID string) ([]TrustlineResponse, error) {
 	var trustlines []TrustlineResponse
 
 	// Standard Schema: ^Account(id, "trustlines", code, issuer, "balance")
-	accountNode := conn.Node("^Account", accountID)
+	accountNode := conn.Node(net.account, accountID)
 	tlList := accountNode.Child("trustline_list").Get("")
 	if tlList == "" {
 		return nil, nil
@@ -486,20 +582,20 @@ func fetchTrustlines(conn *yottadb.Conn, accountID string) ([]TrustlineResponse,
 	return trustlines, nil
 }
 
-func fetchLatestLedger(conn *yottadb.Conn) (*LedgerResponse, error) {
+func fetchLatestLedger(conn *yottadb.Conn, net *stellarNetwork) (*LedgerResponse, error) {
 	// Root latest pointer
-	latestSeqStr := conn.Node("^Stellar", "latest").Get("")
+	latestSeqStr := conn.Node(net.stellar, "latest").Get("")
 	if latestSeqStr == "" {
 		return nil, fmt.Errorf("no ledgers found")
 	}
 
 	seq, _ := strconv.ParseInt(latestSeqStr, 10, 64)
-	return fetchLedger(conn, seq)
+	return fetchLedger(conn, net, seq)
 }
 
-func fetchLedger(conn *yottadb.Conn, seq int64) (*LedgerResponse, error) {
+func fetchLedger(conn *yottadb.Conn, net *stellarNetwork, seq int64) (*LedgerResponse, error) {
 	seqStr := strconv.FormatInt(seq, 10)
-	ledgerNode := conn.Node("^Stellar", "ledger", seqStr)
+	ledgerNode := conn.Node(net.stellar, "ledger", seqStr)
 
 	closedAt := ledgerNode.Child("closed_at").Get("")
 	if closedAt == "" {
@@ -529,37 +625,48 @@ func fetchLedger(conn *yottadb.Conn, seq int64) (*LedgerResponse, error) {
 	}, nil
 }
 
-func fetchTransaction(conn *yottadb.Conn, hash string) (*TransactionResponse, error) {
+func fetchTransaction(conn *yottadb.Conn, net *stellarNetwork, hash string) (*TransactionResponse, error) {
 	// 1. Try Direct Index Lookup: ^Stellar("tx_hash", hash) = ledger_seq
-	seqStr := conn.Node("^Stellar", "tx_hash", hash).Get("")
+	seqStr := conn.Node(net.stellar, "tx_hash", hash).Get("")
 
 	if seqStr == "" {
 		return nil, fmt.Errorf("transaction not found locally")
 	}
 
-	// 2. Try the normal ledger index (pos)
+	// 2. Try the normal ledger index (pos). The ingestor and backfill only store
+	// successful transactions, as Horizon omits failed ones from ledger and account
+	// listings.
 	lSeq, _ := strconv.ParseInt(seqStr, 10, 64)
-	ledgerNode := conn.Node("^Stellar", "ledger", seqStr, "tx")
+	ledgerNode := conn.Node(net.stellar, "ledger", seqStr, "tx")
 	txNode := ledgerNode.Child("").Next()
 	for txNode != nil {
 		if txNode.Child("hash").Get("") == hash {
+			successful := true
 			return &TransactionResponse{
-				Hash:      hash,
-				LedgerSeq: lSeq,
-				XDR:       txNode.Child("xdr").Get(""),
+				Hash:       hash,
+				LedgerSeq:  lSeq,
+				XDR:        txNode.Child("xdr").Get(""),
+				ResultXDR:  txNode.Child("result_xdr").Get(""),
+				Successful: &successful,
 			}, nil
 		}
 		txNode = txNode.Next()
 	}
 
-	// 3. Try the hydrated slot
-	hydratedNode := conn.Node("^Stellar", "ledger", seqStr, "tx", "hydrated", hash)
+	// 3. Try the hydrated slot; transactions hydrated before results were recorded
+	// have no successful flag
+	hydratedNode := conn.Node(net.stellar, "ledger", seqStr, "tx", "hydrated", hash)
 	if hydratedNode.HasTree() || hydratedNode.HasValue() {
-		return &TransactionResponse{
+		tx := &TransactionResponse{
 			Hash:      hash,
 			LedgerSeq: lSeq,
 			XDR:       hydratedNode.Child("xdr").Get(""),
-		}, nil
+			ResultXDR: hydratedNode.Child("result_xdr").Get(""),
+		}
+		if successful, err := strconv.ParseBool(hydratedNode.Child("successful").Get("")); err == nil {
+			tx.Successful = &successful
+		}
+		return tx, nil
 	}
 
 	return nil, fmt.Errorf("transaction hash index exists but record missing")
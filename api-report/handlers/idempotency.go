@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// Idempotency keys for draft creation live at ^Codex("idempotency", keyID, key) with the
+// hash, the request they were first used with, and created_at. They are scoped by the
+// API key that sent them, so clients cannot replay or probe each other's keys. Expired
+// keys are overwritten on reuse and purged by a periodic sweep.
+
+// idempotencyTTL is how long a key is remembered, set by InitIdempotencyKeys
+var idempotencyTTL = 24 * time.Hour
+
+const idempotencySweepInterval = time.Hour
+
+// FieldDiff is one field of a conflicting draft request
+type FieldDiff struct {
+	Stored    interface{} `json:"stored"`
+	Requested interface{} `json:"requested"`
+}
+
+// DraftConflictResponse is the 409 body for a create that doesn't match what's stored
+type DraftConflictResponse struct {
+	Error string               `json:"error"`
+	Hash  string               `json:"hash"`
+	Diff  map[string]FieldDiff `json:"diff"`
+}
+
+// InitIdempotencyKeys reads LOCKB0X_IDEMPOTENCY_TTL
+func InitIdempotencyKeys() {
+	if ttl, err := time.ParseDuration(os.Getenv("LOCKB0X_IDEMPOTENCY_TTL")); err == nil && ttl > 0 {
+		idempotencyTTL = ttl
+	}
+	go func() {
+		for range time.Tick(idempotencySweepInterval) {
+			sweepIdempotencyKeys()
+		}
+	}()
+	slog.Info("Lockb0x idempotency keys configured", "ttl", idempotencyTTL.String())
+}
+
+// idempotencyScope is the API key an Idempotency-Key belongs to
+func idempotencyScope(r *http.Request) string {
+	if key := APIKeyFromContext(r.Context()); key != nil {
+		return key.ID
+	}
+	return "-"
+}
+
+// sweepIdempotencyKeys purges expired keys
+func sweepIdempotencyKeys() {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	purged := 0
+	for scope := range conn.Node("^Codex", "idempotency").Children() {
+		for keyNode := range scope.Children() {
+			// The transaction may run more than once, so count it once it has committed
+			killed := false
+			ok := conn.Transaction("", nil, func() int {
+				killed = idempotencyExpired(keyNode)
+				if killed {
+					keyNode.Kill()
+				}
+				return yottadb.YDB_OK
+			})
+			if ok && killed {
+				purged++
+			}
+		}
+	}
+	if purged > 0 {
+		slog.Info("Purged expired idempotency keys", "count", purged)
+	}
+}
+
+func idempotencyExpired(keyNode *yottadb.Node) bool {
+	createdAt, err := strconv.ParseInt(keyNode.Child("created_at").Get(""), 10, 64)
+	return err != nil || time.Since(time.Unix(createdAt, 0)) > idempotencyTTL
+}
+
+// validIdempotencyKey accepts an absent key or 1-255 printable ASCII characters
+func validIdempotencyKey(key string) bool {
+	if len(key) > 255 {
+		return false
+	}
+	for _, c := range key {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupIdempotencyKey returns the request an unexpired key was first used with
+func lookupIdempotencyKey(conn *yottadb.Conn, scope, key string) (*Lockb0xRequest, string, bool) {
+	keyNode := conn.Node("^Codex", "idempotency", scope, key)
+	if idempotencyExpired(keyNode) {
+		return nil, "", false
+	}
+	var stored Lockb0xRequest
+	if err := json.Unmarshal([]byte(keyNode.Child("request").Get("{}")), &stored); err != nil {
+		return nil, "", false
+	}
+	return &stored, keyNode.Child("hash").Get(""), true
+}
+
+// saveIdempotencyKey remembers the request a key was used with, unless an unexpired
+// entry exists. Call inside a transaction.
+func saveIdempotencyKey(conn *yottadb.Conn, scope, key string, req *Lockb0xRequest) {
+	if _, _, ok := lookupIdempotencyKey(conn, scope, key); ok {
+		return
+	}
+	raw, _ := json.Marshal(Lockb0xRequest{
+		PointerHash: req.PointerHash,
+		URL:         req.URL,
+		Description: req.Description,
+		Provider:    req.Provider,
+		Batch:       req.Batch,
+	})
+
+	keyNode := conn.Node("^Codex", "idempotency", scope, key)
+	keyNode.Kill()
+	keyNode.Child("hash").Set(req.PointerHash)
+	keyNode.Child("request").Set(string(raw))
+	keyNode.Child("created_at").Set(time.Now().Unix())
+}
+
+// recordRequest is the create request a stored record corresponds to
+func recordRequest(record *Lockb0xRecord) *Lockb0xRequest {
+	return &Lockb0xRequest{
+		PointerHash: record.PointerHash,
+		URL:         record.URL,
+		Description: record.Description,
+		Provider:    record.Provider,
+		Batch:       record.Batch != nil || record.Status == Lockb0xQueued,
+	}
+}
+
+// draftDiff compares the fields that define a draft. verify and attesters only affect
+// how a draft is created, so they are not compared.
+func draftDiff(stored, req *Lockb0xRequest) map[string]FieldDiff {
+	diff := map[string]FieldDiff{}
+	for field, values := range map[string][2]string{
+		"pointer_hash": {stored.PointerHash, req.PointerHash},
+		"url":          {stored.URL, req.URL},
+		"description":  {stored.Description, req.Description},
+		"provider":     {stored.Provider, req.Provider},
+	} {
+		if values[0] != values[1] {
+			diff[field] = FieldDiff{Stored: values[0], Requested: values[1]}
+		}
+	}
+	if stored.Batch != req.Batch {
+		diff["batch"] = FieldDiff{Stored: stored.Batch, Requested: req.Batch}
+	}
+	return diff
+}
+
+func sendDraftConflict(w http.ResponseWriter, message, hash string, diff map[string]FieldDiff) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(DraftConflictResponse{Error: message, Hash: hash, Diff: diff})
+}
@@ -0,0 +1,603 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api-report/codex"
+
+	"github.com/stellar/go-stellar-sdk/txnbuild"
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// Every change to a Lockb0x record is appended to ^Codex("events", hash): the node holds
+// the event count and ^Codex("events", hash, n) holds type, at and data (JSON). Records
+// are never rewritten without an event, so the log is the record's full history.
+
+// Lockb0xEvent is one entry in a record's event log
+type Lockb0xEvent struct {
+	Seq  int64                  `json:"seq"`
+	Type string                 `json:"type"`
+	At   int64                  `json:"at"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// Lockb0xRevocation tracks the revocation of a record. Unanchored drafts are revoked
+// locally; anchored records are revoked by a lockb0x_revoke manageData transaction,
+// confirmed by core-rust like an anchor.
+type Lockb0xRevocation struct {
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	RequestedAt int64  `json:"requested_at"`
+	OnChain     bool   `json:"on_chain"`
+	TxHash      string `json:"tx_hash,omitempty"`
+	Ledger      int64  `json:"ledger,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ErrorCodes  string `json:"error_codes,omitempty"`
+}
+
+// Lockb0xUpdateRequest corrects a record's metadata. Omitted fields are left unchanged.
+type Lockb0xUpdateRequest struct {
+	URL         *string `json:"url,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Provider    *string `json:"provider,omitempty"`
+	Verify      *bool   `json:"verify,omitempty"` // Check a changed url's SHA-256 (default: LOCKB0X_VERIFY_CONTENT)
+	Reason      string  `json:"reason,omitempty"`
+}
+
+// Lockb0xRevokeRequest revokes a record. For anchored records, call once without xdr to
+// get the unsigned revocation transaction, then again with the signed envelope.
+type Lockb0xRevokeRequest struct {
+	Reason string `json:"reason,omitempty"`
+	XDR    string `json:"xdr,omitempty"`
+}
+
+// Lockb0xSupersedeRequest creates the replacement draft for a record
+type Lockb0xSupersedeRequest struct {
+	Lockb0xRequest
+	Reason string `json:"reason,omitempty"`
+}
+
+// codexRecordNode returns the draft or anchored node for hash, or nil if neither exists
+func codexRecordNode(conn *yottadb.Conn, hash string) *yottadb.Node {
+	if node := conn.Node("^Codex", "draft", hash); node.HasTree() {
+		return node
+	}
+	if node := conn.Node("^Codex", hash); node.HasTree() {
+		return node
+	}
+	return nil
+}
+
+// appendCodexEvent adds an event to hash's log. Call inside a transaction.
+func appendCodexEvent(conn *yottadb.Conn, hash, eventType string, data map[string]interface{}) {
+	countNode := conn.Node("^Codex", "events", hash)
+	n, _ := strconv.ParseInt(countNode.Get("0"), 10, 64)
+	n++
+	countNode.Set(n)
+
+	eventNode := countNode.Child(strconv.FormatInt(n, 10))
+	eventNode.Child("type").Set(eventType)
+	eventNode.Child("at").Set(time.Now().Unix())
+	if len(data) > 0 {
+		raw, _ := json.Marshal(data)
+		eventNode.Child("data").Set(string(raw))
+	}
+}
+
+// fetchRevocation reads the revocation subtree of a record node
+func fetchRevocation(node *yottadb.Node) *Lockb0xRevocation {
+	revNode := node.Child("revocation")
+	if !revNode.HasTree() {
+		return nil
+	}
+	requestedAt, _ := strconv.ParseInt(revNode.Child("requested_at").Get("0"), 10, 64)
+	ledger, _ := strconv.ParseInt(revNode.Child("ledger").Get("0"), 10, 64)
+	return &Lockb0xRevocation{
+		Status:      revNode.Child("status").Get(""),
+		Reason:      revNode.Child("reason").Get(""),
+		RequestedAt: requestedAt,
+		OnChain:     revNode.Child("on_chain").Get("") == "1",
+		TxHash:      revNode.Child("tx_hash").Get(""),
+		Ledger:      ledger,
+		Error:       revNode.Child("error").Get(""),
+		ErrorCodes:  revNode.Child("error_codes").Get(""),
+	}
+}
+
+// ListLockb0xEvents returns a record's event log, oldest first. ?after=<seq> skips
+// events already seen.
+func ListLockb0xEvents(w http.ResponseWriter, r *http.Request) {
+	hash := getPathVar(r, "hash")
+	if !isPointerHash(hash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+	var after int64
+	if v := r.URL.Query().Get("after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			sendError(w, "after must be a non-negative event sequence", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	countNode := conn.Node("^Codex", "events", hash)
+	if !countNode.HasValue() && codexRecordNode(conn, hash) == nil {
+		sendError(w, "Lockb0x record not found", http.StatusNotFound)
+		return
+	}
+
+	count, _ := strconv.ParseInt(countNode.Get("0"), 10, 64)
+	events := []Lockb0xEvent{}
+	for n := after + 1; n <= count; n++ {
+		eventNode := countNode.Child(strconv.FormatInt(n, 10))
+		at, _ := strconv.ParseInt(eventNode.Child("at").Get("0"), 10, 64)
+		event := Lockb0xEvent{Seq: n, Type: eventNode.Child("type").Get(""), At: at}
+		if raw := eventNode.Child("data").Get(""); raw != "" {
+			json.Unmarshal([]byte(raw), &event.Data)
+		}
+		events = append(events, event)
+	}
+
+	sendJSON(w, map[string]interface{}{
+		"pointer_hash": hash,
+		"count":        count,
+		"events":       events,
+	})
+}
+
+// UpdateLockb0x corrects the url, description or provider of a draft or anchored record.
+// The pointer hash is what is anchored, so corrections never touch the chain; the old
+// values are kept in the event log and the record's version is bumped.
+func UpdateLockb0x(w http.ResponseWriter, r *http.Request) {
+	hash := getPathVar(r, "hash")
+	if !isPointerHash(hash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+
+	var req Lockb0xUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.URL == nil && req.Description == nil && req.Provider == nil {
+		sendError(w, "Nothing to update (url, description or provider)", http.StatusBadRequest)
+		return
+	}
+	if req.URL != nil && *req.URL == "" {
+		sendError(w, "URL cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if req.Description != nil && len(*req.Description) > 300 {
+		sendError(w, "Description exceeds 300 characters", http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	current, err := fetchLockb0xRecord(conn, hash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// A changed url is re-verified against the pointer hash like a new draft's
+	verified := false
+	if req.URL != nil && *req.URL != current.URL {
+		verify := verifyByDefault
+		if req.Verify != nil {
+			verify = *req.Verify
+		}
+		if verify {
+			provider := current.Provider
+			if req.Provider != nil {
+				provider = *req.Provider
+			}
+			if err := verifyContent(r.Context(), provider, *req.URL, hash); err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				json.NewEncoder(w).Encode(ValidationResponse{IsValid: false, Param: "url", Message: err.Error()})
+				return
+			}
+			verified = true
+		}
+	}
+
+	conflict := ""
+	success := transaction(r.Context(), conn, "lockb0x update", func() int {
+		conflict = ""
+		node := codexRecordNode(conn, hash)
+		if node == nil {
+			conflict = "Lockb0x record not found"
+			return yottadb.YDB_OK
+		}
+		if node.Child("status").Get("") == Lockb0xRevoked {
+			conflict = "Lockb0x record is revoked"
+			return yottadb.YDB_OK
+		}
+
+		changes := map[string]interface{}{}
+		for field, value := range map[string]*string{"url": req.URL, "description": req.Description, "provider": req.Provider} {
+			if value == nil {
+				continue
+			}
+			if old := node.Child(field).Get(""); old != *value {
+				changes[field] = map[string]string{"from": old, "to": *value}
+				node.Child(field).Set(*value)
+			}
+		}
+		if len(changes) == 0 {
+			return yottadb.YDB_OK
+		}
+		if _, ok := changes["url"]; ok {
+			if verified {
+				node.Child("content_verified").Set("1")
+			} else {
+				node.Child("content_verified").Kill()
+			}
+		}
+
+		version, _ := strconv.Atoi(node.Child("version").Get("1"))
+		version++
+		node.Child("version").Set(version)
+
+		data := map[string]interface{}{"version": version, "changes": changes}
+		if req.Reason != "" {
+			data["reason"] = req.Reason
+		}
+		appendCodexEvent(conn, hash, "updated", data)
+		return yottadb.YDB_OK
+	})
+	if !success {
+		sendError(w, "Failed to update record", http.StatusInternalServerError)
+		return
+	}
+	if conflict == "Lockb0x record not found" {
+		sendError(w, conflict, http.StatusNotFound)
+		return
+	}
+	if conflict != "" {
+		sendError(w, conflict, http.StatusConflict)
+		return
+	}
+
+	record, err := fetchLockb0xRecord(conn, hash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sendJSON(w, record)
+}
+
+// RevokeLockb0x withdraws a record. A draft that was never anchored is revoked on the
+// spot. An anchored record stays on-chain, so its revocation is anchored too: without
+// xdr this returns the unsigned lockb0x_revoke transaction, with the signed envelope it
+// submits it, and core-rust marks the record revoked once the transaction lands.
+func RevokeLockb0x(w http.ResponseWriter, r *http.Request) {
+	hash := getPathVar(r, "hash")
+	if !isPointerHash(hash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+
+	var req Lockb0xRevokeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	if conn.Node("^Codex", "draft", hash).HasTree() {
+		revokeDraft(w, r, conn, hash, req.Reason)
+		return
+	}
+	activeNode := conn.Node("^Codex", hash)
+	if !activeNode.HasTree() {
+		sendError(w, "Lockb0x record not found", http.StatusNotFound)
+		return
+	}
+	if activeNode.Child("status").Get("") == Lockb0xRevoked {
+		sendError(w, "Lockb0x record is already revoked", http.StatusConflict)
+		return
+	}
+	// A submitted revocation that can no longer land may be rebuilt and resubmitted
+	revNode := activeNode.Child("revocation")
+	if revNode.Child("status").Get("") == Lockb0xSubmitted && !submissionExpired(conn, revNode) {
+		sendError(w, "Revocation transaction already submitted", http.StatusConflict)
+		return
+	}
+
+	if req.XDR == "" {
+		buildRevocation(w, r, conn, hash, req.Reason)
+		return
+	}
+	submitRevocation(w, r, conn, hash, req)
+}
+
+// revokeDraft revokes an unanchored draft locally
+func revokeDraft(w http.ResponseWriter, r *http.Request, conn *yottadb.Conn, hash, reason string) {
+	conflict := ""
+	success := transaction(r.Context(), conn, "lockb0x revoke draft", func() int {
+		conflict = ""
+		draftNode := conn.Node("^Codex", "draft", hash)
+		switch status := draftNode.Child("status").Get(""); status {
+		case Lockb0xPendingTx, Lockb0xFailed, Lockb0xQueued:
+		case Lockb0xRevoked:
+			conflict = "Lockb0x record is already revoked"
+			return yottadb.YDB_OK
+		default:
+			conflict = fmt.Sprintf("Draft has an anchoring transaction in flight (status: %s)", status)
+			return yottadb.YDB_OK
+		}
+
+		now := time.Now().Unix()
+		draftNode.Child("status").Set(Lockb0xRevoked)
+		revNode := draftNode.Child("revocation")
+		revNode.Child("status").Set(Lockb0xRevoked)
+		revNode.Child("requested_at").Set(now)
+		if reason != "" {
+			revNode.Child("reason").Set(reason)
+		}
+		conn.Node("^Codex", "batch_queue", hash).Kill()
+
+		appendCodexEvent(conn, hash, "revoked", map[string]interface{}{"reason": reason, "on_chain": false})
+		return yottadb.YDB_OK
+	})
+	if !success {
+		sendError(w, "Failed to revoke draft", http.StatusInternalServerError)
+		return
+	}
+	if conflict != "" {
+		sendError(w, conflict, http.StatusConflict)
+		return
+	}
+	go notifyLockb0xStatus(hash, Lockb0xRevoked)
+
+	record, err := fetchLockb0xRecord(conn, hash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sendJSON(w, record)
+}
+
+// buildRevocation returns the unsigned revocation transaction for an anchored record
+func buildRevocation(w http.ResponseWriter, r *http.Request, conn *yottadb.Conn, hash, reason string) {
+	if anchorAccount == "" {
+		sendError(w, "Anchoring account not configured", http.StatusServiceUnavailable)
+		return
+	}
+	sequence, ok := anchorSequence(w, r, conn)
+	if !ok {
+		return
+	}
+	resp, ok := buildAnchorResponse(w, hash, codex.CommitmentRevocation, sequence)
+	if !ok {
+		return
+	}
+
+	transaction(r.Context(), conn, "lockb0x revoke build", func() int {
+		revNode := conn.Node("^Codex", hash, "revocation")
+		revNode.Child("status").Set(Lockb0xPendingTx)
+		revNode.Child("requested_at").Set(time.Now().Unix())
+		if reason != "" {
+			revNode.Child("reason").Set(reason)
+		}
+		appendCodexEvent(conn, hash, "revocation_requested", map[string]interface{}{"reason": reason})
+		return yottadb.YDB_OK
+	})
+
+	sendJSON(w, resp)
+}
+
+// submitRevocation submits a signed revocation transaction for an anchored record
+func submitRevocation(w http.ResponseWriter, r *http.Request, conn *yottadb.Conn, hash string, req Lockb0xRevokeRequest) {
+	parsed, err := txnbuild.TransactionFromXDR(req.XDR)
+	if err != nil {
+		sendError(w, "Invalid transaction envelope", http.StatusBadRequest)
+		return
+	}
+	tx, signatures := innerTransaction(parsed)
+	if tx == nil {
+		sendError(w, "Invalid transaction envelope", http.StatusBadRequest)
+		return
+	}
+	if signatures == 0 {
+		sendError(w, "Transaction is not signed", http.StatusBadRequest)
+		return
+	}
+	if !fromAnchorAccount(w, tx) {
+		return
+	}
+	if !codex.Revokes(tx, hash) {
+		sendError(w, "Transaction does not revoke the pointer hash", http.StatusUnprocessableEntity)
+		return
+	}
+	txHash, err := parsed.HashHex(networkPassphrase)
+	if err != nil {
+		sendError(w, "Failed to hash transaction", http.StatusBadRequest)
+		return
+	}
+
+	conflict := ""
+	success := transaction(r.Context(), conn, "lockb0x revoke submit", func() int {
+		conflict = ""
+		activeNode := conn.Node("^Codex", hash)
+		revNode := activeNode.Child("revocation")
+		pending := revNode.Child("status").Get("") == Lockb0xSubmitted && !submissionExpired(conn, revNode)
+		if activeNode.Child("status").Get("") == Lockb0xRevoked || pending {
+			conflict = "Lockb0x record is already being revoked"
+			return yottadb.YDB_OK
+		}
+		if !revNode.Child("requested_at").HasValue() {
+			revNode.Child("requested_at").Set(time.Now().Unix())
+		}
+		if req.Reason != "" {
+			revNode.Child("reason").Set(req.Reason)
+		}
+		revNode.Child("status").Set(Lockb0xSubmitted)
+		revNode.Child("tx_hash").Set(txHash)
+		revNode.Child("valid_until").Set(tx.Timebounds().MaxTime)
+		revNode.Child("error").Kill()
+		revNode.Child("error_codes").Kill()
+
+		conn.Node("^Codex", "tx", txHash).Set(hash)
+		appendCodexEvent(conn, hash, "revocation_submitted", map[string]interface{}{"tx_hash": txHash})
+		return yottadb.YDB_OK
+	})
+	if !success {
+		sendError(w, "Failed to update record", http.StatusInternalServerError)
+		return
+	}
+	if conflict != "" {
+		sendError(w, conflict, http.StatusConflict)
+		return
+	}
+	watchLockb0x(hash, Lockb0xAnchored)
+
+	logger := requestLogger(r).With("hash", hash, "tx_hash", txHash)
+	logger.Info("Submitting Lockb0x revocation")
+	result := submitEnvelope(r.Context(), req.XDR)
+
+	status := http.StatusOK
+	switch {
+	case result.Pending:
+		logger.Warn("Lockb0x revocation submission unconfirmed, awaiting ingestion", "error", result.Message)
+		status = http.StatusAccepted
+	case result.Failed:
+		logger.Warn("Lockb0x revocation failed", "message", result.Message, "codes", result.Codes)
+		updateSubmittedRevocation(conn, hash, func(revNode *yottadb.Node) {
+			revNode.Child("status").Set(Lockb0xFailed)
+			revNode.Child("error").Set(result.Message)
+			revNode.Child("error_codes").Set(result.Codes)
+			appendCodexEvent(conn, hash, "revocation_failed", map[string]interface{}{
+				"tx_hash": txHash, "error": result.Message, "error_codes": result.Codes,
+			})
+		})
+		status = http.StatusBadGateway
+	default:
+		updateSubmittedRevocation(conn, hash, func(revNode *yottadb.Node) {
+			revNode.Child("ledger").Set(result.Ledger)
+		})
+	}
+
+	record, err := fetchLockb0xRecord(conn, hash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(record)
+}
+
+// updateSubmittedRevocation applies update only while the revocation is still submitted,
+// as core-rust may already have confirmed it
+func updateSubmittedRevocation(conn *yottadb.Conn, hash string, update func(revNode *yottadb.Node)) {
+	conn.Transaction("", nil, func() int {
+		revNode := conn.Node("^Codex", hash, "revocation")
+		if revNode.Child("status").Get("") == Lockb0xSubmitted {
+			update(revNode)
+		}
+		return yottadb.YDB_OK
+	})
+}
+
+// SupersedeLockb0x creates a draft for a new pointer hash that replaces the record at
+// the path. Both records are kept and linked (supersedes / superseded_by); the new draft
+// is anchored like any other.
+func SupersedeLockb0x(w http.ResponseWriter, r *http.Request) {
+	oldHash := getPathVar(r, "hash")
+	if !isPointerHash(oldHash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+
+	var req Lockb0xSupersedeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validateLockb0xRequest(w, &req.Lockb0xRequest) {
+		return
+	}
+	newHash := req.PointerHash
+	if newHash == oldHash {
+		sendError(w, "A record cannot supersede itself", http.StatusBadRequest)
+		return
+	}
+	verify, ok := verifyLockb0xContent(w, r, &req.Lockb0xRequest)
+	if !ok {
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	conflict := ""
+	success := transaction(r.Context(), conn, "lockb0x supersede", func() int {
+		conflict = ""
+		oldNode := codexRecordNode(conn, oldHash)
+		switch {
+		case oldNode == nil:
+			conflict = "Lockb0x record not found"
+			return yottadb.YDB_OK
+		case oldNode.Child("status").Get("") == Lockb0xRevoked:
+			conflict = "Lockb0x record is revoked"
+			return yottadb.YDB_OK
+		case oldNode.Child("superseded_by").Get("") != "":
+			conflict = "Lockb0x record is already superseded by " + oldNode.Child("superseded_by").Get("")
+			return yottadb.YDB_OK
+		}
+		if !writeLockb0xDraft(conn, &req.Lockb0xRequest, verify, map[string]interface{}{"supersedes": oldHash}) {
+			conflict = "A Lockb0x record already exists for the new pointer hash"
+			return yottadb.YDB_OK
+		}
+
+		conn.Node("^Codex", "draft", newHash, "supersedes").Set(oldHash)
+		oldNode.Child("superseded_by").Set(newHash)
+
+		data := map[string]interface{}{"superseded_by": newHash}
+		if req.Reason != "" {
+			data["reason"] = req.Reason
+		}
+		appendCodexEvent(conn, oldHash, "superseded", data)
+		return yottadb.YDB_OK
+	})
+	if !success {
+		sendError(w, "Failed to save draft", http.StatusInternalServerError)
+		return
+	}
+	if conflict == "Lockb0x record not found" {
+		sendError(w, conflict, http.StatusNotFound)
+		return
+	}
+	if conflict != "" {
+		sendError(w, conflict, http.StatusConflict)
+		return
+	}
+	go notifyLockb0xStatus(newHash, draftStatus(&req.Lockb0xRequest))
+
+	record, err := fetchLockb0xRecord(conn, newHash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(record)
+}
@@ -1,11 +1,19 @@
 package handlers
 
 import (
+	"encoding/hex"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"api-report/codex"
+
 	"lang.yottadb.com/go/yottadb/v2"
 )
 
@@ -20,65 +28,480 @@ type Lockb0xRequest struct {
 	URL         string `json:"url"`
 	Description string `json:"description"`
 	Provider    string `json:"provider"`
+	Verify      *bool  `json:"verify,omitempty"` // Check the url's SHA-256 (default: LOCKB0X_VERIFY_CONTENT)
+	Batch       bool   `json:"batch,omitempty"`  // Anchor through the next Merkle batch
+
+	Attesters []Attester `json:"attesters,omitempty"` // Parties asked to attest to the record
+}
+
+// Lockb0xRecord is a draft from ^Codex("draft", hash) or, once core-rust has seen the
+// anchor, the anchored record at ^Codex(hash)
+type Lockb0xRecord struct {
+	PointerHash string `json:"pointer_hash"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	Provider    string `json:"provider"`
+	Status      string `json:"status"`
+	Timestamp   int64  `json:"timestamp"`
+	TxHash      string `json:"tx_hash,omitempty"`
+	Ledger      int64  `json:"ledger,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ErrorCodes  string `json:"error_codes,omitempty"`
+
+	ContentVerified bool              `json:"content_verified,omitempty"`
+	Batch           *codex.BatchProof `json:"batch,omitempty"`
+
+	Version      int                `json:"version"` // Bumped by each correction
+	Supersedes   string             `json:"supersedes,omitempty"`
+	SupersededBy string             `json:"superseded_by,omitempty"`
+	Revocation   *Lockb0xRevocation `json:"revocation,omitempty"`
 }
 
 type Lockb0xResponse struct {
-	Status    string `json:"status"`
-	Hash      string `json:"hash"`
-	Timestamp int64  `json:"timestamp"`
+	Status    string         `json:"status"`
+	Hash      string         `json:"hash"`
+	Timestamp int64          `json:"timestamp"` // When the draft was first saved
+	Created   bool           `json:"created"`   // False for replays and existing drafts
+	Replayed  bool           `json:"replayed,omitempty"`
+	Record    *Lockb0xRecord `json:"record,omitempty"`
 }
 
+// CreateLockb0xDraft saves a draft. Re-posting an existing hash with the same payload
+// (or replaying an Idempotency-Key) returns the stored record with created=false; a
+// different payload gets a 409 with the differing fields.
 func CreateLockb0xDraft(w http.ResponseWriter, r *http.Request) {
 	var req Lockb0xRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		sendError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-
-	// Basic Validation
-	if req.PointerHash == "" || len(req.PointerHash) != 64 {
-		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+	if !validateLockb0xRequest(w, &req) {
 		return
 	}
-	if req.URL == "" {
-		sendError(w, "URL is required", http.StatusBadRequest)
+	key := r.Header.Get("Idempotency-Key")
+	if !validIdempotencyKey(key) {
+		sendError(w, "Idempotency-Key must be 1-255 printable ASCII characters", http.StatusBadRequest)
 		return
 	}
-	if len(req.Description) > 300 {
-		sendError(w, "Description exceeds 300 characters", http.StatusBadRequest)
+	scope := idempotencyScope(r)
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	// Replays and existing drafts are answered without re-verifying content
+	if key != "" {
+		if stored, hash, ok := lookupIdempotencyKey(conn, scope, key); ok {
+			if diff := draftDiff(stored, &req); len(diff) > 0 {
+				sendDraftConflict(w, "Idempotency-Key was used with a different payload", hash, diff)
+				return
+			}
+			respondExistingDraft(w, conn, hash, true)
+			return
+		}
+	}
+	if existing, err := fetchLockb0xRecord(conn, req.PointerHash); err == nil {
+		if diff := draftDiff(recordRequest(existing), &req); len(diff) > 0 {
+			sendDraftConflict(w, "A Lockb0x record with this pointer hash already exists with different fields", req.PointerHash, diff)
+			return
+		}
+		if key != "" {
+			transaction(r.Context(), conn, "lockb0x create", func() int {
+				saveIdempotencyKey(conn, scope, key, &req)
+				return yottadb.YDB_OK
+			})
+		}
+		respondExistingDraft(w, conn, req.PointerHash, false)
 		return
 	}
 
-	ydbMu.Lock()
-	defer ydbMu.Unlock()
+	verify, ok := verifyLockb0xContent(w, r, &req)
+	if !ok {
+		return
+	}
 
 	// Persist to ^Codex("draft", hash)
-	success := ydbConn.Transaction("", nil, func() int {
-		draftNode := ydbConn.Node("^Codex", "draft", req.PointerHash)
-		
-		// Check if already exists
-		if draftNode.HasTree() || draftNode.HasValue() {
-			return yottadb.YDB_OK // Idempotent success
-		}
-
-		draftNode.Child("url").Set(req.URL)
-		draftNode.Child("description").Set(req.Description)
-		draftNode.Child("provider").Set(req.Provider)
-		draftNode.Child("status").Set("pending_tx")
-		draftNode.Child("timestamp").Set(time.Now().Unix())
-		
+	created := false
+	success := transaction(r.Context(), conn, "lockb0x create", func() int {
+		created = writeLockb0xDraft(conn, &req, verify, nil)
+		if key != "" {
+			saveIdempotencyKey(conn, scope, key, &req)
+		}
 		return yottadb.YDB_OK
 	})
 
 	if !success {
-		log.Printf("Error saving Lockb0x draft for hash %s", req.PointerHash)
+		requestLogger(r).Error("Failed to save Lockb0x draft", "hash", req.PointerHash)
 		sendError(w, "Failed to save draft", http.StatusInternalServerError)
 		return
 	}
 
+	if !created {
+		// Lost a race with a concurrent create of the same hash
+		existing, err := fetchLockb0xRecord(conn, req.PointerHash)
+		if err == nil {
+			if diff := draftDiff(recordRequest(existing), &req); len(diff) > 0 {
+				sendDraftConflict(w, "A Lockb0x record with this pointer hash already exists with different fields", req.PointerHash, diff)
+				return
+			}
+		}
+		respondExistingDraft(w, conn, req.PointerHash, false)
+		return
+	}
+
+	go notifyLockb0xStatus(req.PointerHash, draftStatus(&req))
+
+	record, err := fetchLockb0xRecord(conn, req.PointerHash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	sendJSON(w, Lockb0xResponse{
 		Status:    "draft_saved",
 		Hash:      req.PointerHash,
-		Timestamp: time.Now().Unix(),
+		Timestamp: record.Timestamp,
+		Created:   true,
+		Record:    record,
+	})
+}
+
+// respondExistingDraft answers a create that matched a stored record
+func respondExistingDraft(w http.ResponseWriter, conn *yottadb.Conn, hash string, replayed bool) {
+	record, err := fetchLockb0xRecord(conn, hash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sendJSON(w, Lockb0xResponse{
+		Status:    "draft_saved",
+		Hash:      hash,
+		Timestamp: record.Timestamp,
+		Replayed:  replayed,
+		Record:    record,
+	})
+}
+
+// validateLockb0xRequest normalises and checks a draft request. It writes the error
+// response and returns false on failure.
+func validateLockb0xRequest(w http.ResponseWriter, req *Lockb0xRequest) bool {
+	// Basic Validation
+	req.PointerHash = strings.ToLower(req.PointerHash)
+	if !isPointerHash(req.PointerHash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return false
+	}
+	if req.URL == "" {
+		sendError(w, "URL is required", http.StatusBadRequest)
+		return false
+	}
+	if len(req.Description) > 300 {
+		sendError(w, "Description exceeds 300 characters", http.StatusBadRequest)
+		return false
+	}
+	if req.Batch && batchWindow == 0 {
+		sendError(w, "Batch anchoring is not enabled", http.StatusBadRequest)
+		return false
+	}
+	for _, a := range req.Attesters {
+		if msg := validateAttester(a); msg != "" {
+			sendError(w, msg, http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// verifyLockb0xContent runs content verification when requested: the url must resolve
+// to bytes hashing to pointer_hash. It writes a 422 on mismatch; verify reports whether
+// the content was verified.
+func verifyLockb0xContent(w http.ResponseWriter, r *http.Request, req *Lockb0xRequest) (verify bool, ok bool) {
+	verify = verifyByDefault
+	if req.Verify != nil {
+		verify = *req.Verify
+	}
+	if verify {
+		if err := verifyContent(r.Context(), req.Provider, req.URL, req.PointerHash); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(ValidationResponse{IsValid: false, Param: "url", Message: err.Error()})
+			return false, false
+		}
+	}
+	return verify, true
+}
+
+// writeLockb0xDraft saves req at ^Codex("draft", hash) and logs its created event (with
+// data) unless a draft or anchored record already exists for the hash. Call inside a
+// transaction.
+func writeLockb0xDraft(conn *yottadb.Conn, req *Lockb0xRequest, verify bool, data map[string]interface{}) bool {
+	if codexRecordNode(conn, req.PointerHash) != nil {
+		return false
+	}
+
+	draftNode := conn.Node("^Codex", "draft", req.PointerHash)
+	draftNode.Child("hash").Set(req.PointerHash)
+	draftNode.Child("url").Set(req.URL)
+	draftNode.Child("description").Set(req.Description)
+	draftNode.Child("provider").Set(req.Provider)
+	draftNode.Child("status").Set(draftStatus(req))
+	draftNode.Child("timestamp").Set(time.Now().Unix())
+	if verify {
+		draftNode.Child("content_verified").Set("1")
+	}
+	if req.Batch {
+		conn.Node("^Codex", "batch_queue", req.PointerHash).Set(req.PointerHash)
+	}
+
+	appendCodexIndex(conn, req.PointerHash)
+	appendCodexEvent(conn, req.PointerHash, "created", data)
+	for _, a := range req.Attesters {
+		writeAttestationRequest(conn, req.PointerHash, a)
+	}
+	return true
+}
+
+func draftStatus(req *Lockb0xRequest) string {
+	if req.Batch {
+		return Lockb0xQueued
+	}
+	return Lockb0xPendingTx
+}
+
+// appendCodexIndex records hash at ^Codex("index", n) so records can be listed in
+// creation order. Call inside a transaction.
+func appendCodexIndex(conn *yottadb.Conn, hash string) {
+	indexNode := conn.Node("^Codex", "index")
+	n, _ := strconv.ParseInt(indexNode.Get("0"), 10, 64)
+	n++
+	indexNode.Set(n)
+	indexNode.Child(strconv.FormatInt(n, 10)).Set(hash)
+}
+
+// BackfillCodexIndex rebuilds ^Codex("index") from every draft and anchored record, once.
+// Records created before the index existed were otherwise missing from ListLockb0x. The
+// rebuilt index is ordered by timestamp, keeping the existing order among equal
+// timestamps. It runs at startup before the API serves requests; if interrupted, it
+// runs again on the next start.
+func BackfillCodexIndex() {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	doneNode := conn.Node("^Codex", "index_backfilled")
+	if doneNode.HasValue() {
+		return
+	}
+
+	position := make(map[string]int64)
+	for node := range conn.Node("^Codex", "index").Children() {
+		n, _ := strconv.ParseInt(node.Subscript(-1), 10, 64)
+		if hash := node.Get(""); hash != "" {
+			if _, seen := position[hash]; !seen {
+				position[hash] = n
+			}
+		}
+	}
+
+	type entry struct {
+		hash      string
+		timestamp int64
+		position  int64
+	}
+	var entries []entry
+	seen := make(map[string]bool)
+	add := func(hash string, node *yottadb.Node) {
+		if seen[hash] || !isPointerHash(hash) {
+			return
+		}
+		seen[hash] = true
+		ts, _ := strconv.ParseInt(node.Child("timestamp").Get("0"), 10, 64)
+		pos, ok := position[hash]
+		if !ok {
+			pos = math.MaxInt64
+		}
+		entries = append(entries, entry{hash, ts, pos})
+	}
+	for node := range conn.Node("^Codex", "draft").Children() {
+		add(node.Subscript(-1), node)
+	}
+	for node := range conn.Node("^Codex").Children() {
+		add(node.Subscript(-1), node) // Skips "index", "draft" and the other named subtrees
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.timestamp != b.timestamp {
+			return a.timestamp < b.timestamp
+		}
+		if a.position != b.position {
+			return a.position < b.position
+		}
+		return a.hash < b.hash
 	})
+
+	indexNode := conn.Node("^Codex", "index")
+	indexNode.Kill()
+	for i, e := range entries {
+		indexNode.Child(strconv.Itoa(i + 1)).Set(e.hash)
+	}
+	indexNode.Set(len(entries))
+	doneNode.Set(time.Now().Unix())
+
+	slog.Info("Backfilled lockb0x listing index", "records", len(entries), "previously_indexed", len(position))
+}
+
+// lockb0xStatus returns the status of a draft, or of the anchored record once core-rust
+// has promoted it to ^Codex(hash)
+func lockb0xStatus(conn *yottadb.Conn, hash string) string {
+	if status := conn.Node("^Codex", "draft", hash, "status").Get(""); status != "" {
+		return status
+	}
+	return conn.Node("^Codex", hash, "status").Get("")
+}
+
+// GetLockb0x returns a single draft or anchored record by pointer hash
+func GetLockb0x(w http.ResponseWriter, r *http.Request) {
+	hash := getPathVar(r, "hash")
+	if !isPointerHash(hash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	record, err := fetchLockb0xRecord(conn, hash)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	sendJSON(w, record)
+}
+
+// ListLockb0x returns records newest first, filtered by ?status=, ?provider= and
+// ?since= (unix seconds). Pages are resumed with ?cursor= from next_cursor.
+func ListLockb0x(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	provider := query.Get("provider")
+
+	since, err := parseSince(query.Get("since"))
+	if err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	last, _ := strconv.ParseInt(conn.Node("^Codex", "index").Get("0"), 10, 64)
+	if c := query.Get("cursor"); c != "" {
+		cursor, err := strconv.ParseInt(c, 10, 64)
+		if err != nil || cursor < 1 {
+			sendError(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		last = cursor - 1
+	}
+
+	records := []Lockb0xRecord{}
+	var nextCursor int64
+	n := last
+	for ; n > 0; n-- {
+		if len(records) == limit {
+			nextCursor = n + 1
+			break
+		}
+
+		hash := conn.Node("^Codex", "index", strconv.FormatInt(n, 10)).Get("")
+		record, err := fetchLockb0xRecord(conn, hash)
+		if err != nil {
+			continue
+		}
+		if since > 0 && record.Timestamp < since {
+			break // Index is in creation order; everything older follows
+		}
+		if status != "" && record.Status != status {
+			continue
+		}
+		if provider != "" && record.Provider != provider {
+			continue
+		}
+		records = append(records, *record)
+	}
+
+	response := map[string]interface{}{"records": records}
+	if nextCursor > 0 {
+		response["next_cursor"] = strconv.FormatInt(nextCursor, 10)
+	}
+	sendJSON(w, response)
+}
+
+func fetchLockb0xRecord(conn *yottadb.Conn, hash string) (*Lockb0xRecord, error) {
+	if hash == "" {
+		return nil, fmt.Errorf("lockb0x record not found")
+	}
+
+	node := codexRecordNode(conn, hash)
+	if node == nil {
+		return nil, fmt.Errorf("lockb0x record %s not found", hash)
+	}
+
+	timestamp, _ := strconv.ParseInt(node.Child("timestamp").Get("0"), 10, 64)
+	ledger, _ := strconv.ParseInt(node.Child("ledger").Get("0"), 10, 64)
+	version, _ := strconv.Atoi(node.Child("version").Get("1"))
+
+	var batch *codex.BatchProof
+	if root := node.Child("batch_root").Get(""); root != "" {
+		batchID, _ := strconv.ParseInt(node.Child("batch_id").Get("0"), 10, 64)
+		batch = &codex.BatchProof{ID: batchID, Root: root}
+		json.Unmarshal([]byte(node.Child("batch_proof").Get("[]")), &batch.Proof)
+	}
+
+	return &Lockb0xRecord{
+		PointerHash: hash,
+		URL:         node.Child("url").Get(""),
+		Description: node.Child("description").Get(""),
+		Provider:    node.Child("provider").Get(""),
+		Status:      node.Child("status").Get(""),
+		Timestamp:   timestamp,
+		TxHash:      node.Child("tx_hash").Get(""),
+		Ledger:      ledger,
+		Error:       node.Child("error").Get(""),
+		ErrorCodes:  node.Child("error_codes").Get(""),
+
+		ContentVerified: node.Child("content_verified").Get("") == "1",
+		Batch:           batch,
+
+		Version:      version,
+		Supersedes:   node.Child("supersedes").Get(""),
+		SupersededBy: node.Child("superseded_by").Get(""),
+		Revocation:   fetchRevocation(node),
+	}, nil
+}
+
+// parseSince accepts unix seconds or an RFC 3339 timestamp
+func parseSince(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return secs, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("since must be unix seconds or RFC 3339")
+	}
+	return t.Unix(), nil
+}
+
+func isPointerHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
 }
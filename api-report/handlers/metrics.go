@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are registered with the default Prometheus registry through promauto and
+// served at /metrics by promhttp, alongside the Go runtime and process collectors. The
+// Horizon pool registers its own pakana_horizon_* metrics (see pkg/horizonpool/metrics.go).
+
+// defaultBuckets suit HTTP and Horizon latencies, in seconds
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// Metrics serves every registered metric in the Prometheus text format
+var Metrics = promhttp.Handler()
+
+// observeSince records the seconds elapsed since start
+func observeSince(o prometheus.Observer, start time.Time) {
+	o.Observe(time.Since(start).Seconds())
+}
+
+// Service metrics
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pakana_http_request_duration_seconds",
+		Help:    "HTTP request latency by route template, method and status code.",
+		Buckets: defaultBuckets,
+	}, []string{"route", "method", "code"})
+	hydrationLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pakana_hydration_lookups_total",
+		Help: "Lookups answered from YottaDB (hit) or needing Horizon hydration (miss), by kind.",
+	}, []string{"kind", "result"})
+	hydrationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pakana_hydrations_total",
+		Help: "Horizon hydrations performed, by kind and result.",
+	}, []string{"kind", "result"})
+)
+
+// recordLookup counts a local lookup as a hydration hit or miss
+func recordLookup(kind string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	hydrationLookups.WithLabelValues(kind, result).Inc()
+}
+
+// recordHydration counts the outcome of a hydration
+func recordHydration(kind string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	hydrationsTotal.WithLabelValues(kind, result).Inc()
+}
+
+// statusRecorder captures the response status for MetricsMiddleware. Unwrap keeps
+// http.ResponseController (and so SSE flushing) working through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// MetricsMiddleware records latency and status per route template
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		route := routeTemplate(r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		observeSince(httpRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)), start)
+	})
+}
+
+// routeTemplate is the matched mux route's path template, so ids in paths don't create
+// new series or span names
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if tmpl, err := current.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unmatched"
+}
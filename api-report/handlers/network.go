@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lockb0x-llc/pakana-node-0/pkg/horizonpool"
+	"github.com/lockb0x-llc/pakana-node-0/pkg/logging"
+	"github.com/lockb0x-llc/pakana-node-0/pkg/stellarnet"
+	"github.com/stellar/go-stellar-sdk/clients/horizonclient"
+)
+
+// One node can index several Stellar networks, each fed by its own api-go and core-rust
+// with the matching STELLAR_NETWORK. STELLAR_NETWORKS lists the ones this API serves
+// (testnet, pubnet, futurenet or a custom name); the first is the default. Per network
+// NAME, HORIZON_URLS_NAME and STELLAR_NETWORK_PASSPHRASE_NAME override the well-known
+// Horizon and passphrase, and a custom name must set the passphrase. The default network
+// also honours the unsuffixed HORIZON_URLS, HORIZON_URL and STELLAR_NETWORK_PASSPHRASE.
+//
+// Requests pick a network with ?network=NAME. Each network's data lives in its own
+// globals: testnet keeps the unqualified ^Stellar, ^Account, ^Tracked and ^Ledger, and
+// any other network appends its capitalised name (^StellarPubnet, ...). Lockb0x records,
+// webhooks and API keys are node-wide; anchoring happens on LOCKB0X_NETWORK (default:
+// the default network) and webhooks follow the default network.
+
+// stellarNetwork is one network this API serves, with its Horizon and global names
+type stellarNetwork struct {
+	name       string
+	passphrase string
+	client     *horizonclient.Client
+	pool       *horizonpool.Pool
+	hub        *ledgerHub
+
+	// Global names
+	stellar string
+	account string
+	tracked string
+	ledger  string
+}
+
+// Networks set by InitNetworks
+var (
+	networks       []*stellarNetwork // In STELLAR_NETWORKS order
+	defaultNetwork *stellarNetwork   // Used when a request names none
+	lockb0xNetwork *stellarNetwork   // Where Lockb0x records are anchored
+)
+
+type networkContextKey struct{}
+
+// InitNetworks configures every network in STELLAR_NETWORKS and checks each against
+// its Horizon
+func InitNetworks() {
+	raw := os.Getenv("STELLAR_NETWORKS")
+	if raw == "" {
+		raw = os.Getenv("STELLAR_NETWORK")
+	}
+	if passphrase := os.Getenv("STELLAR_NETWORK_PASSPHRASE"); raw == "" && passphrase != "" {
+		// Deployments that only set the passphrase keep working
+		if raw = stellarnet.NameOf(passphrase); raw == "" {
+			logging.Fatal("STELLAR_NETWORKS is required with a custom STELLAR_NETWORK_PASSPHRASE")
+		}
+	}
+	if raw == "" {
+		raw = stellarnet.Default
+	}
+
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !stellarnet.ValidName(name) {
+			logging.Fatal("Invalid network name: use lowercase letters and digits, at most 20", "network", name)
+		}
+		if findNetwork(name) != nil {
+			logging.Fatal("Network listed twice in STELLAR_NETWORKS", "network", name)
+		}
+		networks = append(networks, newStellarNetwork(name, len(networks) == 0))
+	}
+	if len(networks) == 0 {
+		logging.Fatal("STELLAR_NETWORKS names no network")
+	}
+	defaultNetwork = networks[0]
+
+	lockb0xNetwork = defaultNetwork
+	if name := strings.ToLower(strings.TrimSpace(os.Getenv("LOCKB0X_NETWORK"))); name != "" {
+		if lockb0xNetwork = findNetwork(name); lockb0xNetwork == nil {
+			logging.Fatal("LOCKB0X_NETWORK is not one of STELLAR_NETWORKS", "network", name)
+		}
+	}
+}
+
+func newStellarNetwork(name string, isDefault bool) *stellarNetwork {
+	suffix := "_" + strings.ToUpper(name)
+	lookup := func(key string, fallbacks ...string) string {
+		if v := os.Getenv(key + suffix); v != "" || !isDefault {
+			return v
+		}
+		for _, k := range append([]string{key}, fallbacks...) {
+			if v := os.Getenv(k); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	known, ok := stellarnet.Known[name]
+	passphrase := lookup("STELLAR_NETWORK_PASSPHRASE")
+	if passphrase == "" {
+		if !ok {
+			logging.Fatal("Custom network needs STELLAR_NETWORK_PASSPHRASE"+suffix, "network", name)
+		}
+		passphrase = known.Passphrase
+	}
+	urls := horizonpool.URLs(lookup("HORIZON_URLS", "HORIZON_URL"), known.HorizonURL)
+	if urls[0] == "" {
+		logging.Fatal("Custom network needs HORIZON_URLS"+suffix, "network", name)
+	}
+
+	pool, err := horizonpool.New(urls, passphrase)
+	if err != nil {
+		logging.Fatal("Invalid HORIZON_URLS"+suffix, "network", name, "error", err)
+	}
+
+	net := &stellarNetwork{
+		name:       name,
+		passphrase: passphrase,
+		pool:       pool,
+		hub:        &ledgerHub{subs: make(map[chan struct{}]struct{})},
+		stellar:    stellarnet.Global("^Stellar", name),
+		account:    stellarnet.Global("^Account", name),
+		tracked:    stellarnet.Global("^Tracked", name),
+		ledger:     stellarnet.Global("^Ledger", name),
+	}
+	net.client = &horizonclient.Client{
+		HorizonURL: urls[0],
+		HTTP:       net.pool.Client(10 * time.Second),
+	}
+	net.validate()
+	slog.Info("Stellar network configured", "network", name, "default", isDefault, "globals", net.stellar,
+		"horizon_urls", urls, "active", net.pool.Active())
+	return net
+}
+
+// validate stops startup if Horizon answers for a different network. With no Horizon
+// reachable yet, startup goes ahead and the pool's probes rule out any endpoint that
+// comes up on the wrong network.
+func (net *stellarNetwork) validate() {
+	reported, answered := net.pool.Networks()
+	for _, passphrase := range reported {
+		if passphrase == net.passphrase {
+			return
+		}
+	}
+	if answered == 0 {
+		slog.Warn("No Horizon reachable to validate the network against", "network", net.name)
+		return
+	}
+	logging.Fatal("No Horizon endpoint is on the configured network", "network", net.name,
+		"expected", net.passphrase, "reported", strings.Join(reported, " | "))
+}
+
+func findNetwork(name string) *stellarNetwork {
+	for _, net := range networks {
+		if net.name == name {
+			return net
+		}
+	}
+	return nil
+}
+
+func networkNames() []string {
+	names := make([]string, len(networks))
+	for i, net := range networks {
+		names[i] = net.name
+	}
+	return names
+}
+
+// NetworkMiddleware resolves ?network= for the handlers, rejecting unknown names
+func NetworkMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		net := defaultNetwork
+		if name := r.URL.Query().Get("network"); name != "" {
+			if net = findNetwork(strings.ToLower(name)); net == nil {
+				sendError(w, fmt.Sprintf("Unknown network %q; this node serves %s", name,
+					strings.Join(networkNames(), ", ")), http.StatusBadRequest)
+				return
+			}
+		}
+		w.Header().Set("X-Stellar-Network", net.name)
+		next.ServeHTTP(w, r.WithContext(withNetwork(r.Context(), net)))
+	})
+}
+
+func withNetwork(ctx context.Context, net *stellarNetwork) context.Context {
+	return context.WithValue(ctx, networkContextKey{}, net)
+}
+
+// networkOf is the network the request selected, or the default network
+func networkOf(ctx context.Context) *stellarNetwork {
+	if net, ok := ctx.Value(networkContextKey{}).(*stellarNetwork); ok {
+		return net
+	}
+	return defaultNetwork
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// NodeStatus is the ingestor's self-reported status from ^Ledger("status"), which
+// api-go rewrites every 15s. Each network has its own ingestor and status.
+type NodeStatus struct {
+	Network           string           `json:"network"`
+	Passphrase        string           `json:"network_passphrase"`
+	Heartbeat         int64            `json:"heartbeat"`
+	HeartbeatAge      int64            `json:"heartbeat_age_seconds"`
+	Stale             bool             `json:"stale"` // Heartbeat older than READY_MAX_HEARTBEAT_AGE
+	StartedAt         int64            `json:"started_at"`
+	UptimeSeconds     int64            `json:"uptime_seconds"`
+	LastSeen          int64            `json:"last_seen_ledger"`
+	LastCommitted     int64            `json:"last_committed_ledger"`
+	Cursor            string           `json:"cursor"`
+	HorizonURL        string           `json:"horizon_url"`
+	Version           string           `json:"version"`
+	Hostname          string           `json:"hostname"`
+	PID               int64            `json:"pid"`
+	Errors            map[string]int64 `json:"errors"`
+	Stream            StreamStatus     `json:"stream"`
+	Retention         *RetentionStatus `json:"retention,omitempty"` // Absent without a retention policy
+	CoreRustProcessed int64            `json:"core_rust_processed_ledger"`
+}
+
+// StreamStatus is the ingestor's Horizon ledger stream as seen by its reconnect loop
+type StreamStatus struct {
+	State      string `json:"state"` // connecting, connected, backoff, open (circuit open) or half_open
+	Since      int64  `json:"since"`
+	Failures   int64  `json:"consecutive_failures"`
+	Reconnects int64  `json:"reconnects"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// RetentionStatus is the ingestor's last raw XDR pruning pass
+type RetentionStatus struct {
+	DryRun       bool  `json:"dry_run"`
+	Through      int64 `json:"through_ledger"`
+	LastRun      int64 `json:"last_run,omitempty"`
+	Ledgers      int64 `json:"ledgers"`
+	Transactions int64 `json:"transactions"` // Pruned, or that would be in a dry run
+	Kept         int64 `json:"kept"`
+	Nodes        int64 `json:"nodes"`
+	Bytes        int64 `json:"bytes"`
+}
+
+// ingestorErrorCounters are the ^Ledger("status", "errors", name) counters api-go keeps
+var ingestorErrorCounters = []string{"ledger_fetch", "ledger_commit", "hydration", "backfill"}
+
+// GetNodeStatus returns the status subtree of the selected network's ingestor
+func GetNodeStatus(w http.ResponseWriter, r *http.Request) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+	net := networkOf(r.Context())
+
+	status := conn.Node(net.ledger, "status")
+	if !status.Child("heartbeat").HasValue() {
+		sendError(w, "Ingestor has not reported its status yet", http.StatusServiceUnavailable)
+		return
+	}
+	sendJSON(w, readNodeStatus(conn, net, status))
+}
+
+func readNodeStatus(conn *yottadb.Conn, net *stellarNetwork, status *yottadb.Node) *NodeStatus {
+	readInt := func(node *yottadb.Node) int64 {
+		v, _ := strconv.ParseInt(node.Get("0"), 10, 64)
+		return v
+	}
+
+	now := time.Now()
+	resp := &NodeStatus{
+		Heartbeat:         readInt(status.Child("heartbeat")),
+		StartedAt:         readInt(status.Child("started_at")),
+		LastSeen:          readInt(status.Child("last_seen")),
+		LastCommitted:     readInt(status.Child("last_committed")),
+		Cursor:            status.Child("cursor").Get(""),
+		HorizonURL:        status.Child("horizon_url").Get(""),
+		Version:           status.Child("version").Get(""),
+		Hostname:          status.Child("hostname").Get(""),
+		PID:               readInt(status.Child("pid")),
+		Errors:            map[string]int64{},
+		CoreRustProcessed: readInt(conn.Node(net.stellar, "processed")),
+		Network:           net.name,
+		Passphrase:        net.passphrase,
+	}
+	resp.HeartbeatAge = int64(now.Sub(time.Unix(resp.Heartbeat, 0)).Seconds())
+	resp.Stale = now.Sub(time.Unix(resp.Heartbeat, 0)) > maxHeartbeatAge
+	if resp.StartedAt > 0 {
+		resp.UptimeSeconds = int64(now.Sub(time.Unix(resp.StartedAt, 0)).Seconds())
+	}
+
+	stream := status.Child("stream")
+	resp.Stream = StreamStatus{
+		State:      stream.Child("state").Get(""),
+		Since:      readInt(stream.Child("since")),
+		Failures:   readInt(stream.Child("failures")),
+		Reconnects: readInt(stream.Child("reconnects")),
+		LastError:  stream.Child("last_error").Get(""),
+	}
+
+	if retention := status.Child("retention"); retention.HasTree() {
+		resp.Retention = &RetentionStatus{
+			DryRun:       retention.Child("dry_run").Get("") == "true",
+			Through:      readInt(retention.Child("through")),
+			LastRun:      readInt(retention.Child("last_run")),
+			Ledgers:      readInt(retention.Child("ledgers")),
+			Transactions: readInt(retention.Child("transactions")),
+			Kept:         readInt(retention.Child("kept")),
+			Nodes:        readInt(retention.Child("nodes")),
+			Bytes:        readInt(retention.Child("bytes")),
+		}
+	}
+
+	for _, name := range ingestorErrorCounters {
+		resp.Errors[name] = readInt(status.Child("errors", name))
+	}
+	return resp
+}
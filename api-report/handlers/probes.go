@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// /livez answers whether this process can still use YottaDB; /readyz whether the node
+// as a whole is serving fresh data: YottaDB, Horizon, the last committed ledger, the
+// ingestor heartbeat at ^Ledger("timestamp") and core-rust's ^Stellar("processed").
+// The per-network checks run for every network; those of networks other than the
+// default are named "<network>.<check>".
+
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+)
+
+// Probe thresholds, set by InitProbes
+var (
+	maxLedgerAge    = 60 * time.Second
+	maxHeartbeatAge = 60 * time.Second
+)
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Status     string      `json:"status"` // pass or fail
+	Message    string      `json:"message,omitempty"`
+	Observed   interface{} `json:"observed,omitempty"`
+	DurationMs float64     `json:"duration_ms"`
+}
+
+// ProbeResponse is the body of /livez and /readyz; Status is ok only if every check passes
+type ProbeResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type probeCheck struct {
+	name string
+	run  func(conn *yottadb.Conn, net *stellarNetwork) (observed interface{}, err error)
+	net  *stellarNetwork // Network a per-network check runs against
+}
+
+// InitProbes reads READY_MAX_LEDGER_AGE and READY_MAX_HEARTBEAT_AGE
+func InitProbes() {
+	if age, err := time.ParseDuration(os.Getenv("READY_MAX_LEDGER_AGE")); err == nil && age > 0 {
+		maxLedgerAge = age
+	}
+	if age, err := time.ParseDuration(os.Getenv("READY_MAX_HEARTBEAT_AGE")); err == nil && age > 0 {
+		maxHeartbeatAge = age
+	}
+	slog.Info("Readiness thresholds configured", "max_ledger_age", maxLedgerAge.String(), "max_heartbeat_age", maxHeartbeatAge.String())
+}
+
+// Livez reports whether this process can read and write YottaDB
+func Livez(w http.ResponseWriter, r *http.Request) {
+	runProbe(w, []probeCheck{
+		{name: "yottadb", run: checkYottaDB},
+	})
+}
+
+// Readyz reports whether the node is ready to serve current data
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := []probeCheck{{name: "yottadb", run: checkYottaDB}}
+	for _, net := range networks {
+		prefix := ""
+		if net != defaultNetwork {
+			prefix = net.name + "."
+		}
+		checks = append(checks,
+			probeCheck{prefix + "horizon", checkHorizon, net},
+			probeCheck{prefix + "ledger_age", checkLedgerAge, net},
+			probeCheck{prefix + "heartbeat", checkHeartbeat, net},
+			probeCheck{prefix + "stream", checkStream, net},
+			probeCheck{prefix + "core_rust", checkCoreRust, net},
+		)
+	}
+	runProbe(w, checks)
+}
+
+func runProbe(w http.ResponseWriter, checks []probeCheck) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	resp := ProbeResponse{Status: "ok", Checks: map[string]CheckResult{}}
+	for _, check := range checks {
+		start := time.Now()
+		observed, err := runCheck(conn, check)
+		result := CheckResult{
+			Status:     CheckPass,
+			Observed:   observed,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			result.Status = CheckFail
+			result.Message = err.Error()
+			resp.Status = CheckFail
+		}
+		resp.Checks[check.name] = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// runCheck runs a check, turning a YottaDB panic into a failure
+func runCheck(conn *yottadb.Conn, check probeCheck) (observed interface{}, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("yottadb: %v", rec)
+		}
+	}()
+	return check.run(conn, check.net)
+}
+
+// checkYottaDB writes a probe value and reads it back
+func checkYottaDB(conn *yottadb.Conn, _ *stellarNetwork) (interface{}, error) {
+	value := strconv.FormatInt(time.Now().UnixNano(), 10)
+	node := conn.Node("^Health", "api-report", strconv.Itoa(os.Getpid()))
+	node.Set(value)
+	if got := node.Get(""); got != value {
+		return nil, fmt.Errorf("read back %q after writing %q", got, value)
+	}
+	node.Kill()
+	return nil, nil
+}
+
+// checkHorizon passes while at least one Horizon endpoint is usable. The pool probes
+// every endpoint in the background, so this makes no request of its own.
+func checkHorizon(_ *yottadb.Conn, net *stellarNetwork) (interface{}, error) {
+	endpoints, usable := net.pool.Snapshot()
+	observed := map[string]interface{}{"active": net.pool.Active(), "endpoints": endpoints}
+	if !usable {
+		return observed, fmt.Errorf("no usable Horizon endpoint")
+	}
+	return observed, nil
+}
+
+// checkLedgerAge compares the close time of ^Stellar("latest") with maxLedgerAge
+func checkLedgerAge(conn *yottadb.Conn, net *stellarNetwork) (interface{}, error) {
+	seq := conn.Node(net.stellar, "latest").Get("")
+	if seq == "" {
+		return nil, fmt.Errorf("no ledger committed yet")
+	}
+	closedAt, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", conn.Node(net.stellar, "ledger", seq, "closed_at").Get(""))
+	if err != nil {
+		return map[string]interface{}{"ledger": seq}, fmt.Errorf("ledger %s has no valid closed_at", seq)
+	}
+
+	age := time.Since(closedAt)
+	observed := map[string]interface{}{
+		"ledger":      seq,
+		"closed_at":   closedAt.UTC().Format(time.RFC3339),
+		"age_seconds": int64(age.Seconds()),
+		"max_age":     maxLedgerAge.String(),
+	}
+	if age > maxLedgerAge {
+		return observed, fmt.Errorf("last committed ledger is %s old", age.Truncate(time.Second))
+	}
+	return observed, nil
+}
+
+// checkHeartbeat compares the ingestor's ^Ledger("timestamp") with maxHeartbeatAge
+func checkHeartbeat(conn *yottadb.Conn, net *stellarNetwork) (interface{}, error) {
+	ts, err := strconv.ParseInt(conn.Node(net.ledger, "timestamp").Get(""), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("no ingestor heartbeat")
+	}
+
+	age := time.Since(time.Unix(ts, 0))
+	observed := map[string]interface{}{
+		"timestamp":   ts,
+		"age_seconds": int64(age.Seconds()),
+		"max_age":     maxHeartbeatAge.String(),
+	}
+	if age > maxHeartbeatAge {
+		return observed, fmt.Errorf("ingestor heartbeat is %s old", age.Truncate(time.Second))
+	}
+	return observed, nil
+}
+
+// checkStream fails while the ingestor's circuit breaker has given up on Horizon.
+// Short reconnects pass; ledger_age catches a stream that is slow to recover.
+func checkStream(conn *yottadb.Conn, net *stellarNetwork) (interface{}, error) {
+	stream := conn.Node(net.ledger, "status", "stream")
+	state := stream.Child("state").Get("")
+	if state == "" {
+		return nil, nil // Ingestor predates stream reporting or hasn't connected yet
+	}
+	observed := map[string]interface{}{
+		"state":    state,
+		"failures": stream.Child("failures").Get("0"),
+	}
+	if state == "open" {
+		return observed, fmt.Errorf("ledger stream circuit is open: %s", stream.Child("last_error").Get(""))
+	}
+	return observed, nil
+}
+
+// checkCoreRust requires core-rust to have recorded the last ledger it processed
+func checkCoreRust(conn *yottadb.Conn, net *stellarNetwork) (interface{}, error) {
+	processed, err := strconv.ParseInt(conn.Node(net.stellar, "processed").Get(""), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("core-rust has not recorded a processed ledger")
+	}
+	observed := map[string]interface{}{"processed_ledger": processed}
+	if latest, err := strconv.ParseInt(conn.Node(net.stellar, "latest").Get(""), 10, 64); err == nil {
+		observed["behind_ledgers"] = max(latest-processed, 0)
+	}
+	return observed, nil
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket refills continuously at rate tokens/second up to burst
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter holds one token bucket per client identity
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+// Limiters configured by InitRateLimits (requests per minute)
+var (
+	keyLimiter       *rateLimiter
+	ipLimiter        *rateLimiter
+	hydrationLimiter *rateLimiter
+	trustedProxies   []*net.IPNet // Peers whose X-Forwarded-For is believed; none by default
+)
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// InitRateLimits configures the per-key, per-IP and hydration budgets from the environment
+func InitRateLimits() {
+	keyLimiter = newRateLimiter(envInt("RATE_LIMIT_KEY_PER_MINUTE", 600))
+	ipLimiter = newRateLimiter(envInt("RATE_LIMIT_IP_PER_MINUTE", 1200))
+	hydrationLimiter = newRateLimiter(envInt("RATE_LIMIT_HYDRATION_PER_MINUTE", 30))
+	trustedProxies = parseCIDRList("RATE_LIMIT_TRUSTED_PROXIES")
+
+	go func() {
+		for range time.Tick(5 * time.Minute) {
+			keyLimiter.sweep()
+			ipLimiter.sweep()
+			hydrationLimiter.sweep()
+		}
+	}()
+
+	slog.Info("Rate limits configured", "per_key_per_minute", keyLimiter.burst,
+		"per_ip_per_minute", ipLimiter.burst, "hydrations_per_minute", hydrationLimiter.burst,
+		"trusted_proxies", len(trustedProxies))
+}
+
+// parseCIDRList reads the environment variable name as a comma-separated list of CIDRs
+// or single IPs
+func parseCIDRList(name string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(os.Getenv(name), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			slog.Warn("Ignoring invalid network", "variable", name, "entry", entry, "error", err)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && inNetworks(ip, trustedProxies)
+}
+
+func inNetworks(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func envInt(name string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+// take consumes one token for id. It returns whether the request is allowed, the
+// tokens left, and how long until the bucket is full again (or, when denied, until
+// the next token is available).
+func (l *rateLimiter) take(id string) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[id] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, 0, wait
+	}
+
+	b.tokens--
+	full := time.Duration((l.burst - b.tokens) / l.rate * float64(time.Second))
+	return true, int(b.tokens), full
+}
+
+// sweep drops buckets that have refilled completely, bounding memory for one-off clients
+func (l *rateLimiter) sweep() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for id, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// limit applies l to id, writing RateLimit-* headers and a 429 when exhausted
+func (l *rateLimiter) limit(w http.ResponseWriter, id, policy string) bool {
+	allowed, remaining, reset := l.take(id)
+
+	resetSecs := int(math.Ceil(reset.Seconds()))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(int(l.burst)))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(resetSecs))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=60;comment=%q", int(l.burst), policy))
+
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(resetSecs))
+		sendError(w, fmt.Sprintf("Rate limit exceeded (%s)", policy), http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// IPRateLimitMiddleware limits requests per client IP, before authentication
+func IPRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ipLimiter.limit(w, clientIP(r), "ip") {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// KeyRateLimitMiddleware limits requests per authenticated API key
+func KeyRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := APIKeyFromContext(r.Context()); key != nil {
+			if !keyLimiter.limit(w, key.ID, "key") {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowHydration spends from the tighter budget for requests that trigger a Horizon
+// call. It writes a 429 and returns false when the caller's budget is exhausted.
+func allowHydration(w http.ResponseWriter, r *http.Request) bool {
+	if hydrationLimiter == nil {
+		return true
+	}
+	id := "ip:" + clientIP(r)
+	if key := APIKeyFromContext(r.Context()); key != nil {
+		id = "key:" + key.ID
+	}
+	return hydrationLimiter.limit(w, id, "hydration")
+}
+
+// clientIP returns the caller's address. X-Forwarded-For is only consulted when the
+// connection comes from a trusted proxy; its entries are then read right to left,
+// skipping further trusted proxies, so a client cannot choose its own address by
+// prepending to the header.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+	parts := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(parts) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(parts[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
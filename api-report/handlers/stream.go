@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lockb0x-llc/pakana-node-0/pkg/stellartx"
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+const (
+	streamPollInterval = 1 * time.Second
+	streamHeartbeat    = 15 * time.Second
+	streamReplayLimit  = 100 // Max ledgers replayed on Last-Event-ID resumption
+)
+
+// LedgerEvent is the payload of a "ledger" stream event
+type LedgerEvent struct {
+	LedgerResponse
+	Transactions []string `json:"transactions"`
+}
+
+// ledgerHub watches a network's ^Stellar("latest") and wakes stream subscribers when it
+// advances. Subscribers keep their own cursor, so a missed wake-up never loses a ledger.
+type ledgerHub struct {
+	mu     sync.Mutex
+	latest int64
+	subs   map[chan struct{}]struct{}
+}
+
+// StartLedgerWatcher polls each network's atomic commit pointer written by api-go
+func StartLedgerWatcher() {
+	for _, net := range networks {
+		go net.hub.run(net, streamPollInterval)
+	}
+	slog.Info("Ledger watcher started", "poll_interval", streamPollInterval.String(), "networks", networkNames())
+}
+
+func (h *ledgerHub) run(net *stellarNetwork, interval time.Duration) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		latest := readLatestSeq(conn, net)
+		h.publish(latest)
+	}
+}
+
+func (h *ledgerHub) publish(latest int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if latest <= h.latest {
+		return
+	}
+	h.latest = latest
+	for ch := range h.subs {
+		select {
+		case ch <- struct{}{}:
+		default: // Wake-up already pending
+		}
+	}
+}
+
+func (h *ledgerHub) subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, ch)
+		h.mu.Unlock()
+	}
+}
+
+// StreamLedgers pushes a "ledger" event for every ledger committed to the network's ^Stellar
+func StreamLedgers(w http.ResponseWriter, r *http.Request) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+	net := networkOf(r.Context())
+
+	wake, unsubscribe := net.hub.subscribe()
+	defer unsubscribe()
+
+	latest := readLatestSeq(conn, net)
+
+	cursor, resumed := lastEventID(r)
+	if !resumed {
+		cursor = latest - 1 // Start with the current ledger
+	}
+
+	rc := startStream(w)
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		latest = readLatestSeq(conn, net)
+
+		skipped, err := skipGap(w, cursor, latest)
+		if err != nil {
+			return
+		}
+		cursor = skipped
+		for seq := cursor + 1; seq <= latest; seq++ {
+			event, err := fetchLedgerEvent(conn, net, seq)
+			if err != nil {
+				continue // Gap in local history
+			}
+			if err := writeEvent(w, seq, "ledger", event); err != nil {
+				return
+			}
+		}
+		if latest > cursor {
+			cursor = latest
+		}
+		rc.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+	}
+}
+
+// StreamAccount pushes "transaction" events for ingested transactions touching the
+// account and an "account" event whenever its stored state changes.
+func StreamAccount(w http.ResponseWriter, r *http.Request) {
+	accountID := getPathVar(r, "id")
+	if accountID == "" {
+		sendError(w, "Account ID required", http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+	net := networkOf(r.Context())
+
+	account, err := fetchAccount(conn, net, accountID, true)
+	if err != nil {
+		if !allowHydration(w, r) {
+			return
+		}
+		// Hydrating also marks the account as ^Tracked, so core-rust keeps it current
+		if err := hydrateAccount(r.Context(), accountID); err == nil {
+			account, err = fetchAccount(conn, net, accountID, true)
+		}
+	}
+	latest := readLatestSeq(conn, net)
+
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	wake, unsubscribe := net.hub.subscribe()
+	defer unsubscribe()
+
+	cursor, resumed := lastEventID(r)
+	if !resumed {
+		cursor = latest
+	}
+
+	rc := startStream(w)
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	// Initial snapshot, unless the client has already seen the current ledger
+	fingerprint := accountFingerprint(account)
+	if !resumed || cursor < latest {
+		if err := writeEvent(w, latest, "account", account); err != nil {
+			return
+		}
+	}
+
+	for {
+		latest = readLatestSeq(conn, net)
+
+		skipped, err := skipGap(w, cursor, latest)
+		if err != nil {
+			return
+		}
+		cursor = skipped
+		for seq := cursor + 1; seq <= latest; seq++ {
+			txs := fetchLedgerTransactions(conn, net, seq)
+
+			for _, tx := range txs {
+				participants, err := stellartx.ParticipantsXDR(tx.XDR)
+				if err != nil || !participants[accountID] {
+					continue
+				}
+				if err := writeEvent(w, seq, "transaction", tx); err != nil {
+					return
+				}
+			}
+		}
+
+		account, err = fetchAccount(conn, net, accountID, true)
+		if err == nil {
+			if fp := accountFingerprint(account); fp != fingerprint {
+				fingerprint = fp
+				if err := writeEvent(w, latest, "account", account); err != nil {
+					return
+				}
+			}
+		}
+		if latest > cursor {
+			cursor = latest
+		}
+		rc.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+	}
+}
+
+// startStream writes the SSE headers and lifts the server's WriteTimeout for this response
+func startStream(w http.ResponseWriter) *http.ResponseController {
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+	return rc
+}
+
+// lastEventID parses the Last-Event-ID header (a ledger sequence) sent on reconnect
+func lastEventID(r *http.Request) (int64, bool) {
+	header := r.Header.Get("Last-Event-ID")
+	if header == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+func writeEvent(w io.Writer, id int64, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, payload)
+	return err
+}
+
+// GapEvent is the payload of a "gap" stream event: ledgers a resuming client missed
+// beyond streamReplayLimit, which it should fetch through the REST endpoints
+type GapEvent struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// skipGap moves a cursor more than streamReplayLimit behind latest up to the replay
+// window, telling the client which ledgers it skipped with a "gap" event. The event id
+// is the last skipped ledger, so a client reconnecting after it is not told twice.
+func skipGap(w io.Writer, cursor, latest int64) (int64, error) {
+	if latest-cursor <= streamReplayLimit {
+		return cursor, nil
+	}
+	gap := GapEvent{From: cursor + 1, To: latest - streamReplayLimit}
+	return gap.To, writeEvent(w, gap.To, "gap", gap)
+}
+
+func accountFingerprint(account *AccountResponse) string {
+	fp, _ := json.Marshal(account)
+	return string(fp)
+}
+
+func readLatestSeq(conn *yottadb.Conn, net *stellarNetwork) int64 {
+	latest, _ := strconv.ParseInt(conn.Node(net.stellar, "latest").Get("0"), 10, 64)
+	return latest
+}
+
+// readIngestedSeq is the last ledger api-go's stream committed, or latest for an
+// ingestor that predates ^Stellar("ingested")
+func readIngestedSeq(conn *yottadb.Conn, net *stellarNetwork) int64 {
+	if ingested, err := strconv.ParseInt(conn.Node(net.stellar, "ingested").Get(""), 10, 64); err == nil {
+		return ingested
+	}
+	return readLatestSeq(conn, net)
+}
+
+func fetchLedgerEvent(conn *yottadb.Conn, net *stellarNetwork, seq int64) (*LedgerEvent, error) {
+	ledger, err := fetchLedger(conn, net, seq)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := []string{}
+	for _, tx := range fetchLedgerTransactions(conn, net, seq) {
+		hashes = append(hashes, tx.Hash)
+	}
+	return &LedgerEvent{LedgerResponse: *ledger, Transactions: hashes}, nil
+}
+
+// fetchLedgerTransactions returns the ingested ^Stellar("ledger", seq, "tx", idx) records,
+// followed by any transactions stored in the hydrated slot
+func fetchLedgerTransactions(conn *yottadb.Conn, net *stellarNetwork, seq int64) []TransactionResponse {
+	var txs []TransactionResponse
+	seqStr := strconv.FormatInt(seq, 10)
+
+	txNode := conn.Node(net.stellar, "ledger", seqStr, "tx", "").Next()
+	for txNode != nil {
+		if hash := txNode.Child("hash").Get(""); hash != "" {
+			txs = append(txs, TransactionResponse{
+				Hash:      hash,
+				LedgerSeq: seq,
+				XDR:       txNode.Child("xdr").Get(""),
+			})
+		}
+		txNode = txNode.Next()
+	}
+
+	hydratedNode := conn.Node(net.stellar, "ledger", seqStr, "tx", "hydrated", "").Next()
+	for hydratedNode != nil {
+		txs = append(txs, TransactionResponse{
+			Hash:      hydratedNode.Child("hash").Get(""),
+			LedgerSeq: seq,
+			XDR:       hydratedNode.Child("xdr").Get(""),
+		})
+		hydratedNode = hydratedNode.Next()
+	}
+
+	return txs
+}
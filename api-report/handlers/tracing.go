@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// Tracing is set up by pkg/tracing. Requests get server spans from TracingMiddleware,
+// Horizon calls client spans, and YottaDB transactions "ydb.tp" spans.
+
+var tracer = otel.Tracer("api-report")
+
+// untracedPaths are polled by probes and scrapers and would only add noise
+var untracedPaths = map[string]bool{"/health": true, "/livez": true, "/readyz": true, "/metrics": true, "/ping": true}
+
+// TracingMiddleware starts a server span per request, continuing the caller's trace
+// from traceparent. Spans are named after the route template.
+func TracingMiddleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + routeTemplate(r)
+		}),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return !untracedPaths[r.URL.Path]
+		}),
+	)
+}
+
+// transaction runs fn in a YottaDB transaction under a "ydb.tp <name>" span that
+// records how many attempts the commit took
+func transaction(ctx context.Context, conn *yottadb.Conn, name string, fn func() int) bool {
+	_, span := tracer.Start(ctx, "ydb.tp "+name)
+	defer span.End()
+
+	attempts := 0
+	ok := conn.Transaction("", nil, func() int {
+		attempts++
+		return fn()
+	})
+	span.SetAttributes(attribute.Int("ydb.tp.attempts", attempts))
+	if !ok {
+		span.SetStatus(codes.Error, "transaction failed")
+	}
+	return ok
+}
+
+// horizonServer labels a Horizon span with the endpoint net's pool is using
+func horizonServer(net *stellarNetwork) attribute.KeyValue {
+	return attribute.String("server.address", net.pool.Active())
+}
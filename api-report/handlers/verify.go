@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"api-report/codex"
+
+	"github.com/stellar/go-stellar-sdk/txnbuild"
+	"github.com/stellar/go-stellar-sdk/xdr"
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// Lockb0xProof is a self-contained proof that a pointer hash was committed on-chain.
+// Anyone can re-check it: the envelope hashes (with the network passphrase) to the
+// transaction hash, carries the pointer hash, and was included in the given ledger.
+type Lockb0xProof struct {
+	PointerHash       string           `json:"pointer_hash"`
+	Anchored          bool             `json:"anchored"` // An anchoring transaction is known
+	Verified          bool             `json:"verified"`
+	Reason            string           `json:"reason,omitempty"`
+	Commitment        string           `json:"commitment,omitempty"` // memo_hash or manage_data
+	Transaction       ProofTransaction `json:"transaction"`
+	Ledger            ProofLedger      `json:"ledger"`
+	NetworkPassphrase string           `json:"network_passphrase"`
+	Source            string           `json:"source"` // local or horizon
+
+	Batch *codex.BatchProof `json:"batch,omitempty"` // Set when anchored through a Merkle root
+
+	Attestations *AttestationSet `json:"attestations,omitempty"` // Parties' signatures over the record
+}
+
+type ProofTransaction struct {
+	Hash          string `json:"hash"`
+	SourceAccount string `json:"source_account,omitempty"`
+	EnvelopeXDR   string `json:"envelope_xdr"`
+	ResultXDR     string `json:"result_xdr,omitempty"`
+	Successful    bool   `json:"successful"`
+}
+
+type ProofLedger struct {
+	Sequence int64  `json:"sequence"`
+	Hash     string `json:"hash"`
+	ClosedAt string `json:"closed_at"`
+}
+
+// VerifyLockb0x proves a pointer hash is anchored. The anchoring transaction is the
+// record's tx_hash, or ?tx_hash= for anchors submitted outside this node. A record with
+// neither is reported as unanchored rather than as an error.
+func VerifyLockb0x(w http.ResponseWriter, r *http.Request) {
+	hash := getPathVar(r, "hash")
+	if !isPointerHash(hash) {
+		sendError(w, "Invalid Pointer Hash (Must be SHA-256 hex)", http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	record, _ := fetchLockb0xRecord(conn, hash)
+	proof, ok := lockb0xProof(w, r, conn, hash, record, r.URL.Query().Get("tx_hash"))
+	if !ok {
+		return
+	}
+	if record != nil {
+		if set := attestationSet(conn, record); len(set.Requests) > 0 || len(set.Attestations) > 0 {
+			proof.Attestations = set
+		}
+	}
+	sendJSON(w, proof)
+}
+
+// lockb0xProof builds the proof for hash. Batched records are proven through their
+// Merkle root: the inclusion proof is checked and the root's anchor is verified.
+func lockb0xProof(w http.ResponseWriter, r *http.Request, conn *yottadb.Conn, hash string, record *Lockb0xRecord, txHash string) (*Lockb0xProof, bool) {
+	committed := hash
+	var batch *codex.BatchProof
+	if record != nil {
+		if txHash == "" {
+			txHash = record.TxHash
+		}
+		batch = record.Batch
+	}
+	if batch != nil {
+		committed = batch.Root
+		if txHash == "" {
+			if root, err := fetchLockb0xRecord(conn, batch.Root); err == nil {
+				txHash = root.TxHash
+			}
+		}
+	}
+	if txHash == "" {
+		if record == nil {
+			sendError(w, "Lockb0x record not found", http.StatusNotFound)
+			return nil, false
+		}
+		return &Lockb0xProof{
+			PointerHash:       hash,
+			Reason:            fmt.Sprintf("Pointer hash has not been anchored (status: %s)", record.Status),
+			NetworkPassphrase: networkPassphrase,
+			Source:            "local",
+			Batch:             batch,
+		}, true
+	}
+
+	proof, ok := buildLockb0xProof(w, r, conn, committed, txHash)
+	if !ok {
+		return nil, false
+	}
+	proof.PointerHash = hash
+	proof.Batch = batch
+	if batch != nil && !codex.VerifyMerkleProof(hash, batch.Proof, batch.Root) {
+		proof.Verified = false
+		proof.Reason = "Pointer hash is not included in the batch root"
+	}
+	return proof, true
+}
+
+// buildLockb0xProof assembles and checks the proof for hash anchored by txHash. It writes
+// an error response and returns false if the transaction or its ledger can't be found.
+func buildLockb0xProof(w http.ResponseWriter, r *http.Request, conn *yottadb.Conn, hash, txHash string) (*Lockb0xProof, bool) {
+	ctx := withNetwork(r.Context(), lockb0xNetwork)
+	proof := &Lockb0xProof{
+		PointerHash:       hash,
+		NetworkPassphrase: networkPassphrase,
+		Source:            "local",
+	}
+
+	// 1. Anchoring transaction via ^Stellar("tx_hash"), hydrating from Horizon if needed
+	tx, err := fetchTransaction(conn, lockb0xNetwork, txHash)
+	recordLookup("transaction", err == nil)
+	if err != nil {
+		if !allowHydration(w, r) {
+			return nil, false
+		}
+		requestLogger(r).Info("Anchor transaction not found locally, hydrating from Horizon", "tx_hash", txHash)
+		if err := hydrateTransaction(ctx, txHash); err != nil {
+			sendError(w, "Anchoring transaction not found", http.StatusNotFound)
+			return nil, false
+		}
+		proof.Source = "horizon"
+		if tx, err = fetchTransaction(conn, lockb0xNetwork, txHash); err != nil {
+			sendError(w, "Anchoring transaction not found after hydration", http.StatusNotFound)
+			return nil, false
+		}
+	}
+	if tx.Successful == nil {
+		// Hydrated before results were recorded; hydrate again for the result
+		if !allowHydration(w, r) {
+			return nil, false
+		}
+		if err := hydrateTransaction(ctx, txHash); err != nil {
+			sendError(w, "Anchoring transaction result not available", http.StatusBadGateway)
+			return nil, false
+		}
+		proof.Source = "horizon"
+		if tx, err = fetchTransaction(conn, lockb0xNetwork, txHash); err != nil || tx.Successful == nil {
+			sendError(w, "Anchoring transaction result not available", http.StatusBadGateway)
+			return nil, false
+		}
+	}
+	proof.Anchored = true
+	proof.Transaction = ProofTransaction{Hash: tx.Hash, EnvelopeXDR: tx.XDR, ResultXDR: tx.ResultXDR, Successful: *tx.Successful}
+
+	// 2. Ledger header for the close time and hash. Headers hydrated before the hash was
+	// stored are hydrated again.
+	ledger, err := fetchLedger(conn, lockb0xNetwork, tx.LedgerSeq)
+	recordLookup("ledger", err == nil)
+	if err != nil || ledger.Hash == "" {
+		if !allowHydration(w, r) {
+			return nil, false
+		}
+		if err := hydrateLedger(ctx, tx.LedgerSeq); err != nil {
+			sendError(w, "Anchoring ledger not found", http.StatusNotFound)
+			return nil, false
+		}
+		proof.Source = "horizon"
+		if ledger, err = fetchLedger(conn, lockb0xNetwork, tx.LedgerSeq); err != nil {
+			sendError(w, "Anchoring ledger not found after hydration", http.StatusNotFound)
+			return nil, false
+		}
+	}
+	proof.Ledger = ProofLedger{Sequence: ledger.Sequence, Hash: ledger.Hash, ClosedAt: ledger.ClosedAt}
+
+	// 3. Decode the envelope and check what it commits to
+	proof.Verified, proof.Reason = checkAnchorEnvelope(proof, hash)
+	return proof, true
+}
+
+// checkAnchorEnvelope confirms the ledger hash is known, the transaction succeeded, that
+// the stored envelope is the transaction it is indexed under and that it commits to hash
+func checkAnchorEnvelope(proof *Lockb0xProof, hash string) (bool, string) {
+	if proof.Ledger.Hash == "" {
+		return false, "Ledger hash is not known"
+	}
+	if !proof.Transaction.Successful {
+		return false, "Transaction failed on-chain"
+	}
+	if resultXDR := proof.Transaction.ResultXDR; resultXDR != "" {
+		var result xdr.TransactionResult
+		if err := xdr.SafeUnmarshalBase64(resultXDR, &result); err != nil {
+			return false, "Stored transaction result could not be decoded"
+		}
+		if !result.Successful() {
+			return false, fmt.Sprintf("Transaction result is %s, not txSUCCESS", result.Result.Code)
+		}
+	}
+
+	parsed, err := txnbuild.TransactionFromXDR(proof.Transaction.EnvelopeXDR)
+	if err != nil {
+		return false, "Stored envelope could not be decoded"
+	}
+	if envelopeHash, err := parsed.HashHex(networkPassphrase); err != nil || envelopeHash != proof.Transaction.Hash {
+		return false, "Envelope does not hash to the transaction hash on this network"
+	}
+
+	tx, _ := innerTransaction(parsed)
+	if tx == nil {
+		return false, "Stored envelope could not be decoded"
+	}
+	proof.Transaction.SourceAccount = tx.SourceAccount().AccountID
+
+	proof.Commitment = anchorCommitment(tx, hash)
+	if proof.Commitment == "" {
+		return false, "Transaction does not commit to the pointer hash"
+	}
+	return true, ""
+}
@@ -0,0 +1,854 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lockb0x-llc/pakana-node-0/pkg/stellartx"
+	"lang.yottadb.com/go/yottadb/v2"
+)
+
+// Webhook event types
+const (
+	EventAccountBalanceChanged = "account.balance_changed"
+	EventAccountTransaction    = "account.transaction"
+	EventLockb0xStatusChanged  = "lockb0x.status_changed"
+	EventPing                  = "ping"
+)
+
+var webhookEventTypes = map[string]bool{
+	EventAccountBalanceChanged: true,
+	EventAccountTransaction:    true,
+	EventLockb0xStatusChanged:  true,
+}
+
+// Delivery settings (overridable via WEBHOOK_MAX_ATTEMPTS / WEBHOOK_BACKOFF_BASE)
+var (
+	webhookMaxAttempts = 6
+	webhookBackoffBase = 2 * time.Second
+	webhookClient      = &http.Client{Timeout: 10 * time.Second, Transport: publicTransport()}
+	webhookSlots       = make(chan struct{}, 16) // Max concurrent POSTs
+)
+
+// Every delivery is queued under ^Webhook("pending", id) before its first attempt, so
+// retries survive a restart:
+//
+//	^Webhook("pending", id, "subscription_id" | "event" | "event_id" | "payload")
+//	^Webhook("pending", id, "attempts" | "next_at" | "last_error")
+//
+// One scheduler starts the deliveries that are due. An attempt holds a webhookSlots slot
+// only for its POST; between attempts the delivery waits in the queue, so receivers that
+// are down cannot hold up deliveries to the others.
+var webhookQueue = struct {
+	sync.Mutex
+	inFlight map[string]bool
+	wake     chan struct{}
+}{inFlight: make(map[string]bool), wake: make(chan struct{}, 1)}
+
+const webhookQueueInterval = time.Second
+
+// pendingDelivery is one event on its way to one subscription
+type pendingDelivery struct {
+	ID             string
+	SubscriptionID string
+	Event          string
+	EventID        string // Sent as X-Pakana-Delivery
+	Payload        []byte
+	Attempts       int
+	NextAt         time.Time
+	LastError      string
+}
+
+// WebhookSubscription is stored under ^Webhook("sub", id)
+type WebhookSubscription struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	AccountID   string   `json:"account_id,omitempty"`
+	PointerHash string   `json:"pointer_hash,omitempty"`
+	Secret      string   `json:"secret,omitempty"`
+	Active      bool     `json:"active"`
+	CreatedAt   int64    `json:"created_at"`
+}
+
+// WebhookEvent is the JSON body POSTed to subscribers
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt int64       `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// DeadLetter is a delivery that exhausted its retries, stored under ^Webhook("dead", n)
+type DeadLetter struct {
+	ID             int64  `json:"id"`
+	SubscriptionID string `json:"subscription_id"`
+	URL            string `json:"url"`
+	Event          string `json:"event"`
+	DeliveryID     string `json:"delivery_id"`
+	Payload        string `json:"payload"`
+	Error          string `json:"error"`
+	Attempts       int    `json:"attempts"`
+	FailedAt       int64  `json:"failed_at"`
+}
+
+type webhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	AccountID   string   `json:"account_id"`
+	PointerHash string   `json:"pointer_hash"`
+	Secret      string   `json:"secret"`
+	Active      *bool    `json:"active"`
+}
+
+// Event detection keeps its state in ^Webhook too, so changes made while api-report was
+// down are still announced when it starts:
+//
+//	^Webhook("cursor")                    last ledger scanned for account events
+//	^Webhook("watch", "balance", account) balance fingerprint last seen
+//	^Webhook("watch", "lockb0x", hash)    Lockb0x status last announced
+//
+// A record stays watched until it is anchored (with no revocation in flight), revoked
+// or removed.
+
+// StartWebhookDispatcher watches committed ledgers and delivers subscribed events
+func StartWebhookDispatcher() {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	if v, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && v > 0 {
+		webhookMaxAttempts = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("WEBHOOK_BACKOFF_BASE")); err == nil && v > 0 {
+		webhookBackoffBase = v
+	}
+
+	cursor, err := strconv.ParseInt(conn.Node("^Webhook", "cursor").Get(""), 10, 64)
+	if err != nil {
+		cursor = readIngestedSeq(conn, defaultNetwork)
+	}
+	// Drafts created before their status was recorded here start watched, without an
+	// event. Drafts are keyed by hash; older drafts have no "hash" child.
+	for draft := range conn.Node("^Codex", "draft").Children() {
+		node := conn.Node("^Webhook", "watch", "lockb0x", draft.Subscript(-1))
+		if !node.HasValue() {
+			node.Set(draft.Child("status").Get(""))
+		}
+	}
+
+	wake, _ := defaultNetwork.hub.subscribe()
+	go func() {
+		// Catch up on what changed while api-report was down, then follow new ledgers
+		cursor = scanWebhookEvents(cursor)
+		for range wake {
+			cursor = scanWebhookEvents(cursor)
+		}
+	}()
+	go runWebhookQueue()
+	slog.Info("Webhook dispatcher started", "network", defaultNetwork.name, "max_attempts", webhookMaxAttempts, "backoff_base", webhookBackoffBase.String())
+}
+
+// scanWebhookEvents emits events for ledgers in (cursor, ingested] and returns the new
+// cursor, which it also stores in ^Webhook("cursor"). Ledgers are read up to the
+// ingestor's commit pointer: ^Stellar("latest") also moves for hydrated ledgers, whose
+// transactions the ingestor has yet to write.
+func scanWebhookEvents(cursor int64) int64 {
+	conn := acquireConn()
+	defer releaseConn(conn)
+	net := defaultNetwork
+
+	latest := readIngestedSeq(conn, net)
+	subs := loadSubscriptions(conn)
+
+	if latest-cursor > streamReplayLimit {
+		slog.Warn("Webhook scan too far behind; no account.transaction events for skipped ledgers",
+			"from", cursor+1, "to", latest-streamReplayLimit, "replay_limit", streamReplayLimit)
+		cursor = latest - streamReplayLimit
+	}
+
+	watched := make(map[string]bool)
+	for _, sub := range subs {
+		if sub.Active && sub.AccountID != "" {
+			watched[sub.AccountID] = true
+		}
+	}
+
+	// 1. Transactions touching watched accounts
+	if len(watched) > 0 {
+		for seq := cursor + 1; seq <= latest; seq++ {
+			txs := fetchLedgerTransactions(conn, net, seq)
+
+			for _, tx := range txs {
+				participants, err := stellartx.ParticipantsXDR(tx.XDR)
+				if err != nil {
+					continue
+				}
+				for accountID := range watched {
+					if participants[accountID] {
+						emitWebhook(subs, EventAccountTransaction, accountID, "", map[string]interface{}{
+							"account_id": accountID,
+							"hash":       tx.Hash,
+							"ledger_seq": tx.LedgerSeq,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	// 2. Balance changes on watched accounts
+	for accountID := range watched {
+		account, err := fetchAccount(conn, net, accountID, true)
+		if err != nil {
+			continue
+		}
+
+		fp := balanceFingerprint(account)
+		node := conn.Node("^Webhook", "watch", "balance", accountID)
+		previous, seen := node.Get(""), node.HasValue()
+		if !seen || previous != fp {
+			node.Set(fp)
+		}
+
+		if seen && previous != fp {
+			emitWebhook(subs, EventAccountBalanceChanged, accountID, "", map[string]interface{}{
+				"account_id":  account.AccountID,
+				"balance":     account.Balance,
+				"balance_xlm": account.BalanceXLM,
+				"trustlines":  account.Trustlines,
+				"ledger_seq":  latest,
+			})
+		}
+	}
+
+	// 3. Lockb0x status transitions made by other services (e.g. core-rust promotion)
+	var hashes []string
+	for node := range conn.Node("^Webhook", "watch", "lockb0x").Children() {
+		hashes = append(hashes, node.Subscript(-1))
+	}
+
+	for _, hash := range hashes {
+		status := lockb0xStatus(conn, hash)
+		if status != "" {
+			notifyLockb0xStatus(hash, status)
+		}
+
+		revoking := conn.Node("^Codex", hash, "revocation", "status").Get("") == Lockb0xSubmitted
+		if status == "" || status == Lockb0xRevoked || status == Lockb0xAnchored && !revoking {
+			// Promoted, revoked or removed: nothing further to watch
+			conn.Node("^Webhook", "watch", "lockb0x", hash).Kill()
+		}
+	}
+
+	if latest > cursor {
+		cursor = latest
+		conn.Node("^Webhook", "cursor").Set(cursor)
+	}
+	return cursor
+}
+
+// watchLockb0x resumes watching a record in its current status without emitting an
+// event, e.g. an anchored record whose revocation has been submitted
+func watchLockb0x(hash, status string) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+	conn.Node("^Webhook", "watch", "lockb0x", hash).Set(status)
+}
+
+// notifyLockb0xStatus records the current status of a draft and emits an event if it changed
+func notifyLockb0xStatus(hash, status string) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	var previous string
+	changed := false
+	conn.Transaction("", nil, func() int {
+		node := conn.Node("^Webhook", "watch", "lockb0x", hash)
+		previous = node.Get("")
+		changed = !node.HasValue() || previous != status
+		node.Set(status)
+		return yottadb.YDB_OK
+	})
+	if !changed {
+		return
+	}
+
+	subs := loadSubscriptions(conn)
+
+	emitWebhook(subs, EventLockb0xStatusChanged, "", hash, map[string]interface{}{
+		"pointer_hash":    hash,
+		"status":          status,
+		"previous_status": previous,
+	})
+}
+
+func balanceFingerprint(account *AccountResponse) string {
+	fp, _ := json.Marshal([]interface{}{account.Balance, account.Trustlines})
+	return string(fp)
+}
+
+// emitWebhook queues an event for every active subscription that matches it
+func emitWebhook(subs []WebhookSubscription, event, accountID, hash string, data interface{}) {
+	evt := WebhookEvent{
+		ID:        newID(),
+		Event:     event,
+		CreatedAt: time.Now().Unix(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		slog.Error("Webhook event encoding failed", "event", event, "delivery", evt.ID, "error", err)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	queued := false
+	for _, sub := range subs {
+		if !sub.Active || !sub.subscribes(event) {
+			continue
+		}
+		if sub.AccountID != "" && sub.AccountID != accountID {
+			continue
+		}
+		if sub.PointerHash != "" && sub.PointerHash != hash {
+			continue
+		}
+		d := pendingDelivery{
+			ID:             evt.ID + "." + sub.ID,
+			SubscriptionID: sub.ID,
+			Event:          event,
+			EventID:        evt.ID,
+			Payload:        payload,
+			NextAt:         time.Now(),
+		}
+		if !savePendingDelivery(conn, d) {
+			slog.Error("Failed to queue webhook delivery", "subscription", sub.ID, "delivery", evt.ID)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		select {
+		case webhookQueue.wake <- struct{}{}:
+		default: // Wake-up already pending
+		}
+	}
+}
+
+func (s WebhookSubscription) subscribes(event string) bool {
+	for _, e := range s.Events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// runWebhookQueue starts due deliveries whenever an event is queued and every
+// webhookQueueInterval, including those left pending by a previous run
+func runWebhookQueue() {
+	ticker := time.NewTicker(webhookQueueInterval)
+	defer ticker.Stop()
+	for {
+		dispatchDueWebhooks()
+		select {
+		case <-webhookQueue.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func dispatchDueWebhooks() {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	now := time.Now()
+	for node := range conn.Node("^Webhook", "pending").Children() {
+		id := node.Subscript(-1)
+		nextAt, _ := strconv.ParseInt(node.Child("next_at").Get("0"), 10, 64)
+		if time.UnixMilli(nextAt).After(now) {
+			continue
+		}
+
+		webhookQueue.Lock()
+		busy := webhookQueue.inFlight[id]
+		webhookQueue.inFlight[id] = true
+		webhookQueue.Unlock()
+		if busy {
+			continue
+		}
+
+		d := readPendingDelivery(node)
+		sub, err := loadSubscription(conn, d.SubscriptionID)
+		if err != nil || !sub.Active {
+			slog.Info("Dropping webhook delivery for a removed or inactive subscription",
+				"subscription", d.SubscriptionID, "delivery", d.EventID)
+			node.Kill()
+			webhookQueue.Lock()
+			delete(webhookQueue.inFlight, id)
+			webhookQueue.Unlock()
+			continue
+		}
+		go deliverWebhook(*sub, d)
+	}
+}
+
+// deliverWebhook makes one attempt and records its outcome in the queue
+func deliverWebhook(sub WebhookSubscription, d pendingDelivery) {
+	defer func() {
+		webhookQueue.Lock()
+		delete(webhookQueue.inFlight, d.ID)
+		webhookQueue.Unlock()
+	}()
+
+	done := attemptWebhook(sub, &d)
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+	if !settleDelivery(conn, sub, d, done) {
+		slog.Error("Failed to record webhook delivery attempt", "subscription", sub.ID, "delivery", d.EventID)
+	}
+}
+
+// attemptWebhook POSTs the delivery once, holding a slot only for the request. A failed
+// attempt is scheduled again with exponential backoff. It reports whether the delivery
+// is finished: delivered, or failed after webhookMaxAttempts attempts.
+func attemptWebhook(sub WebhookSubscription, d *pendingDelivery) bool {
+	webhookSlots <- struct{}{}
+	err := postWebhook(sub, d.Event, d.EventID, d.Payload)
+	<-webhookSlots
+
+	d.Attempts++
+	if err == nil {
+		d.LastError = ""
+		return true
+	}
+	d.LastError = err.Error()
+	slog.Warn("Webhook delivery attempt failed", "subscription", sub.ID, "delivery", d.EventID,
+		"attempt", d.Attempts, "max_attempts", webhookMaxAttempts, "error", err)
+	if d.Attempts >= webhookMaxAttempts {
+		return true
+	}
+	d.NextAt = time.Now().Add(webhookBackoff(d.Attempts))
+	return false
+}
+
+// webhookBackoff is the wait after the given failed attempt: base, 2×base, 4×base, ...
+func webhookBackoff(attempt int) time.Duration {
+	return webhookBackoffBase * time.Duration(1<<(attempt-1))
+}
+
+// settleDelivery reschedules an unfinished delivery, or removes a finished one from the
+// queue, dead-lettering it if it failed
+func settleDelivery(conn *yottadb.Conn, sub WebhookSubscription, d pendingDelivery, done bool) bool {
+	return conn.Transaction("", nil, func() int {
+		node := conn.Node("^Webhook", "pending", d.ID)
+		if !done {
+			node.Child("attempts").Set(d.Attempts)
+			node.Child("next_at").Set(d.NextAt.UnixMilli())
+			node.Child("last_error").Set(d.LastError)
+			return yottadb.YDB_OK
+		}
+		if d.LastError != "" {
+			writeDeadLetter(conn, DeadLetter{
+				SubscriptionID: sub.ID,
+				URL:            sub.URL,
+				Event:          d.Event,
+				DeliveryID:     d.EventID,
+				Payload:        string(d.Payload),
+				Error:          d.LastError,
+				Attempts:       d.Attempts,
+				FailedAt:       time.Now().Unix(),
+			})
+		}
+		node.Kill()
+		return yottadb.YDB_OK
+	})
+}
+
+func postWebhook(sub WebhookSubscription, event, deliveryID string, payload []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Pakana-Webhook/1.0")
+	req.Header.Set("X-Pakana-Event", event)
+	req.Header.Set("X-Pakana-Delivery", deliveryID)
+	req.Header.Set("X-Pakana-Timestamp", timestamp)
+	req.Header.Set("X-Pakana-Signature", "sha256="+signWebhook(sub.Secret, timestamp, payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signWebhook computes hex(HMAC-SHA256(secret, timestamp + "." + payload))
+func signWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ListWebhooks returns all subscriptions (secrets omitted)
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	subs := loadSubscriptions(conn)
+
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	sendJSON(w, map[string]interface{}{"webhooks": subs})
+}
+
+func GetWebhook(w http.ResponseWriter, r *http.Request) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	id := getPathVar(r, "webhook")
+
+	sub, err := loadSubscription(conn, id)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sub.Secret = ""
+	sendJSON(w, sub)
+}
+
+// CreateWebhook registers a subscription; the signing secret is returned only once
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sub := WebhookSubscription{
+		ID:          newID(),
+		URL:         req.URL,
+		Events:      req.Events,
+		AccountID:   req.AccountID,
+		PointerHash: req.PointerHash,
+		Secret:      req.Secret,
+		Active:      true,
+		CreatedAt:   time.Now().Unix(),
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+	if sub.Secret == "" {
+		sub.Secret = newID() + newID()
+	}
+	if msg := validateWebhook(sub); msg != "" {
+		sendError(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	// Account events need the account in ^Tracked so core-rust keeps its state current.
+	// Webhooks follow the default network whatever ?network= says.
+	if sub.AccountID != "" {
+		if _, err := fetchAccount(conn, defaultNetwork, sub.AccountID, false); err != nil {
+			if !allowHydration(w, r) {
+				return
+			}
+			if err := hydrateAccount(withNetwork(r.Context(), defaultNetwork), sub.AccountID); err != nil {
+				sendError(w, fmt.Sprintf("Account hydration failed: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	if !saveSubscription(conn, sub) {
+		sendError(w, "Failed to save webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// UpdateWebhook replaces the mutable fields of a subscription
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id := getPathVar(r, "webhook")
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	sub, err := loadSubscription(conn, id)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if req.URL != "" {
+		sub.URL = req.URL
+	}
+	if req.Events != nil {
+		sub.Events = req.Events
+	}
+	if req.Secret != "" {
+		sub.Secret = req.Secret
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+	if msg := validateWebhook(*sub); msg != "" {
+		sendError(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if !saveSubscription(conn, *sub) {
+		sendError(w, "Failed to save webhook", http.StatusInternalServerError)
+		return
+	}
+
+	sub.Secret = ""
+	sendJSON(w, sub)
+}
+
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	id := getPathVar(r, "webhook")
+
+	if _, err := loadSubscription(conn, id); err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	conn.Node("^Webhook", "sub", id).Kill()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TestWebhook synchronously delivers a "ping" event so receivers can verify signatures
+func TestWebhook(w http.ResponseWriter, r *http.Request) {
+	id := getPathVar(r, "webhook")
+
+	conn := acquireConn()
+	sub, err := loadSubscription(conn, id)
+	releaseConn(conn)
+
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	evt := WebhookEvent{
+		ID:        newID(),
+		Event:     EventPing,
+		CreatedAt: time.Now().Unix(),
+		Data:      map[string]string{"subscription_id": sub.ID},
+	}
+	payload, _ := json.Marshal(evt)
+	if err := postWebhook(*sub, evt.Event, evt.ID, payload); err != nil {
+		sendError(w, fmt.Sprintf("Delivery failed: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	sendJSON(w, map[string]string{"status": "delivered", "delivery_id": evt.ID})
+}
+
+// ListDeadLetters returns the most recent failed deliveries (?subscription=&limit=)
+func ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	conn := acquireConn()
+	defer releaseConn(conn)
+
+	subscription := r.URL.Query().Get("subscription")
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	letters := []DeadLetter{}
+	last, _ := strconv.ParseInt(conn.Node("^Webhook", "dead_seq").Get("0"), 10, 64)
+	for n := last; n > 0 && len(letters) < limit; n-- {
+		node := conn.Node("^Webhook", "dead", strconv.FormatInt(n, 10))
+		if !node.HasTree() {
+			continue
+		}
+		subID := node.Child("subscription_id").Get("")
+		if subscription != "" && subID != subscription {
+			continue
+		}
+		attempts, _ := strconv.Atoi(node.Child("attempts").Get("0"))
+		failedAt, _ := strconv.ParseInt(node.Child("failed_at").Get("0"), 10, 64)
+		letters = append(letters, DeadLetter{
+			ID:             n,
+			SubscriptionID: subID,
+			URL:            node.Child("url").Get(""),
+			Event:          node.Child("event").Get(""),
+			DeliveryID:     node.Child("delivery_id").Get(""),
+			Payload:        node.Child("payload").Get(""),
+			Error:          node.Child("error").Get(""),
+			Attempts:       attempts,
+			FailedAt:       failedAt,
+		})
+	}
+
+	sendJSON(w, map[string]interface{}{"dead_letters": letters})
+}
+
+func validateWebhook(sub WebhookSubscription) string {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "URL must be an absolute http(s) URL"
+	}
+	if len(sub.Events) == 0 {
+		return "At least one event is required"
+	}
+	for _, e := range sub.Events {
+		if !webhookEventTypes[e] && e != "*" {
+			return fmt.Sprintf("Unknown event type: %s", e)
+		}
+		if strings.HasPrefix(e, "account.") && sub.AccountID == "" {
+			return "account_id is required for account events"
+		}
+	}
+	return ""
+}
+
+func saveSubscription(conn *yottadb.Conn, sub WebhookSubscription) bool {
+	return conn.Transaction("", nil, func() int {
+		node := conn.Node("^Webhook", "sub", sub.ID)
+		node.Child("id").Set(sub.ID)
+		node.Child("url").Set(sub.URL)
+		node.Child("events").Set(strings.Join(sub.Events, ","))
+		node.Child("account_id").Set(sub.AccountID)
+		node.Child("pointer_hash").Set(sub.PointerHash)
+		node.Child("secret").Set(sub.Secret)
+		node.Child("active").Set(strconv.FormatBool(sub.Active))
+		node.Child("created_at").Set(sub.CreatedAt)
+		return yottadb.YDB_OK
+	})
+}
+
+func loadSubscription(conn *yottadb.Conn, id string) (*WebhookSubscription, error) {
+	if id == "" {
+		return nil, fmt.Errorf("webhook id required")
+	}
+	node := conn.Node("^Webhook", "sub", id)
+	if !node.HasTree() {
+		return nil, fmt.Errorf("webhook %s not found", id)
+	}
+	return readSubscription(node), nil
+}
+
+func loadSubscriptions(conn *yottadb.Conn) []WebhookSubscription {
+	subs := []WebhookSubscription{}
+	node := conn.Node("^Webhook", "sub", "").Next()
+	for node != nil {
+		subs = append(subs, *readSubscription(node))
+		node = node.Next()
+	}
+	return subs
+}
+
+func readSubscription(node *yottadb.Node) *WebhookSubscription {
+	createdAt, _ := strconv.ParseInt(node.Child("created_at").Get("0"), 10, 64)
+	var events []string
+	if e := node.Child("events").Get(""); e != "" {
+		events = strings.Split(e, ",")
+	}
+	return &WebhookSubscription{
+		ID:          node.Child("id").Get(""),
+		URL:         node.Child("url").Get(""),
+		Events:      events,
+		AccountID:   node.Child("account_id").Get(""),
+		PointerHash: node.Child("pointer_hash").Get(""),
+		Secret:      node.Child("secret").Get(""),
+		Active:      node.Child("active").Get("false") == "true",
+		CreatedAt:   createdAt,
+	}
+}
+
+// writeDeadLetter appends to ^Webhook("dead"). Call inside a transaction.
+func writeDeadLetter(conn *yottadb.Conn, dl DeadLetter) {
+	seqNode := conn.Node("^Webhook", "dead_seq")
+	n, _ := strconv.ParseInt(seqNode.Get("0"), 10, 64)
+	n++
+	seqNode.Set(n)
+
+	node := conn.Node("^Webhook", "dead", strconv.FormatInt(n, 10))
+	node.Child("subscription_id").Set(dl.SubscriptionID)
+	node.Child("url").Set(dl.URL)
+	node.Child("event").Set(dl.Event)
+	node.Child("delivery_id").Set(dl.DeliveryID)
+	node.Child("payload").Set(dl.Payload)
+	node.Child("error").Set(dl.Error)
+	node.Child("attempts").Set(dl.Attempts)
+	node.Child("failed_at").Set(dl.FailedAt)
+}
+
+func savePendingDelivery(conn *yottadb.Conn, d pendingDelivery) bool {
+	return conn.Transaction("", nil, func() int {
+		node := conn.Node("^Webhook", "pending", d.ID)
+		node.Child("subscription_id").Set(d.SubscriptionID)
+		node.Child("event").Set(d.Event)
+		node.Child("event_id").Set(d.EventID)
+		node.Child("payload").Set(string(d.Payload))
+		node.Child("attempts").Set(d.Attempts)
+		node.Child("next_at").Set(d.NextAt.UnixMilli())
+		return yottadb.YDB_OK
+	})
+}
+
+func readPendingDelivery(node *yottadb.Node) pendingDelivery {
+	attempts, _ := strconv.Atoi(node.Child("attempts").Get("0"))
+	nextAt, _ := strconv.ParseInt(node.Child("next_at").Get("0"), 10, 64)
+	return pendingDelivery{
+		ID:             node.Subscript(-1),
+		SubscriptionID: node.Child("subscription_id").Get(""),
+		Event:          node.Child("event").Get(""),
+		EventID:        node.Child("event_id").Get(""),
+		Payload:        []byte(node.Child("payload").Get("")),
+		Attempts:       attempts,
+		NextAt:         time.UnixMilli(nextAt),
+		LastError:      node.Child("last_error").Get(""),
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// allowLoopback lets deliveries reach httptest receivers for the rest of the test
+func allowLoopback(t *testing.T) {
+	t.Helper()
+	saved := verifyInternal
+	verifyInternal = []*net.IPNet{{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}
+	t.Cleanup(func() { verifyInternal = saved })
+}
+
+// verifySignature checks X-Pakana-Signature the way a receiver would
+func verifySignature(t *testing.T, r *http.Request, secret string, body []byte) {
+	t.Helper()
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(r.Header.Get("X-Pakana-Timestamp") + "."))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := r.Header.Get("X-Pakana-Signature"); !hmac.Equal([]byte(got), []byte(want)) {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+}
+
+func TestPostWebhookSignature(t *testing.T) {
+	allowLoopback(t)
+	payload := []byte(`{"id":"evt1","event":"lockb0x.anchored","data":{"memo":"a&b"}}`)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != string(payload) {
+			t.Errorf("body = %s, want %s", body, payload)
+		}
+		if got := r.Header.Get("X-Pakana-Event"); got != "lockb0x.anchored" {
+			t.Errorf("X-Pakana-Event = %q", got)
+		}
+		if got := r.Header.Get("X-Pakana-Delivery"); got != "evt1" {
+			t.Errorf("X-Pakana-Delivery = %q", got)
+		}
+		verifySignature(t, r, "s3cret", body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sub := WebhookSubscription{ID: "sub1", URL: srv.URL, Secret: "s3cret", Active: true}
+	if err := postWebhook(sub, "lockb0x.anchored", "evt1", payload); err != nil {
+		t.Fatalf("postWebhook: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("receiver called %d times, want 1", calls.Load())
+	}
+}
+
+func TestAttemptWebhookRetries(t *testing.T) {
+	defer func(attempts int, base time.Duration) {
+		webhookMaxAttempts, webhookBackoffBase = attempts, base
+	}(webhookMaxAttempts, webhookBackoffBase)
+	webhookMaxAttempts = 3
+	webhookBackoffBase = time.Second
+	allowLoopback(t)
+
+	var failures atomic.Int32
+	failures.Store(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifySignature(t, r, "s3cret", body)
+		if failures.Load() > 0 {
+			failures.Add(-1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sub := WebhookSubscription{ID: "sub1", URL: srv.URL, Secret: "s3cret", Active: true}
+	d := pendingDelivery{ID: "evt1.sub1", SubscriptionID: "sub1", Event: "lockb0x.anchored", EventID: "evt1", Payload: []byte(`{}`)}
+
+	// First attempt fails: rescheduled after the base backoff, slot released
+	before := time.Now()
+	if attemptWebhook(sub, &d) {
+		t.Fatal("failed attempt reported the delivery finished")
+	}
+	if d.Attempts != 1 || !strings.Contains(d.LastError, "503") {
+		t.Fatalf("after failure: attempts=%d last_error=%q", d.Attempts, d.LastError)
+	}
+	if wait := d.NextAt.Sub(before); wait < webhookBackoffBase || wait > webhookBackoffBase+time.Second {
+		t.Errorf("next attempt in %v, want about %v", wait, webhookBackoffBase)
+	}
+	if n := len(webhookSlots); n != 0 {
+		t.Errorf("%d delivery slots held between attempts, want 0", n)
+	}
+
+	// Second attempt succeeds
+	if !attemptWebhook(sub, &d) {
+		t.Fatal("successful attempt not reported finished")
+	}
+	if d.Attempts != 2 || d.LastError != "" {
+		t.Fatalf("after success: attempts=%d last_error=%q", d.Attempts, d.LastError)
+	}
+}
+
+func TestAttemptWebhookGivesUp(t *testing.T) {
+	defer func(attempts int) { webhookMaxAttempts = attempts }(webhookMaxAttempts)
+	webhookMaxAttempts = 2
+	allowLoopback(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sub := WebhookSubscription{ID: "sub1", URL: srv.URL, Active: true}
+	d := pendingDelivery{ID: "evt1.sub1", EventID: "evt1", Payload: []byte(`{}`)}
+	if attemptWebhook(sub, &d) {
+		t.Fatal("gave up after the first attempt")
+	}
+	if !attemptWebhook(sub, &d) {
+		t.Fatal("did not give up after webhookMaxAttempts")
+	}
+	if d.LastError == "" {
+		t.Error("exhausted delivery has no last_error for the dead letter")
+	}
+}
+
+func TestPostWebhookRefusesInternalAddress(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+
+	sub := WebhookSubscription{ID: "sub1", URL: srv.URL, Secret: "s3cret", Active: true}
+	err := postWebhook(sub, EventPing, "evt1", []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "non-public") {
+		t.Fatalf("postWebhook to %s: err = %v, want a refusal", srv.URL, err)
+	}
+	if calls.Load() != 0 {
+		t.Error("a loopback receiver was reached without LOCKB0X_VERIFY_ALLOW_NETWORKS")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	defer func(base time.Duration) { webhookBackoffBase = base }(webhookBackoffBase)
+	webhookBackoffBase = 2 * time.Second
+	for attempt, want := range map[int]time.Duration{1: 2 * time.Second, 2: 4 * time.Second, 5: 32 * time.Second} {
+		if got := webhookBackoff(attempt); got != want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
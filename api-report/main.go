@@ -5,7 +5,7 @@ import (
 	"embed"
 	"io"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,6 +15,8 @@ import (
 	"api-report/handlers"
 
 	"github.com/gorilla/mux"
+	"github.com/lockb0x-llc/pakana-node-0/pkg/logging"
+	"github.com/lockb0x-llc/pakana-node-0/pkg/tracing"
 	"lang.yottadb.com/go/yottadb/v2"
 )
 
@@ -22,34 +24,51 @@ import (
 var staticFiles embed.FS
 
 func main() {
-	log.Println("Starting Pakana Reporting API...")
+	logging.Init("api-report")
+	shutdownTracing := tracing.Init("api-report", "")
+	slog.Info("Starting Pakana Reporting API...")
 
 	// Initialize YottaDB (Standard v2 pattern)
-	log.Println("[DEBUG] main: Calling yottadb.MustInit()")
+	slog.Debug("Calling yottadb.MustInit()")
 	dbHandle := yottadb.MustInit()
 	defer yottadb.Shutdown(dbHandle)
-	log.Println("[DEBUG] main: MustInit success, calling NewConn()")
+	slog.Debug("MustInit succeeded, calling NewConn()")
 	conn := yottadb.NewConn()
-	log.Printf("[DEBUG] main: NewConn success: %p", conn)
 	handlers.InitYDB(conn)
-	handlers.InitHorizon()
-
-	// Get API key from environment
+	handlers.BackfillCodexIndex()
+	handlers.InitNetworks()
+	handlers.StartLedgerWatcher()
+	handlers.StartWebhookDispatcher()
+	handlers.InitRateLimits()
+	handlers.InitLockb0xAnchoring()
+	handlers.InitIdempotencyKeys()
+	handlers.InitProbes()
+	handlers.InitContentVerification()
+	handlers.InitSigningKey()
+	handlers.StartBatcher()
+
+	// Bootstrap admin key from environment (additional keys live in ^ApiKey)
 	apiKey := os.Getenv("API_KEY")
 	if apiKey == "" {
-		log.Fatal("API_KEY environment variable is required")
+		logging.Fatal("API_KEY environment variable is required")
 	}
 
 	// Create router
 	r := mux.NewRouter()
+	r.Use(handlers.TracingMiddleware)
+	r.Use(handlers.RequestIDMiddleware)
+	r.Use(handlers.MetricsMiddleware)
 
-	// Health check (no auth required)
+	// Health checks and Prometheus metrics (no auth required)
 	r.HandleFunc("/health", handlers.HealthCheck).Methods("GET")
+	r.HandleFunc("/livez", handlers.Livez).Methods("GET")
+	r.HandleFunc("/readyz", handlers.Readyz).Methods("GET")
+	r.Handle("/metrics", handlers.Metrics).Methods("GET")
 
 	// API Documentation (no auth required for spec and UI)
 	r.HandleFunc("/openapi.yaml", func(w http.ResponseWriter, req *http.Request) {
 		if _, err := os.Stat("openapi.yaml"); os.IsNotExist(err) {
-			log.Printf("Error: openapi.yaml not found in %s", os.Getenv("PWD"))
+			slog.Error("openapi.yaml not found", "dir", os.Getenv("PWD"))
 			http.Error(w, "openapi.yaml not found", http.StatusNotFound)
 			return
 		}
@@ -57,7 +76,7 @@ func main() {
 	}).Methods("GET")
 	r.HandleFunc("/docs", func(w http.ResponseWriter, req *http.Request) {
 		if _, err := os.Stat("swagger-ui.html"); os.IsNotExist(err) {
-			log.Printf("Error: swagger-ui.html not found in %s", os.Getenv("PWD"))
+			slog.Error("swagger-ui.html not found", "dir", os.Getenv("PWD"))
 			http.Error(w, "swagger-ui.html not found", http.StatusNotFound)
 			return
 		}
@@ -66,38 +85,68 @@ func main() {
 
 	// API v1 routes (with auth)
 	api := r.PathPrefix("/api/v1").Subrouter()
-	api.Use(apiKeyMiddleware(apiKey))
-
-	// Configure Horizon Client
-	horizonURL := os.Getenv("HORIZON_URL")
-	if horizonURL == "" {
-		// Use public Testnet as default if not specified
-		horizonURL = "https://horizon-testnet.stellar.org"
-	}
-	handlers.SetHorizonURL(horizonURL)
+	api.Use(handlers.IPRateLimitMiddleware)
+	api.Use(handlers.APIKeyMiddleware(apiKey))
+	api.Use(handlers.KeyRateLimitMiddleware)
+	api.Use(handlers.NetworkMiddleware)
 
 	// Health check
 	r.HandleFunc("/ping", handlers.Ping).Methods("GET")
 
 	// Account endpoints
-	api.HandleFunc("/accounts/{id}", handlers.GetAccount).Methods("GET")
-	api.HandleFunc("/accounts/{id}/balance", handlers.GetAccountBalance).Methods("GET")
-	api.HandleFunc("/accounts/{id}/trustlines", handlers.GetAccountTrustlines).Methods("GET")
+	api.HandleFunc("/accounts/{id}", handlers.RequireScope(handlers.ScopeReadAccounts, handlers.GetAccount)).Methods("GET")
+	api.HandleFunc("/accounts/{id}/balance", handlers.RequireScope(handlers.ScopeReadAccounts, handlers.GetAccountBalance)).Methods("GET")
+	api.HandleFunc("/accounts/{id}/trustlines", handlers.RequireScope(handlers.ScopeReadAccounts, handlers.GetAccountTrustlines)).Methods("GET")
 
 	// Ledger endpoints
-	api.HandleFunc("/ledgers/latest", handlers.GetLatestLedger).Methods("GET")
-	api.HandleFunc("/ledgers/{seq}", handlers.GetLedger).Methods("GET")
+	api.HandleFunc("/ledgers/latest", handlers.RequireScope(handlers.ScopeReadLedgers, handlers.GetLatestLedger)).Methods("GET")
+	api.HandleFunc("/ledgers/{seq}", handlers.RequireScope(handlers.ScopeReadLedgers, handlers.GetLedger)).Methods("GET")
 	
 	// Lockb0x endpoints
-	api.HandleFunc("/lockb0x", handlers.CreateLockb0xDraft).Methods("POST")
+	api.HandleFunc("/lockb0x", handlers.RequireScope(handlers.ScopeWriteLockb0x, handlers.CreateLockb0xDraft)).Methods("POST")
+	api.HandleFunc("/lockb0x", handlers.RequireScope(handlers.ScopeReadLockb0x, handlers.ListLockb0x)).Methods("GET")
+	api.HandleFunc("/lockb0x/{hash}", handlers.RequireScope(handlers.ScopeReadLockb0x, handlers.GetLockb0x)).Methods("GET")
+	api.HandleFunc("/lockb0x/{hash}/transaction", handlers.RequireScope(handlers.ScopeWriteLockb0x, handlers.BuildLockb0xTransaction)).Methods("POST")
+	api.HandleFunc("/lockb0x/{hash}/submit", handlers.RequireScope(handlers.ScopeWriteLockb0x, handlers.SubmitLockb0xTransaction)).Methods("POST")
+	api.HandleFunc("/lockb0x/{hash}/verify", handlers.RequireScope(handlers.ScopeReadLockb0x, handlers.VerifyLockb0x)).Methods("GET")
+	api.HandleFunc("/lockb0x/{hash}/export", handlers.RequireScope(handlers.ScopeReadLockb0x, handlers.ExportLockb0x)).Methods("GET")
+	api.HandleFunc("/lockb0x/{hash}", handlers.RequireScope(handlers.ScopeWriteLockb0x, handlers.UpdateLockb0x)).Methods("PATCH")
+	api.HandleFunc("/lockb0x/{hash}/revoke", handlers.RequireScope(handlers.ScopeWriteLockb0x, handlers.RevokeLockb0x)).Methods("POST")
+	api.HandleFunc("/lockb0x/{hash}/supersede", handlers.RequireScope(handlers.ScopeWriteLockb0x, handlers.SupersedeLockb0x)).Methods("POST")
+	api.HandleFunc("/lockb0x/{hash}/events", handlers.RequireScope(handlers.ScopeReadLockb0x, handlers.ListLockb0xEvents)).Methods("GET")
+	api.HandleFunc("/lockb0x/{hash}/attestations", handlers.RequireScope(handlers.ScopeReadLockb0x, handlers.ListLockb0xAttestations)).Methods("GET")
+	api.HandleFunc("/lockb0x/{hash}/attestations", handlers.RequireScope(handlers.ScopeWriteLockb0x, handlers.SubmitLockb0xAttestation)).Methods("POST")
+	api.HandleFunc("/lockb0x/{hash}/attestations/requests", handlers.RequireScope(handlers.ScopeWriteLockb0x, handlers.RequestLockb0xAttestations)).Methods("POST")
+	api.HandleFunc("/lockb0x/batches/{id}", handlers.RequireScope(handlers.ScopeReadLockb0x, handlers.GetLockb0xBatch)).Methods("GET")
+	api.HandleFunc("/node/status", handlers.RequireScope(handlers.ScopeReadLedgers, handlers.GetNodeStatus)).Methods("GET")
+	api.HandleFunc("/node/signing-key", handlers.RequireScope(handlers.ScopeReadLockb0x, handlers.GetSigningKey)).Methods("GET")
 
 	// Transaction endpoints
-	api.HandleFunc("/transactions/{hash}", handlers.GetTransaction).Methods("GET")
+	api.HandleFunc("/transactions/{hash}", handlers.RequireScope(handlers.ScopeReadTransactions, handlers.GetTransaction)).Methods("GET")
+
+	// Stream endpoints (Server-Sent Events)
+	api.HandleFunc("/stream/ledgers", handlers.RequireScope(handlers.ScopeReadLedgers, handlers.StreamLedgers)).Methods("GET")
+	api.HandleFunc("/stream/accounts/{id}", handlers.RequireScope(handlers.ScopeReadAccounts, handlers.StreamAccount)).Methods("GET")
+
+	// Webhook endpoints
+	api.HandleFunc("/webhooks", handlers.RequireScope(handlers.ScopeWriteWebhooks, handlers.ListWebhooks)).Methods("GET")
+	api.HandleFunc("/webhooks", handlers.RequireScope(handlers.ScopeWriteWebhooks, handlers.CreateWebhook)).Methods("POST")
+	api.HandleFunc("/webhooks/dead-letters", handlers.RequireScope(handlers.ScopeWriteWebhooks, handlers.ListDeadLetters)).Methods("GET")
+	api.HandleFunc("/webhooks/{id}", handlers.RequireScope(handlers.ScopeWriteWebhooks, handlers.GetWebhook)).Methods("GET")
+	api.HandleFunc("/webhooks/{id}", handlers.RequireScope(handlers.ScopeWriteWebhooks, handlers.UpdateWebhook)).Methods("PUT")
+	api.HandleFunc("/webhooks/{id}", handlers.RequireScope(handlers.ScopeWriteWebhooks, handlers.DeleteWebhook)).Methods("DELETE")
+	api.HandleFunc("/webhooks/{id}/test", handlers.RequireScope(handlers.ScopeWriteWebhooks, handlers.TestWebhook)).Methods("POST")
+
+	// Admin endpoints (API key management)
+	api.HandleFunc("/admin/keys", handlers.RequireScope(handlers.ScopeAdmin, handlers.ListAPIKeys)).Methods("GET")
+	api.HandleFunc("/admin/keys", handlers.RequireScope(handlers.ScopeAdmin, handlers.CreateAPIKey)).Methods("POST")
+	api.HandleFunc("/admin/keys/{id}/rotate", handlers.RequireScope(handlers.ScopeAdmin, handlers.RotateAPIKey)).Methods("POST")
+	api.HandleFunc("/admin/keys/{id}", handlers.RequireScope(handlers.ScopeAdmin, handlers.RevokeAPIKey)).Methods("DELETE")
 
 	// SPA Handler: Serve static files or fallback to index.html
 	distFS, err := fs.Sub(staticFiles, "dashboard/dist")
 	if err != nil {
-		log.Fatalf("Failed to create sub FS: %v", err)
+		logging.Fatal("Failed to create sub FS", "error", err)
 	}
 
 	r.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -159,9 +208,9 @@ func main() {
 
 	// Start server in goroutine
 	go func() {
-		log.Printf("Reporting API listening on port %s", port)
+		slog.Info("Reporting API listening", "port", port)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
+			logging.Fatal("Server error", "error", err)
 		}
 	}()
 
@@ -170,31 +219,16 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server...")
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		logging.Fatal("Server forced to shutdown", "error", err)
 	}
-
-	log.Println("Server exited")
-}
-
-// apiKeyMiddleware validates the X-API-Key header
-func apiKeyMiddleware(validKey string) mux.MiddlewareFunc {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			key := r.Header.Get("X-API-Key")
-			if key == "" {
-				http.Error(w, `{"error": "Missing X-API-Key header"}`, http.StatusUnauthorized)
-				return
-			}
-			if key != validKey {
-				http.Error(w, `{"error": "Invalid API key"}`, http.StatusForbidden)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
 	}
+
+	slog.Info("Server exited")
 }
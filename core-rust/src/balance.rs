@@ -8,6 +8,7 @@ use stellar_xdr::curr::{
 };
 use yottadb::{Context, KeyContext};
 use log::info;
+use crate::network;
 
 /// Represents a balance change for an account
 #[derive(Debug, Clone)]
@@ -346,7 +347,7 @@ pub fn apply_balance_updates(
                 }
 
                 if delta.reason == "remove_trustline" {
-                    let mut trustline_key = KeyContext::variable(ctx, "^Account");
+                    let mut trustline_key = KeyContext::variable(ctx, network::current().account.as_str());
                     trustline_key.push(delta.account_id.as_bytes().to_vec());
                     trustline_key.push(b"trustlines".to_vec());
                     trustline_key.push(code.as_bytes().to_vec());
@@ -355,7 +356,7 @@ pub fn apply_balance_updates(
                     }
                     let _ = trustline_key.delete(yottadb::DeleteType::DelTree);
                 } else {
-                    let mut trustline_key = KeyContext::variable(ctx, "^Account");
+                    let mut trustline_key = KeyContext::variable(ctx, network::current().account.as_str());
                     trustline_key.push(delta.account_id.as_bytes().to_vec());
                     trustline_key.push(b"trustlines".to_vec());
                     trustline_key.push(code.as_bytes().to_vec());
@@ -385,7 +386,7 @@ pub fn apply_balance_updates(
             }
             
             if delta.asset == "native" {
-                let mut balance_key = KeyContext::variable(ctx, "^Account");
+                let mut balance_key = KeyContext::variable(ctx, network::current().account.as_str());
                 balance_key.push(delta.account_id.as_bytes().to_vec());
                 balance_key.push(b"balance".to_vec());
                 
@@ -400,14 +401,14 @@ pub fn apply_balance_updates(
                 let new_balance = current_balance + delta.delta;
                 balance_key.set(new_balance.to_string().as_bytes())?;
                 
-                let mut modified_key = KeyContext::variable(ctx, "^Account");
+                let mut modified_key = KeyContext::variable(ctx, network::current().account.as_str());
                 modified_key.push(delta.account_id.as_bytes().to_vec());
                 modified_key.push(b"last_modified".to_vec());
                 modified_key.set(ledger_seq.to_string().as_bytes())?;
                 
                 updates += 1;
             } else {
-                let mut trustline_balance = KeyContext::variable(ctx, "^Account");
+                let mut trustline_balance = KeyContext::variable(ctx, network::current().account.as_str());
                 trustline_balance.push(delta.account_id.as_bytes().to_vec());
                 trustline_balance.push(b"trustlines".to_vec());
                 
@@ -436,7 +437,7 @@ pub fn apply_balance_updates(
                 let new_balance = current + delta.delta;
                 trustline_balance.set(new_balance.to_string().as_bytes())?;
                 
-                let mut modified_key = KeyContext::variable(ctx, "^Account");
+                let mut modified_key = KeyContext::variable(ctx, network::current().account.as_str());
                 modified_key.push(delta.account_id.as_bytes().to_vec());
                 modified_key.push(b"last_modified".to_vec());
                 modified_key.set(ledger_seq.to_string().as_bytes())?;
@@ -1,19 +1,56 @@
 use log::{info, warn};
 use std::env;
+use std::io::Write;
 use std::thread;
 use std::time::Duration;
 use yottadb::{Context, KeyContext};
 mod validator;
 mod balance;
+mod network;
+
+/// Logs as JSON lines like the Go services. RUST_LOG takes precedence over the shared
+/// LOG_LEVEL; LOG_FORMAT=text keeps env_logger's default format.
+fn init_logging() {
+    let level = env::var("LOG_LEVEL").unwrap_or_else(|_| "info".to_string());
+    let mut builder = env_logger::Builder::from_env(env_logger::Env::default().default_filter_or(level));
+    let text = env::var("LOG_FORMAT").map(|f| f.eq_ignore_ascii_case("text")).unwrap_or(false);
+    if !text {
+        builder.format(|buf, record| {
+            writeln!(
+                buf,
+                "{{\"time\":\"{}\",\"level\":\"{}\",\"msg\":\"{}\",\"service\":\"core-rust\",\"target\":\"{}\"}}",
+                chrono::Utc::now().to_rfc3339(),
+                record.level(),
+                json_escape(&record.args().to_string()),
+                json_escape(record.target())
+            )
+        });
+    }
+    builder.init();
+}
+
+fn json_escape(s: &str) -> String {
+    let mut out = String::with_capacity(s.len());
+    for c in s.chars() {
+        match c {
+            '"' => out.push_str("\\\""),
+            '\\' => out.push_str("\\\\"),
+            '\n' => out.push_str("\\n"),
+            '\r' => out.push_str("\\r"),
+            '\t' => out.push_str("\\t"),
+            c if (c as u32) < 0x20 => out.push_str(&format!("\\u{:04x}", c as u32)),
+            c => out.push(c),
+        }
+    }
+    out
+}
 
 /// Pakana Core: Monitors Stellar activity in YottaDB and processes transitions
 fn main() {
-    println!("[DEBUG] Pakana Core-Rust starting...");
-    
-    env_logger::init();
-    
-    println!("[DEBUG] env_logger initialized");
+    init_logging();
     info!("Pakana Core-Rust Service Starting...");
+    let net = network::current();
+    info!("Processing network {} ({}, Lockb0x anchors: {})", net.name, net.stellar, net.anchors);
 
     // Set YottaDB environment variables if not already set (fallback)
     if env::var("ydb_gbldir").is_err() {
@@ -29,7 +66,7 @@ fn main() {
         info!("Running diagnostic write tests...");
         
         // Test 1: Simple short key
-        let mut account_key = KeyContext::variable(&ctx, "^Account");
+        let mut account_key = KeyContext::variable(&ctx, network::current().account.as_str());
         account_key.push(b"test_account".to_vec());
         account_key.push(b"balance".to_vec());
         match account_key.set(b"100") {
@@ -39,7 +76,7 @@ fn main() {
 
         // Test 2: Standard 64-char hex key (Simulating Stellar Account ID)
         let huge_id = "688ffbe725c48731383827d04222045508827725049363063517616670860888";
-        let mut huge_key = KeyContext::variable(&ctx, "^Account");
+        let mut huge_key = KeyContext::variable(&ctx, network::current().account.as_str());
         huge_key.push(huge_id.as_bytes().to_vec());
         huge_key.push(b"seq_num".to_vec());
         match huge_key.set(b"123") {
@@ -48,48 +85,40 @@ fn main() {
         }
     }
 
-    let mut last_processed_ledger: i64 = 0;
+    // Resume after the last ledger processed before a restart. Balance deltas aren't
+    // idempotent, so nothing at or below it is processed again. On a fresh database,
+    // processing starts at the first ledger seen.
+    let mut last_processed_ledger: Option<i64> = read_sequence(&ctx, b"processed");
+    if let Some(processed) = last_processed_ledger {
+        info!("Resuming after processed ledger {}", processed);
+    }
 
     info!("Starting Stellar Ledger Monitor Loop...");
+    let mut waiting_on: Option<i64> = None;
 
     loop {
-        // Monitor ^Stellar("latest")
-        let mut latest_key = KeyContext::variable(&ctx, "^Stellar");
-        latest_key.push(b"latest".to_vec());
-        
-        match latest_key.get() {
-            Ok(value_bytes) => {
-                let sequence_str = String::from_utf8_lossy(&value_bytes).to_string();
-                if let Ok(sequence) = sequence_str.parse::<i64>() {
-                    if sequence > last_processed_ledger {
-                        info!("✓ Detected new Stellar Ledger: {}", sequence);
-                        
-                        // Fetch ledger details: ^Stellar("ledger", sequence, "closed_at")
-                        let mut ledger_key = KeyContext::variable(&ctx, "^Stellar");
-                        ledger_key.push(b"ledger".to_vec());
-                        ledger_key.push(sequence_str.as_bytes().to_vec());
-                        
-                        let mut closed_at_key = ledger_key.clone();
-                        closed_at_key.push(b"closed_at".to_vec());
-
-                        if let Ok(closed_at_bytes) = closed_at_key.get() {
-                            let closed_at = String::from_utf8_lossy(&closed_at_bytes);
-                            info!("  Closed at: {}", closed_at);
-                        }
-
-                        // Phase 3: Process all transactions in this ledger
-                        process_ledger_transactions(&ctx, &sequence_str);
-
-                        last_processed_ledger = sequence;
-                    }
-                }
+        // Process every ledger up to ^Stellar("ingested"), the ingestor's commit pointer, in
+        // order, so ledgers committed between polls are not skipped. ^Stellar("latest") is
+        // only a fallback for an ingestor that predates "ingested": api-report hydration
+        // moves it ahead of ledgers the ingestor has yet to write.
+        let limit = read_sequence(&ctx, b"ingested").or_else(|| read_sequence(&ctx, b"latest"));
+        if let Some(limit) = limit {
+            let from = last_processed_ledger.map_or(limit, |processed| processed + 1);
+            if limit > from {
+                info!("Catching up on ledgers {} to {}", from, limit);
             }
-            Err(e) => {
-                // Ignore "Node not found" errors as they are expected before first ingestion
-                let err_str = format!("{:?}", e);
-                if !err_str.contains("GVUNDEF") && !err_str.contains("LVUNDEF") {
-                    warn!("Error reading ^Stellar(\"latest\"): {:?}", e);
+            for sequence in from..=limit {
+                // A ledger the ingestor never wrote has no transactions to apply; stop at it
+                // rather than mark it processed
+                if !stream_ingested(&ctx, sequence) {
+                    if waiting_on != Some(sequence) {
+                        warn!("Waiting for the ingestor to write ledger {}", sequence);
+                        waiting_on = Some(sequence);
+                    }
+                    break;
                 }
+                process_ledger(&ctx, sequence);
+                last_processed_ledger = Some(sequence);
             }
         }
 
@@ -97,6 +126,82 @@ fn main() {
     }
 }
 
+/// Whether the ingestor's ledger transaction wrote ^Stellar("ledger", sequence). Only it
+/// stores filtered_tx_count; hydration writes a header (closed_at, total_tx_count, hash)
+/// and backfill or hydration write transactions, but neither is the whole ledger.
+fn stream_ingested(ctx: &Context, sequence: i64) -> bool {
+    let mut marker_key = KeyContext::variable(ctx, network::current().stellar.as_str());
+    marker_key.push(b"ledger".to_vec());
+    marker_key.push(sequence.to_string().into_bytes());
+    marker_key.push(b"filtered_tx_count".to_vec());
+    marker_key.get().is_ok()
+}
+
+/// Reads a sequence number stored at ^Stellar(name)
+fn read_sequence(ctx: &Context, name: &[u8]) -> Option<i64> {
+    let mut key = KeyContext::variable(ctx, network::current().stellar.as_str());
+    key.push(name.to_vec());
+    key.get().ok().and_then(|value| String::from_utf8_lossy(&value).parse().ok())
+}
+
+/// Processes one ledger the ingestor wrote and advances ^Stellar("processed") to it
+fn process_ledger(ctx: &Context, sequence: i64) {
+    let sequence_str = sequence.to_string();
+    info!("✓ Detected new Stellar Ledger: {}", sequence);
+
+    // Fetch ledger details: ^Stellar("ledger", sequence, "closed_at")
+    let mut ledger_key = KeyContext::variable(ctx, network::current().stellar.as_str());
+    ledger_key.push(b"ledger".to_vec());
+    ledger_key.push(sequence_str.as_bytes().to_vec());
+
+    let mut closed_at_key = ledger_key.clone();
+    closed_at_key.push(b"closed_at".to_vec());
+
+    if let Ok(closed_at_bytes) = closed_at_key.get() {
+        let closed_at = String::from_utf8_lossy(&closed_at_bytes);
+        info!("  Closed at: {}", closed_at);
+    }
+
+    // Phase 3: Process all transactions in this ledger
+    process_ledger_transactions(ctx, &sequence_str);
+
+    // Processing pointer: lets api-report's /readyz see core-rust keeping up. Ledgers are
+    // processed in order, so everything at or below it has been processed.
+    let mut processed_key = KeyContext::variable(ctx, network::current().stellar.as_str());
+    processed_key.push(b"processed".to_vec());
+    if let Err(e) = processed_key.set(sequence_str.as_bytes()) {
+        warn!("Error writing ^Stellar(\"processed\"): {:?}", e);
+    }
+
+    advance_processed_through(ctx, sequence);
+}
+
+/// Advances ^Stellar("processed_through"), the contiguous low-water mark api-go's
+/// retention policy prunes below: no ledger at or below it will be read again. It only
+/// moves one ledger at a time and only onto a ledger the ingestor wrote, so unlike
+/// "processed" (which earlier versions advanced over ledgers with no data) it never covers
+/// a gap. It starts at the first ledger processed after an upgrade or on a fresh database.
+fn advance_processed_through(ctx: &Context, sequence: i64) {
+    if !stream_ingested(ctx, sequence) {
+        warn!("Not advancing ^Stellar(\"processed_through\") to {}: the ingestor did not write it", sequence);
+        return;
+    }
+    if let Some(through) = read_sequence(ctx, b"processed_through") {
+        if sequence != through + 1 {
+            warn!(
+                "Not advancing ^Stellar(\"processed_through\") from {} to {}: not contiguous",
+                through, sequence
+            );
+            return;
+        }
+    }
+    let mut through_key = KeyContext::variable(ctx, network::current().stellar.as_str());
+    through_key.push(b"processed_through".to_vec());
+    if let Err(e) = through_key.set(sequence.to_string().as_bytes()) {
+        warn!("Error writing ^Stellar(\"processed_through\"): {:?}", e);
+    }
+}
+
 /// Process all transactions in a given ledger by iterating ^Stellar("ledger", seq, "tx", *)
 fn process_ledger_transactions(ctx: &Context, sequence_str: &str) {
     let mut tx_count = 0;
@@ -108,7 +213,7 @@ fn process_ledger_transactions(ctx: &Context, sequence_str: &str) {
         let idx_str = format!("{}", tx_idx);
         
         // Try to read ^Stellar("ledger", seq, "tx", idx, "xdr")
-        let mut xdr_key = KeyContext::variable(ctx, "^Stellar");
+        let mut xdr_key = KeyContext::variable(ctx, network::current().stellar.as_str());
         xdr_key.push(b"ledger".to_vec());
         xdr_key.push(sequence_str.as_bytes().to_vec());
         xdr_key.push(b"tx".to_vec());
@@ -143,7 +248,7 @@ fn process_ledger_transactions(ctx: &Context, sequence_str: &str) {
                                 let mut interest = false;
                                 for delta in &deltas {
                                     // Check ^Tracked(account_id)
-                                    let mut tracked_key = KeyContext::variable(ctx, "^Tracked");
+                                    let mut tracked_key = KeyContext::variable(ctx, network::current().tracked.as_str());
                                     tracked_key.push(delta.account_id.as_bytes().to_vec());
                                     // If we can get the value, it's tracked.
                                     if tracked_key.get().is_ok() {
@@ -166,20 +271,55 @@ fn process_ledger_transactions(ctx: &Context, sequence_str: &str) {
                                     }
                                 }
 
-                                // Lockb0x Logic: Check for Anchor Confirmation
-                                if let Some(memo_hash) = validator::extract_memo_hash(&envelope) {
+                                // Lockb0x Logic: Check for Anchor Confirmation (MEMO_HASH or "lockb0x" manageData)
+                                let anchors = validator::extract_memo_hash(&envelope)
+                                    .into_iter()
+                                    .chain(validator::extract_anchor_data(&envelope))
+                                    .filter(|_| network::current().anchors); // ^Codex belongs to LOCKB0X_NETWORK
+                                for anchor_hash in anchors {
                                     let mut draft_key = KeyContext::variable(ctx, "^Codex");
                                     draft_key.push(b"draft".to_vec());
-                                    draft_key.push(memo_hash.as_bytes().to_vec());
+                                    draft_key.push(anchor_hash.as_bytes().to_vec());
 
                                     // Check if draft exists by checking for "url" child
                                     let mut url_check = draft_key.clone();
                                     url_check.push(b"url".to_vec());
                                     
-                                    if url_check.get().is_ok() { 
-                                        info!("  🔒 Lockb0x Anchor Detected! Promoting hash: {}", memo_hash);
-                                        if let Err(e) = promote_anchor(ctx, &memo_hash) {
-                                             warn!("Failed to promote anchor: {:?}", e);
+                                    // Revoked drafts are never promoted, even if their hash is committed later
+                                    let mut status_check = draft_key.clone();
+                                    status_check.push(b"status".to_vec());
+                                    let revoked = status_check.get().map(|v| v == b"revoked").unwrap_or(false);
+
+                                    // Only the transaction api-report validated and submitted for the draft
+                                    // counts; anyone can commit a known pointer hash from their own account
+                                    let mut expected_key = draft_key.clone();
+                                    expected_key.push(b"tx_hash".to_vec());
+
+                                    if url_check.get().is_ok() && !revoked {
+                                        match ingested_tx_hash(ctx, sequence_str, &idx_str).filter(|h| expected_key.get().ok().as_ref() == Some(h)) {
+                                            Some(anchor_tx_hash) => {
+                                                info!("  🔒 Lockb0x Anchor Detected! Promoting hash: {}", anchor_hash);
+                                                if let Err(e) = promote_anchor(ctx, &anchor_hash, ledger_seq, &anchor_tx_hash) {
+                                                     warn!("Failed to promote anchor: {:?}", e);
+                                                }
+                                            }
+                                            None => warn!("  Ignoring commitment to Lockb0x draft {}: not its submitted transaction", anchor_hash),
+                                        }
+                                    }
+                                }
+
+                                // Lockb0x revocations: only the transaction api-report submitted for the record counts
+                                if let Some(revoked_hash) = validator::extract_revocation_data(&envelope).filter(|_| network::current().anchors) {
+                                    let revocation_tx_hash = ingested_tx_hash(ctx, sequence_str, &idx_str);
+                                    let mut expected_key = KeyContext::variable(ctx, "^Codex");
+                                    expected_key.push(revoked_hash.as_bytes().to_vec());
+                                    expected_key.push(b"revocation".to_vec());
+                                    expected_key.push(b"tx_hash".to_vec());
+
+                                    if revocation_tx_hash.is_some() && expected_key.get().ok() == revocation_tx_hash {
+                                        info!("  🔓 Lockb0x Revocation Detected! Revoking hash: {}", revoked_hash);
+                                        if let Err(e) = confirm_revocation(ctx, &revoked_hash, ledger_seq) {
+                                            warn!("Failed to confirm revocation: {:?}", e);
                                         }
                                     }
                                 }
@@ -204,7 +344,7 @@ fn process_ledger_transactions(ctx: &Context, sequence_str: &str) {
         info!("  Processed {} transactions for ledger {} (Interesting: {})", tx_count, sequence_str, filtered_tx_count);
         
         // Update ^Stellar("ledger", seq, "filtered_tx_count") = filtered_tx_count
-        let mut filtered_count_key = KeyContext::variable(ctx, "^Stellar");
+        let mut filtered_count_key = KeyContext::variable(ctx, network::current().stellar.as_str());
         filtered_count_key.push(b"ledger".to_vec());
         filtered_count_key.push(sequence_str.as_bytes().to_vec());
         filtered_count_key.push(b"filtered_tx_count".to_vec());
@@ -218,7 +358,7 @@ fn process_ledger_transactions(ctx: &Context, sequence_str: &str) {
 /// Update account state in YottaDB using a transaction (TP): ^Account(account_id, "seq_num") = seq_num
 fn update_account_state(ctx: &Context, account_id: &str, seq_num: i64) -> Result<(), Box<dyn std::error::Error + Send + Sync>> {
     ctx.tp(|_t_ctx| {
-        let mut account_key = KeyContext::variable(ctx, "^Account");
+        let mut account_key = KeyContext::variable(ctx, network::current().account.as_str());
         account_key.push(account_id.as_bytes().to_vec());
         account_key.push(b"seq_num".to_vec());
         
@@ -231,8 +371,8 @@ fn update_account_state(ctx: &Context, account_id: &str, seq_num: i64) -> Result
     Ok(())
 }
 
-/// Promote a Lockb0x draft to an Active Anchor in YottaDB
-fn promote_anchor(ctx: &Context, hash: &str) -> Result<(), Box<dyn std::error::Error + Send + Sync>> {
+/// Promote a Lockb0x draft to an anchored record in YottaDB: ^Codex(hash)
+fn promote_anchor(ctx: &Context, hash: &str, ledger_seq: i64, tx_hash: &[u8]) -> Result<(), Box<dyn std::error::Error + Send + Sync>> {
     ctx.tp(|_t_ctx| {
         let mut draft_key = KeyContext::variable(ctx, "^Codex");
         draft_key.push(b"draft".to_vec());
@@ -248,6 +388,21 @@ fn promote_anchor(ctx: &Context, hash: &str) -> Result<(), Box<dyn std::error::E
         let mut prov_key = draft_key.clone(); prov_key.push(b"provider".to_vec());
         let prov = prov_key.get().unwrap_or(b"".to_vec());
 
+        let mut ts_key = draft_key.clone(); ts_key.push(b"timestamp".to_vec());
+        let ts = ts_key.get().unwrap_or(b"0".to_vec());
+
+        let mut verified_key = draft_key.clone(); verified_key.push(b"content_verified".to_vec());
+        let content_verified = verified_key.get().ok();
+
+        // Lifecycle links and correction count carry over unchanged
+        let mut carried = Vec::new();
+        for field in [&b"version"[..], &b"supersedes"[..], &b"superseded_by"[..]] {
+            let mut field_key = draft_key.clone(); field_key.push(field.to_vec());
+            if let Ok(value) = field_key.get() {
+                carried.push((field.to_vec(), value));
+            }
+        }
+
         // Write Active Record: ^Codex(hash)
         let mut active_key = KeyContext::variable(ctx, "^Codex");
         active_key.push(hash.as_bytes().to_vec());
@@ -255,12 +410,77 @@ fn promote_anchor(ctx: &Context, hash: &str) -> Result<(), Box<dyn std::error::E
         active_key.clone().child(b"url".to_vec()).set(&url)?;
         active_key.clone().child(b"description".to_vec()).set(&desc)?;
         active_key.clone().child(b"provider".to_vec()).set(&prov)?;
-        active_key.clone().child(b"status".to_vec()).set(b"active")?;
+        active_key.clone().child(b"status".to_vec()).set(b"anchored")?;
+        active_key.clone().child(b"timestamp".to_vec()).set(&ts)?;
+        active_key.clone().child(b"ledger".to_vec()).set(ledger_seq.to_string().as_bytes())?;
+        active_key.clone().child(b"tx_hash".to_vec()).set(tx_hash)?;
+        if let Some(verified) = &content_verified {
+            active_key.clone().child(b"content_verified".to_vec()).set(verified)?;
+        }
+        for (field, value) in &carried {
+            active_key.clone().child(field.clone()).set(value)?;
+        }
         
         // Remove Draft
         draft_key.kill()?;
 
+        append_codex_event(ctx, hash, "anchored", &format!(r#"{{"ledger":{},"tx_hash":"{}"}}"#, ledger_seq, String::from_utf8_lossy(tx_hash)))?;
+
         Ok(yottadb::TransactionStatus::Ok)
     }, "PROMOTE_ANCHOR", &[])?;
     Ok(())
 }
+
+/// Read the ingested hash of a transaction: ^Stellar("ledger", seq, "tx", idx, "hash")
+fn ingested_tx_hash(ctx: &Context, sequence_str: &str, idx_str: &str) -> Option<Vec<u8>> {
+    let mut hash_key = KeyContext::variable(ctx, network::current().stellar.as_str());
+    hash_key.push(b"ledger".to_vec());
+    hash_key.push(sequence_str.as_bytes().to_vec());
+    hash_key.push(b"tx".to_vec());
+    hash_key.push(idx_str.as_bytes().to_vec());
+    hash_key.push(b"hash".to_vec());
+    hash_key.get().ok()
+}
+
+/// Mark an anchored Lockb0x record revoked once its revocation transaction lands: ^Codex(hash, "revocation")
+fn confirm_revocation(ctx: &Context, hash: &str, ledger_seq: i64) -> Result<(), Box<dyn std::error::Error + Send + Sync>> {
+    ctx.tp(|_t_ctx| {
+        let mut active_key = KeyContext::variable(ctx, "^Codex");
+        active_key.push(hash.as_bytes().to_vec());
+
+        let mut revocation_key = active_key.clone();
+        revocation_key.push(b"revocation".to_vec());
+        let tx_hash = revocation_key.clone().child(b"tx_hash".to_vec()).get().unwrap_or_default();
+
+        active_key.clone().child(b"status".to_vec()).set(b"revoked")?;
+        revocation_key.clone().child(b"status".to_vec()).set(b"anchored")?;
+        revocation_key.clone().child(b"on_chain".to_vec()).set(b"1")?;
+        revocation_key.clone().child(b"ledger".to_vec()).set(ledger_seq.to_string().as_bytes())?;
+
+        append_codex_event(ctx, hash, "revoked", &format!(r#"{{"ledger":{},"on_chain":true,"tx_hash":"{}"}}"#, ledger_seq, String::from_utf8_lossy(&tx_hash)))?;
+
+        Ok(yottadb::TransactionStatus::Ok)
+    }, "CONFIRM_REVOCATION", &[])?;
+    Ok(())
+}
+
+/// Append to a Lockb0x record's event log, as api-report does: ^Codex("events", hash, n).
+/// Call inside a transaction.
+fn append_codex_event(ctx: &Context, hash: &str, event_type: &str, data_json: &str) -> Result<(), Box<dyn std::error::Error + Send + Sync>> {
+    let mut count_key = KeyContext::variable(ctx, "^Codex");
+    count_key.push(b"events".to_vec());
+    count_key.push(hash.as_bytes().to_vec());
+
+    let count = count_key.get()
+        .ok()
+        .and_then(|v| String::from_utf8_lossy(&v).parse::<i64>().ok())
+        .unwrap_or(0) + 1;
+    count_key.set(count.to_string().as_bytes())?;
+
+    let mut event_key = count_key.clone();
+    event_key.push(count.to_string().as_bytes().to_vec());
+    event_key.clone().child(b"type".to_vec()).set(event_type.as_bytes())?;
+    event_key.clone().child(b"at".to_vec()).set(chrono::Utc::now().timestamp().to_string().as_bytes())?;
+    event_key.clone().child(b"data".to_vec()).set(data_json.as_bytes())?;
+    Ok(())
+}
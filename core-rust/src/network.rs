@@ -0,0 +1,77 @@
+// src/network.rs
+//! Global names for the Stellar network this instance processes.
+//!
+//! Run one core-rust per network, with the same STELLAR_NETWORK as its ingestor.
+//! Testnet (the default) uses the unqualified ^Stellar, ^Account and ^Tracked; any
+//! other network appends its capitalised name, as api-go does (^StellarPubnet, ...).
+//! ^Codex is shared, so only the instance on LOCKB0X_NETWORK promotes Lockb0x anchors
+//! and revocations. Unset, it defaults as in api-report: the first of STELLAR_NETWORKS,
+//! then STELLAR_NETWORK, then testnet. Give every core-rust the STELLAR_NETWORKS (or
+//! LOCKB0X_NETWORK) api-report has, or each would take its own network as the default.
+
+use std::env;
+use std::sync::OnceLock;
+
+pub struct Network {
+    pub name: String,
+    pub stellar: String,
+    pub account: String,
+    pub tracked: String,
+    /// Whether Lockb0x records are anchored on this network
+    pub anchors: bool,
+}
+
+static NETWORK: OnceLock<Network> = OnceLock::new();
+
+/// The configured network, read from the environment on first use
+pub fn current() -> &'static Network {
+    NETWORK.get_or_init(|| {
+        let name = env_name("STELLAR_NETWORK").unwrap_or_else(|| "testnet".to_string());
+        let anchors = lockb0x_network(&name) == name;
+        Network {
+            stellar: qualified("^Stellar", &name),
+            account: qualified("^Account", &name),
+            tracked: qualified("^Tracked", &name),
+            anchors,
+            name,
+        }
+    })
+}
+
+/// The network Lockb0x records are anchored on; own is this instance's STELLAR_NETWORK
+fn lockb0x_network(own: &str) -> String {
+    env_name("LOCKB0X_NETWORK")
+        .or_else(|| {
+            env_name("STELLAR_NETWORKS")
+                .and_then(|list| list.split(',').map(str::trim).find(|n| !n.is_empty()).map(str::to_string))
+        })
+        .unwrap_or_else(|| own.to_string())
+}
+
+fn env_name(var: &str) -> Option<String> {
+    env::var(var).ok().map(|v| v.trim().to_lowercase()).filter(|v| !v.is_empty())
+}
+
+/// The global base for network name; testnet keeps the legacy unqualified name
+fn qualified(base: &str, name: &str) -> String {
+    if name == "testnet" {
+        return base.to_string();
+    }
+    let mut chars = name.chars();
+    match chars.next() {
+        Some(first) => format!("{}{}{}", base, first.to_ascii_uppercase(), chars.as_str()),
+        None => base.to_string(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_qualified() {
+        assert_eq!(qualified("^Stellar", "testnet"), "^Stellar");
+        assert_eq!(qualified("^Stellar", "pubnet"), "^StellarPubnet");
+        assert_eq!(qualified("^Tracked", "futurenet"), "^TrackedFuturenet");
+    }
+}
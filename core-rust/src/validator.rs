@@ -185,6 +185,43 @@ pub fn extract_memo_hash(envelope: &TransactionEnvelope) -> Option<String> {
     }
 }
 
+/// Name of the manageData entry Lockb0x anchors use instead of a MEMO_HASH.
+pub const ANCHOR_DATA_NAME: &str = "lockb0x";
+
+/// Name of the manageData entry revoking a previously anchored Lockb0x pointer hash.
+pub const REVOCATION_DATA_NAME: &str = "lockb0x_revoke";
+
+/// Extract a Lockb0x pointer hash committed as a `lockb0x` manageData entry, if present.
+pub fn extract_anchor_data(envelope: &TransactionEnvelope) -> Option<String> {
+    extract_data_hash(envelope, ANCHOR_DATA_NAME)
+}
+
+/// Extract a Lockb0x pointer hash revoked by a `lockb0x_revoke` manageData entry, if present.
+pub fn extract_revocation_data(envelope: &TransactionEnvelope) -> Option<String> {
+    extract_data_hash(envelope, REVOCATION_DATA_NAME)
+}
+
+/// Hex-encode the 32-byte value of the first manageData entry named `name`.
+fn extract_data_hash(envelope: &TransactionEnvelope, name: &str) -> Option<String> {
+    let operations = match envelope {
+        TransactionEnvelope::Tx(env) => &env.tx.operations,
+        TransactionEnvelope::TxV0(env) => &env.tx.operations,
+        TransactionEnvelope::TxFeeBump(env) => {
+            match &env.tx.inner_tx {
+                stellar_xdr::curr::FeeBumpTransactionInnerTx::Tx(inner) => &inner.tx.operations,
+            }
+        }
+    };
+
+    operations.iter().find_map(|op| match &op.body {
+        OperationBody::ManageData(data) if data.data_name.as_slice() == name.as_bytes() => {
+            data.data_value.as_ref()
+                .filter(|value| value.0.len() == 32)
+                .map(|value| hex::encode(value.0.as_slice()))
+        }
+        _ => None,
+    })
+}
 
 #[cfg(test)]
 mod tests {
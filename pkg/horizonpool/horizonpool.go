@@ -0,0 +1,381 @@
+// Package horizonpool spreads a service's Horizon traffic over a list of endpoints.
+// api-go and api-report both send every Horizon request through a Pool.
+//
+// Endpoints are given in order of preference. The pool sends each request to the
+// active endpoint and stays there while it is healthy. It fails over to the next usable
+// endpoint in order when the active one errors, answers 429 or 5xx, or is slower than
+// HORIZON_MAX_LATENCY; the failed endpoint is benched for HORIZON_FAILOVER_COOLDOWN (or
+// its Retry-After). A probe of every endpoint's root each HORIZON_PROBE_INTERVAL also
+// rules out endpoints on another network or more than HORIZON_MAX_LAG ledgers behind
+// the best one. There is no automatic fail-back: a recovered endpoint is used again
+// only once the active one fails.
+//
+// Ledger streams (text/event-stream requests) are never retried. A service that
+// follows one calls StreamFailed when it breaks, and reconnects when Switched fires.
+package horizonpool
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upstream health, as judged by the last probe
+const (
+	upstreamUnknown      = "unknown" // Not probed yet; usable
+	upstreamOK           = "ok"
+	upstreamDown         = "down"
+	upstreamSlow         = "slow"
+	upstreamLagging      = "lagging"
+	upstreamWrongNetwork = "wrong_network"
+)
+
+type upstream struct {
+	url          *url.URL
+	status       string
+	reason       string
+	latest       int32
+	passphrase   string
+	latency      time.Duration
+	benchedUntil time.Time // Skipped after a failed request until then
+}
+
+// Pool is an http.RoundTripper over a list of Horizon endpoints
+type Pool struct {
+	mu        sync.Mutex
+	upstreams []*upstream
+	active    int
+	streaming *upstream     // Upstream serving the current ledger stream
+	switched  chan struct{} // Closed and replaced whenever the active upstream changes
+
+	network    string // Expected network passphrase
+	maxLag     int32
+	maxLatency time.Duration
+	cooldown   time.Duration
+	base       http.RoundTripper
+	probe      *http.Client
+}
+
+// URLs splits a comma-separated list of endpoints, falling back to defaultURL
+func URLs(raw, defaultURL string) []string {
+	var urls []string
+	for _, u := range strings.Split(raw, ",") {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		urls = []string{defaultURL}
+	}
+	return urls
+}
+
+// New builds a pool over urls for the network with the given passphrase, probes them
+// once and starts probing every HORIZON_PROBE_INTERVAL
+func New(urls []string, network string) (*Pool, error) {
+	p := &Pool{
+		switched:   make(chan struct{}),
+		network:    network,
+		maxLag:     10,
+		maxLatency: 2 * time.Second,
+		cooldown:   30 * time.Second,
+		base:       timedTransport{base: http.DefaultTransport},
+		probe:      &http.Client{Timeout: 5 * time.Second},
+	}
+	if v, err := strconv.Atoi(os.Getenv("HORIZON_MAX_LAG")); err == nil && v > 0 {
+		p.maxLag = int32(v)
+	}
+	if v, err := time.ParseDuration(os.Getenv("HORIZON_MAX_LATENCY")); err == nil && v > 0 {
+		p.maxLatency = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("HORIZON_FAILOVER_COOLDOWN")); err == nil && v > 0 {
+		p.cooldown = v
+	}
+	interval := 15 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("HORIZON_PROBE_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid Horizon URL %q", raw)
+		}
+		p.upstreams = append(p.upstreams, &upstream{url: u, status: upstreamUnknown})
+	}
+
+	p.probeAll()
+	go func() {
+		for range time.Tick(interval) {
+			p.probeAll()
+		}
+	}()
+	return p, nil
+}
+
+// Client returns a client whose requests go through the pool
+func (p *Pool) Client(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: p}
+}
+
+// Active is the URL requests currently go to
+func (p *Pool) Active() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.upstreams[p.active].url.String()
+}
+
+// Networks lists the distinct passphrases reported by the last probe, and how many
+// upstreams answered it
+func (p *Pool) Networks() (reported []string, answered int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, u := range p.upstreams {
+		if u.status == upstreamDown || u.status == upstreamUnknown {
+			continue
+		}
+		answered++
+		if !slices.Contains(reported, u.passphrase) {
+			reported = append(reported, u.passphrase)
+		}
+	}
+	return reported, answered
+}
+
+// UpstreamStatus describes one Horizon endpoint
+type UpstreamStatus struct {
+	URL          string `json:"url"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+	LatestLedger int32  `json:"latest_ledger"`
+	LatencyMs    int64  `json:"latency_ms"`
+	Benched      bool   `json:"benched,omitempty"`
+	Active       bool   `json:"active,omitempty"`
+}
+
+// Snapshot reports every endpoint and whether any is usable
+func (p *Pool) Snapshot() ([]UpstreamStatus, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	anyUsable := false
+	statuses := make([]UpstreamStatus, len(p.upstreams))
+	for i, u := range p.upstreams {
+		statuses[i] = UpstreamStatus{
+			URL:          u.url.String(),
+			Status:       u.status,
+			Reason:       u.reason,
+			LatestLedger: u.latest,
+			LatencyMs:    u.latency.Milliseconds(),
+			Benched:      now.Before(u.benchedUntil),
+			Active:       i == p.active,
+		}
+		anyUsable = anyUsable || p.usable(u, now)
+	}
+	return statuses, anyUsable
+}
+
+// Switched returns a channel that is closed when the active upstream next changes
+func (p *Pool) Switched() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.switched
+}
+
+func (p *Pool) usable(u *upstream, now time.Time) bool {
+	return (u.status == upstreamOK || u.status == upstreamUnknown) && !now.Before(u.benchedUntil)
+}
+
+// pick returns the active upstream, failing over first if it is not usable
+func (p *Pool) pick() *upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failover(time.Now())
+	return p.upstreams[p.active]
+}
+
+// failover moves to the most preferred usable upstream when the active one is not
+// usable; with nothing usable it stays put. Callers hold p.mu.
+func (p *Pool) failover(now time.Time) {
+	current := p.upstreams[p.active]
+	if p.usable(current, now) {
+		return
+	}
+	for i, u := range p.upstreams {
+		if i != p.active && p.usable(u, now) {
+			slog.Warn("Failing over to another Horizon", "from", current.url.String(), "to", u.url.String(),
+				"status", current.status, "reason", current.reason)
+			p.active = i
+			close(p.switched)
+			p.switched = make(chan struct{})
+			horizonFailovers.Inc()
+			return
+		}
+	}
+}
+
+// bench takes u out of rotation for the cooldown (or retryAfter, if longer)
+func (p *Pool) bench(u *upstream, reason string, retryAfter time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u.benchedUntil = time.Now().Add(max(p.cooldown, retryAfter))
+	u.reason = reason
+	slog.Warn("Horizon request failed, benching endpoint", "url", u.url.String(), "reason", reason,
+		"until", u.benchedUntil.Format(time.RFC3339))
+	p.failover(time.Now())
+}
+
+// StreamFailed benches the upstream that served a ledger stream which then broke;
+// errors reading the stream body never reach RoundTrip
+func (p *Pool) StreamFailed(err error) {
+	p.mu.Lock()
+	u := p.streaming
+	benched := u != nil && time.Now().Before(u.benchedUntil)
+	p.mu.Unlock()
+	if u != nil && !benched {
+		p.bench(u, err.Error(), 0)
+	}
+}
+
+// RoundTrip sends req to the active upstream. Idempotent requests that fail there are
+// retried once on the upstream the pool fails over to.
+func (p *Pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := p.pick()
+	resp, err := p.send(req, u)
+	if !p.retryable(req, resp, err) {
+		return resp, err
+	}
+	next := p.pick()
+	if next == u {
+		return resp, err
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return p.send(req, next)
+}
+
+func (p *Pool) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Method != http.MethodGet || isStream(req) || req.Context().Err() != nil {
+		return false
+	}
+	return err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+func isStream(req *http.Request) bool {
+	return req.Header.Get("Accept") == "text/event-stream"
+}
+
+// send rewrites req onto u and benches u if the outcome calls for failover
+func (p *Pool) send(req *http.Request, u *upstream) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = u.url.Scheme
+	out.URL.Host = u.url.Host
+	out.URL.Path = u.url.Path + p.relativePath(req.URL.Path)
+	out.URL.RawPath = ""
+	out.Host = ""
+
+	if isStream(req) {
+		p.mu.Lock()
+		p.streaming = u
+		p.mu.Unlock()
+	}
+
+	start := time.Now()
+	resp, err := p.base.RoundTrip(out)
+	elapsed := time.Since(start)
+	switch {
+	case req.Context().Err() != nil:
+		// Cancelled by the caller; says nothing about the upstream
+	case err != nil:
+		p.bench(u, err.Error(), 0)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		p.bench(u, "rate limited (429)", time.Duration(retryAfter)*time.Second)
+	case resp.StatusCode >= 500:
+		p.bench(u, fmt.Sprintf("HTTP %d", resp.StatusCode), 0)
+	case elapsed > p.maxLatency:
+		p.bench(u, fmt.Sprintf("slow response (%s)", elapsed.Round(time.Millisecond)), 0)
+	}
+	return resp, err
+}
+
+// relativePath strips whichever upstream's path prefix the client built req against
+func (p *Pool) relativePath(path string) string {
+	for _, u := range p.upstreams {
+		if prefix := u.url.Path; prefix != "" && strings.HasPrefix(path, prefix+"/") {
+			return strings.TrimPrefix(path, prefix)
+		}
+	}
+	return path
+}
+
+// probeAll fetches every upstream's root and re-rates them against each other
+func (p *Pool) probeAll() {
+	type rootDoc struct {
+		HistoryLatestLedger int32  `json:"history_latest_ledger"`
+		NetworkPassphrase   string `json:"network_passphrase"`
+	}
+	results := make([]rootDoc, len(p.upstreams))
+	errs := make([]error, len(p.upstreams))
+	latencies := make([]time.Duration, len(p.upstreams))
+	for i, u := range p.upstreams {
+		start := time.Now()
+		resp, err := p.probe.Get(u.url.String() + "/")
+		latencies[i] = time.Since(start)
+		if err == nil {
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("HTTP %d", resp.StatusCode)
+			} else {
+				err = json.NewDecoder(resp.Body).Decode(&results[i])
+			}
+			resp.Body.Close()
+		}
+		errs[i] = err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var best int32
+	for i := range p.upstreams {
+		if errs[i] == nil && results[i].NetworkPassphrase == p.network && results[i].HistoryLatestLedger > best {
+			best = results[i].HistoryLatestLedger
+		}
+	}
+
+	for i, u := range p.upstreams {
+		previous := u.status
+		u.latency = latencies[i]
+		u.latest, u.passphrase = results[i].HistoryLatestLedger, results[i].NetworkPassphrase
+		switch {
+		case errs[i] != nil:
+			u.status, u.reason = upstreamDown, errs[i].Error()
+		case u.passphrase != p.network:
+			u.status, u.reason = upstreamWrongNetwork, fmt.Sprintf("network passphrase %q", u.passphrase)
+		case best-u.latest > p.maxLag:
+			u.status, u.reason = upstreamLagging, fmt.Sprintf("%d ledgers behind", best-u.latest)
+		case u.latency > p.maxLatency:
+			u.status, u.reason = upstreamSlow, fmt.Sprintf("root took %s", u.latency.Round(time.Millisecond))
+		default:
+			u.status, u.reason = upstreamOK, ""
+		}
+		if u.status != previous {
+			slog.Info("Horizon endpoint status changed", "url", u.url.String(), "status", u.status,
+				"previous", previous, "reason", u.reason, "latest_ledger", u.latest)
+		}
+		up := 0.0
+		if u.status == upstreamOK {
+			up = 1
+		}
+		horizonUpstreamUp.WithLabelValues(u.url.String()).Set(up)
+	}
+	p.failover(time.Now())
+}
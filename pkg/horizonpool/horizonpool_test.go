@@ -0,0 +1,122 @@
+package horizonpool
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+const testPassphrase = "Test SDF Network ; September 2015"
+
+// fakeHorizon answers its root with latest and every other path with status
+func fakeHorizon(t *testing.T, network string, latest int32, status *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"history_latest_ledger": latest,
+				"network_passphrase":    network,
+			})
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestPool(t *testing.T, urls ...string) *Pool {
+	t.Helper()
+	t.Setenv("HORIZON_PROBE_INTERVAL", "1h")
+	p, err := New(urls, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFailoverRetriesOnNextEndpoint(t *testing.T) {
+	var primary, secondary atomic.Int32
+	primary.Store(http.StatusServiceUnavailable)
+	secondary.Store(http.StatusOK)
+	a := fakeHorizon(t, testPassphrase, 100, &primary)
+	b := fakeHorizon(t, testPassphrase, 100, &secondary)
+
+	p := newTestPool(t, a.URL, b.URL)
+	switched := p.Switched()
+	resp, err := p.Client(0).Get(a.URL + "/ledgers/100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want the retry on the second endpoint to succeed", resp.StatusCode)
+	}
+	if p.Active() != b.URL {
+		t.Errorf("active = %s, want %s", p.Active(), b.URL)
+	}
+	select {
+	case <-switched:
+	default:
+		t.Error("Switched did not fire on failover")
+	}
+
+	// No automatic fail-back once the first endpoint recovers
+	primary.Store(http.StatusOK)
+	p.probeAll()
+	if p.Active() != b.URL {
+		t.Errorf("failed back to %s", p.Active())
+	}
+}
+
+func TestProbeRulesOutWrongNetworkAndLag(t *testing.T) {
+	var ok atomic.Int32
+	ok.Store(http.StatusOK)
+	wrong := fakeHorizon(t, "Public Global Stellar Network ; September 2015", 100, &ok)
+	lagging := fakeHorizon(t, testPassphrase, 50, &ok)
+	good := fakeHorizon(t, testPassphrase, 100, &ok)
+
+	p := newTestPool(t, wrong.URL, lagging.URL, good.URL)
+	if p.Active() != good.URL {
+		t.Errorf("active = %s, want %s", p.Active(), good.URL)
+	}
+	statuses, usable := p.Snapshot()
+	if !usable {
+		t.Error("Snapshot reports no usable endpoint")
+	}
+	want := []string{upstreamWrongNetwork, upstreamLagging, upstreamOK}
+	for i, s := range statuses {
+		if s.Status != want[i] {
+			t.Errorf("%s: status %q, want %q", s.URL, s.Status, want[i])
+		}
+	}
+	reported, answered := p.Networks()
+	if answered != 3 || len(reported) != 2 {
+		t.Errorf("Networks() = %v, %d", reported, answered)
+	}
+}
+
+func TestStreamsAreNotRetried(t *testing.T) {
+	var primary, secondary atomic.Int32
+	primary.Store(http.StatusBadGateway)
+	secondary.Store(http.StatusOK)
+	a := fakeHorizon(t, testPassphrase, 100, &primary)
+	b := fakeHorizon(t, testPassphrase, 100, &secondary)
+
+	p := newTestPool(t, a.URL, b.URL)
+	req, _ := http.NewRequest(http.MethodGet, a.URL+"/ledgers", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := p.Client(0).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("stream status %d, want the first endpoint's 502 without a retry", resp.StatusCode)
+	}
+	if p.Active() != b.URL {
+		t.Errorf("active = %s, want the stream's endpoint benched", p.Active())
+	}
+}
@@ -0,0 +1,61 @@
+package horizonpool
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Pool metrics, registered with the default registry of the service using the pool
+var (
+	horizonRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pakana_horizon_request_duration_seconds",
+		Help:    "Horizon request latency by endpoint and status code (0 for transport errors).",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"endpoint", "code"})
+	horizonUpstreamUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pakana_horizon_upstream_up",
+		Help: "1 if the Horizon endpoint passed its last probe (reachable, right network, not lagging or slow).",
+	}, []string{"url"})
+	horizonFailovers = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pakana_horizon_failovers_total",
+		Help: "Times the active Horizon endpoint changed.",
+	})
+)
+
+// timedTransport times Horizon requests by endpoint
+type timedTransport struct {
+	base http.RoundTripper
+}
+
+func (t timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	code := "0"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	horizonRequestDuration.WithLabelValues(endpoint(req.Method, req.URL.Path), code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// endpoint reduces a Horizon path to a template: /accounts/G... becomes
+// /accounts/{id}, /ledgers/123/transactions becomes /ledgers/{id}/transactions
+func endpoint(method, path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		if i == 0 || part == "" {
+			continue
+		}
+		switch part {
+		case "transactions", "operations", "payments", "effects", "offers", "trades", "data":
+		default:
+			parts[i] = "{id}"
+		}
+	}
+	return method + " /" + strings.Join(parts, "/")
+}
@@ -0,0 +1,33 @@
+// Package logging sets up log/slog the same way in every service: JSON on stderr, every
+// line tagged with the service name. LOG_LEVEL sets the level (debug, info, warn, error)
+// and LOG_FORMAT=text switches to logfmt for local runs.
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Init installs the default slog logger, tagged with service
+func Init(service string) {
+	level := slog.LevelInfo
+	if env := os.Getenv("LOG_LEVEL"); env != "" {
+		if err := level.UnmarshalText([]byte(env)); err != nil {
+			level = slog.LevelInfo
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewJSONHandler(os.Stderr, opts)
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "text") {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler).With("service", service))
+}
+
+// Fatal logs at error level and exits
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,58 @@
+// Package stellarnet names the Stellar networks a node can index, the same way in every
+// service. api-go ingests one network and api-report serves several; both resolve a
+// name to its passphrase and default Horizon here, and derive the globals that hold the
+// network's data with Global.
+package stellarnet
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/stellar/go-stellar-sdk/network"
+)
+
+// Default is the network used when none is configured
+const Default = "testnet"
+
+// Network is a well-known network's passphrase and public Horizon
+type Network struct {
+	Passphrase string
+	HorizonURL string
+}
+
+// Known are the networks that need no passphrase or Horizon configured
+var Known = map[string]Network{
+	"testnet":   {network.TestNetworkPassphrase, "https://horizon-testnet.stellar.org"},
+	"pubnet":    {network.PublicNetworkPassphrase, "https://horizon.stellar.org"},
+	"futurenet": {network.FutureNetworkPassphrase, "https://horizon-futurenet.stellar.org"},
+}
+
+// Network names become part of global names, which YottaDB limits to 31 alphanumerics
+var validName = regexp.MustCompile(`^[a-z][a-z0-9]{0,19}$`)
+
+// ValidName reports whether name can name a network: lowercase letters and digits, at
+// most 20, starting with a letter
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// NameOf is the well-known network with the given passphrase, or "" for a custom one.
+// Deployments that only set STELLAR_NETWORK_PASSPHRASE resolve their network with it.
+func NameOf(passphrase string) string {
+	for name, known := range Known {
+		if known.Passphrase == passphrase {
+			return name
+		}
+	}
+	return ""
+}
+
+// Global is base qualified by the network. Testnet keeps the unqualified name, so
+// databases written before networks were configurable stay readable; any other network
+// appends its capitalised name (^Stellar becomes ^StellarPubnet).
+func Global(base, name string) string {
+	if name == Default {
+		return base
+	}
+	return base + strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,46 @@
+package stellarnet
+
+import (
+	"testing"
+
+	"github.com/stellar/go-stellar-sdk/network"
+)
+
+func TestGlobal(t *testing.T) {
+	for _, tc := range []struct{ base, name, want string }{
+		{"^Stellar", "testnet", "^Stellar"},
+		{"^Stellar", "pubnet", "^StellarPubnet"},
+		{"^Account", "futurenet", "^AccountFuturenet"},
+		{"^Ledger", "local1", "^LedgerLocal1"},
+	} {
+		if got := Global(tc.base, tc.name); got != tc.want {
+			t.Errorf("Global(%q, %q) = %q, want %q", tc.base, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"testnet":               true,
+		"local1":                true,
+		"a2345678901234567890":  true,
+		"a23456789012345678901": false,
+		"1net":                  false,
+		"Pubnet":                false,
+		"my-net":                false,
+		"":                      false,
+	} {
+		if got := ValidName(name); got != want {
+			t.Errorf("ValidName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestNameOf(t *testing.T) {
+	if got := NameOf(network.PublicNetworkPassphrase); got != "pubnet" {
+		t.Errorf("NameOf(pubnet passphrase) = %q", got)
+	}
+	if got := NameOf("Private Network ; 2024"); got != "" {
+		t.Errorf("NameOf(custom passphrase) = %q, want none", got)
+	}
+}
@@ -0,0 +1,53 @@
+// Package stellartx reads Stellar transaction envelopes the same way in every service.
+// api-report uses it to decide which streams and webhooks a transaction concerns, and
+// api-go's retention policy to keep transactions that touch a tracked account.
+package stellartx
+
+import (
+	"github.com/stellar/go-stellar-sdk/xdr"
+)
+
+// Participants is the set of accounts a transaction touches: the transaction (and
+// fee-bump) source, operation sources and the destinations of payment-style operations
+func Participants(envelope xdr.TransactionEnvelope) map[string]bool {
+	participants := make(map[string]bool)
+	add := func(m xdr.MuxedAccount) {
+		participants[m.ToAccountId().Address()] = true
+	}
+
+	add(envelope.SourceAccount())
+	if envelope.IsFeeBump() {
+		add(envelope.FeeBumpAccount())
+	}
+
+	for _, op := range envelope.Operations() {
+		if op.SourceAccount != nil {
+			add(*op.SourceAccount)
+		}
+		if payment, ok := op.Body.GetPaymentOp(); ok {
+			add(payment.Destination)
+		}
+		if create, ok := op.Body.GetCreateAccountOp(); ok {
+			participants[create.Destination.Address()] = true
+		}
+		if path, ok := op.Body.GetPathPaymentStrictReceiveOp(); ok {
+			add(path.Destination)
+		}
+		if path, ok := op.Body.GetPathPaymentStrictSendOp(); ok {
+			add(path.Destination)
+		}
+		if dest, ok := op.Body.GetDestination(); ok {
+			add(dest)
+		}
+	}
+	return participants
+}
+
+// ParticipantsXDR decodes a base64 TransactionEnvelope and returns its Participants
+func ParticipantsXDR(envelopeXDR string) (map[string]bool, error) {
+	var envelope xdr.TransactionEnvelope
+	if err := xdr.SafeUnmarshalBase64(envelopeXDR, &envelope); err != nil {
+		return nil, err
+	}
+	return Participants(envelope), nil
+}
@@ -0,0 +1,72 @@
+package stellartx
+
+import (
+	"testing"
+
+	"github.com/stellar/go-stellar-sdk/keypair"
+	"github.com/stellar/go-stellar-sdk/network"
+	"github.com/stellar/go-stellar-sdk/txnbuild"
+)
+
+func TestParticipants(t *testing.T) {
+	source, opSource, payee, created, merged, feePayer :=
+		keypair.MustRandom(), keypair.MustRandom(), keypair.MustRandom(),
+		keypair.MustRandom(), keypair.MustRandom(), keypair.MustRandom()
+	bystander := keypair.MustRandom()
+
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &txnbuild.SimpleAccount{AccountID: source.Address(), Sequence: 1},
+		IncrementSequenceNum: true,
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations: []txnbuild.Operation{
+			&txnbuild.Payment{Destination: payee.Address(), Amount: "1", Asset: txnbuild.NativeAsset{}, SourceAccount: opSource.Address()},
+			&txnbuild.CreateAccount{Destination: created.Address(), Amount: "1"},
+			&txnbuild.AccountMerge{Destination: merged.Address()},
+			&txnbuild.ManageData{Name: "lockb0x", Value: []byte(bystander.Address()[:32])},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	feeBump, err := txnbuild.NewFeeBumpTransaction(txnbuild.FeeBumpTransactionParams{
+		Inner:      tx,
+		FeeAccount: feePayer.Address(),
+		BaseFee:    txnbuild.MinBaseFee * 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feeBump, err = feeBump.Sign(network.TestNetworkPassphrase, feePayer); err != nil {
+		t.Fatal(err)
+	}
+	envelopeXDR, err := feeBump.Base64()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ParticipantsXDR(envelopeXDR)
+	if err != nil {
+		t.Fatalf("ParticipantsXDR: %v", err)
+	}
+	for name, kp := range map[string]*keypair.Full{
+		"source": source, "operation source": opSource, "payment destination": payee,
+		"created account": created, "merge destination": merged, "fee-bump source": feePayer,
+	} {
+		if !got[kp.Address()] {
+			t.Errorf("%s %s missing", name, kp.Address())
+		}
+	}
+	if got[bystander.Address()] {
+		t.Error("an account only named in a data value counted as a participant")
+	}
+	if len(got) != 6 {
+		t.Errorf("%d participants, want 6: %v", len(got), got)
+	}
+}
+
+func TestParticipantsXDRRejectsGarbage(t *testing.T) {
+	if _, err := ParticipantsXDR("not xdr"); err == nil {
+		t.Error("decoded an invalid envelope")
+	}
+}
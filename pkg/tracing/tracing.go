@@ -0,0 +1,77 @@
+// Package tracing sets up OpenTelemetry the same way in every service. Spans are
+// exported over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT (or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) is set, e.g. http://otel-collector:4318. Without
+// it the global no-op provider stays in place and spans cost next to nothing. The
+// standard OTEL_* variables (headers, sampler, service name) apply.
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/lockb0x-llc/pakana-node-0/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Init installs the W3C trace context propagator and, when an OTLP endpoint is
+// configured, a batching tracer provider for service. version is reported as
+// service.version unless empty. The returned function flushes pending spans.
+func Init(service, version string) func(context.Context) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		slog.Info("OTEL_EXPORTER_OTLP_ENDPOINT not set, tracing disabled")
+		return func(context.Context) error { return nil }
+	}
+
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		logging.Fatal("Failed to create OTLP trace exporter", "error", err)
+	}
+	attrs := []attribute.KeyValue{attribute.String("service.name", service)}
+	if version != "" {
+		attrs = append(attrs, attribute.String("service.version", version))
+	}
+	// Attributes from OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override these
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attrs...),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		slog.Warn("Incomplete tracing resource", "error", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	slog.Info("Tracing enabled", "service", service)
+	return provider.Shutdown
+}
+
+// Horizon runs a Horizon call under a "horizon <op>" client span from tracer.
+// horizonclient takes no context, so the span is opened around the call rather than by
+// the transport.
+func Horizon(ctx context.Context, tracer trace.Tracer, op string, fn func() error, attrs ...attribute.KeyValue) error {
+	_, span := tracer.Start(ctx, "horizon "+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	err := fn()
+	End(span, err)
+	return err
+}
+
+// End ends span, marking it failed if err is set
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}